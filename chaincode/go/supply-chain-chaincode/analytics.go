@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// AnalyticsWindow is the time window of a metric in unix seconds, a zero bound leaves it open
+type AnalyticsWindow struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+//argument order
+//0		1
+//From	To
+func ParseAnalyticsWindow(args []string) (AnalyticsWindow, error) {
+	window := AnalyticsWindow{}
+
+	for i, bound := range []*int64{&window.From, &window.To} {
+		if i < len(args) && args[i] != "" {
+			time, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || time < 0 {
+				return window, errors.New(fmt.Sprintf("time must be a non-negative integer, got %s", args[i]))
+			}
+			*bound = time
+		}
+	}
+
+	if window.To != 0 && window.To < window.From {
+		return window, errors.New(fmt.Sprintf("time window ends at %d before it starts at %d", window.To, window.From))
+	}
+
+	return window, nil
+}
+
+// Contains tells whether the time falls into the window
+func (window AnalyticsWindow) Contains(time int64) bool {
+	return (window.From == 0 || time >= window.From) && (window.To == 0 || time <= window.To)
+}
+
+// ratio is part of total, zero when there is nothing to divide
+func ratio(part float64, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total
+}
+
+// SupplierPerformance is the delivery and proof record of a supplier in a time window,
+// the times are in days
+type SupplierPerformance struct {
+	Supplier               string  `json:"supplier"`
+	Deliveries             int     `json:"deliveries"`
+	OnTime                 int     `json:"onTime"`
+	OnTimeRate             float64 `json:"onTimeRate"`
+	AverageOrderToDelivery float64 `json:"averageOrderToDelivery"`
+	ReportsAccepted        int     `json:"reportsAccepted"`
+	ReportsDeclined        int     `json:"reportsDeclined"`
+	PassRatio              float64 `json:"passRatio"`
+}
+
+// SupplierPerformances rates the suppliers by the shipments delivered and the reports submitted
+// in the window; a delivery is on time if it isn't later than the due date of its contract and
+// the order-to-delivery time runs from the order the contract was accepted from.
+// Shipments of contracts unknown to the caller are left out.
+func SupplierPerformances(window AnalyticsWindow, orders []Order, contracts []Contract, shipments []Shipment, reports []Report) []SupplierPerformance {
+	orderMap := make(map[string]OrderValue)
+	for _, order := range orders {
+		orderMap[order.Key.ID] = order.Value
+	}
+
+	contractMap := make(map[string]ContractValue)
+	for _, contract := range contracts {
+		contractMap[contract.Key.ID] = contract.Value
+	}
+
+	performances := make(map[string]*SupplierPerformance)
+	performance := func(supplier string) *SupplierPerformance {
+		if _, ok := performances[supplier]; !ok {
+			performances[supplier] = &SupplierPerformance{Supplier: supplier}
+		}
+		return performances[supplier]
+	}
+
+	orderToDelivery := make(map[string]int64)
+	ordersDelivered := make(map[string]int)
+	for _, shipment := range shipments {
+		if shipment.Value.State != stateShipmentDelivered || !window.Contains(shipment.Value.DeliveryDate) {
+			continue
+		}
+
+		contract, ok := contractMap[shipment.Value.ContractID]
+		if !ok {
+			continue
+		}
+
+		entry := performance(contract.ConsignorName)
+		entry.Deliveries++
+		if shipment.Value.DeliveryDate <= contract.DueDate {
+			entry.OnTime++
+		}
+
+		if order, ok := orderMap[shipment.Value.ContractID]; ok {
+			orderToDelivery[entry.Supplier] += shipment.Value.DeliveryDate - order.Timestamp
+			ordersDelivered[entry.Supplier]++
+		}
+	}
+
+	for _, report := range reports {
+		if !window.Contains(report.Value.Timestamp) {
+			continue
+		}
+
+		switch report.Value.State {
+		case stateReportAccepted:
+			performance(report.Value.ConsignorName).ReportsAccepted++
+		case stateReportDeclined:
+			performance(report.Value.ConsignorName).ReportsDeclined++
+		}
+	}
+
+	result := []SupplierPerformance{}
+	for supplier, entry := range performances {
+		entry.OnTimeRate = ratio(float64(entry.OnTime), float64(entry.Deliveries))
+		entry.AverageOrderToDelivery = ratio(float64(orderToDelivery[supplier]), float64(ordersDelivered[supplier]*secondsPerDay))
+		entry.PassRatio = ratio(float64(entry.ReportsAccepted), float64(entry.ReportsAccepted+entry.ReportsDeclined))
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Supplier < result[j].Supplier
+	})
+
+	return result
+}
+
+// Volume is the traded quantity and amount of the contracts sharing a product or a destination
+type Volume struct {
+	Key       string  `json:"key"`
+	Contracts int     `json:"contracts"`
+	Quantity  int     `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
+
+// TradeVolumes is the result of getTradeVolumes, the volumes are ordered by key
+type TradeVolumes struct {
+	Window        AnalyticsWindow `json:"window"`
+	ByProduct     []Volume        `json:"byProduct"`
+	ByDestination []Volume        `json:"byDestination"`
+}
+
+// TradeVolumesOf sums up the contracts signed in the window by product and by destination
+func TradeVolumesOf(window AnalyticsWindow, contracts []Contract) TradeVolumes {
+	byProduct := make(map[string]*Volume)
+	byDestination := make(map[string]*Volume)
+
+	add := func(volumes map[string]*Volume, key string, contract Contract) {
+		if _, ok := volumes[key]; !ok {
+			volumes[key] = &Volume{Key: key}
+		}
+		volumes[key].Contracts++
+		volumes[key].Quantity += contract.Value.Quantity
+		volumes[key].Amount += float64(contract.Value.TotalDue)
+	}
+
+	for _, contract := range contracts {
+		if !window.Contains(contract.Value.Timestamp) {
+			continue
+		}
+
+		add(byProduct, contract.Value.ProductName, contract)
+		add(byDestination, contract.Value.Destination, contract)
+	}
+
+	sorted := func(volumes map[string]*Volume) []Volume {
+		result := []Volume{}
+		for _, volume := range volumes {
+			result = append(result, *volume)
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Key < result[j].Key
+		})
+
+		return result
+	}
+
+	return TradeVolumes{Window: window, ByProduct: sorted(byProduct), ByDestination: sorted(byDestination)}
+}
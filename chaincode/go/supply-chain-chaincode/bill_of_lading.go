@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	billOfLadingIndex = "BillOfLading"
+)
+
+const (
+	billOfLadingKeyFieldsNumber      = 1
+	billOfLadingBasicArgumentsNumber = 2
+)
+
+//bill of lading state constants (from 0 to 3)
+const (
+	stateBillOfLadingUnknown = iota
+	stateBillOfLadingIssued
+	stateBillOfLadingEndorsed
+	stateBillOfLadingSurrendered
+)
+
+var billOfLadingStateLegal = map[int][]int{
+	stateBillOfLadingUnknown:     {},
+	stateBillOfLadingIssued:      {},
+	stateBillOfLadingEndorsed:    {},
+	stateBillOfLadingSurrendered: {},
+}
+
+var billOfLadingStateMachine = map[int][]int{
+	stateBillOfLadingUnknown:     {stateBillOfLadingUnknown},
+	stateBillOfLadingIssued:      {stateBillOfLadingEndorsed, stateBillOfLadingSurrendered},
+	stateBillOfLadingEndorsed:    {stateBillOfLadingEndorsed, stateBillOfLadingSurrendered},
+	stateBillOfLadingSurrendered: {stateBillOfLadingSurrendered},
+}
+
+type BillOfLadingKey struct {
+	ID string `json:"id"`
+}
+
+type BillOfLadingValue struct {
+	ShipmentID   string               `json:"shipmentID"`
+	ContractID   string               `json:"contractID"`
+	Issuer       string               `json:"issuer"`
+	Holder       string               `json:"holder"`
+	Holders      []BillOfLadingHolder `json:"holders"`
+	SecuredParty string               `json:"securedParty"`
+	PledgedFor   string               `json:"pledgedFor"`
+	State        int                  `json:"state"`
+	Timestamp    int64                `json:"timestamp"`
+	UpdatedDate  int64                `json:"updatedDate"`
+}
+
+// BillOfLadingHolder is a link of the holder chain, the first one is set by the issuer
+type BillOfLadingHolder struct {
+	Holder     string `json:"holder"`
+	EndorsedBy string `json:"endorsedBy"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+type BillOfLading struct {
+	Key   BillOfLadingKey   `json:"key"`
+	Value BillOfLadingValue `json:"value"`
+}
+
+func CreateBillOfLading() LedgerData {
+	return new(BillOfLading)
+}
+
+//argument order
+//0		1
+//ID	ShipmentID
+func (entity *BillOfLading) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < billOfLadingBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", billOfLadingBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:billOfLadingKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking shipment
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts([]string{args[1]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		compositeKey, _ := shipment.ToCompositeKey(stub)
+		return errors.New(fmt.Sprintf("shipment with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &shipment, shipmentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	// the goods are in the carrier's hands only once the shipment is confirmed
+	if shipment.Value.State != stateShipmentConfirmed {
+		return errors.New(fmt.Sprintf("bill of lading can be issued only for a confirmed shipment"))
+	}
+	entity.Value.ShipmentID = shipment.Key.ID
+	entity.Value.ContractID = shipment.Value.ContractID
+
+	issuer, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error()))
+	}
+	entity.Value.Issuer = issuer
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	//the shipper holds the bill of lading first
+	entity.Value.Holder = shipment.Value.Consignor
+	entity.Value.Holders = []BillOfLadingHolder{{Holder: shipment.Value.Consignor, EndorsedBy: issuer, Timestamp: timestamp.Seconds}}
+	entity.Value.State = stateBillOfLadingIssued
+	entity.Value.Timestamp = timestamp.Seconds
+	entity.Value.UpdatedDate = timestamp.Seconds
+
+	return nil
+}
+
+func (entity *BillOfLading) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < billOfLadingKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", billOfLadingKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *BillOfLading) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *BillOfLading) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(billOfLadingIndex, compositeKeyParts)
+}
+
+func (entity *BillOfLading) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// Endorse transfers the bill of lading from its current holder to the endorsee
+func (entity *BillOfLading) Endorse(holder string, endorsee string, timestamp int64) error {
+	if entity.Value.State == stateBillOfLadingSurrendered {
+		return errors.New(fmt.Sprintf("bill of lading %s is surrendered", entity.Key.ID))
+	}
+
+	if entity.Value.Holder != holder {
+		return errors.New(fmt.Sprintf("only the current holder can endorse bill of lading %s", entity.Key.ID))
+	}
+
+	if endorsee == "" || endorsee == holder {
+		return errors.New(fmt.Sprintf("endorsee must be not empty and differ from the holder"))
+	}
+
+	// a pledged bill of lading goes to the secured party, which discharges the pledge by endorsing it on
+	if securedParty := entity.Value.SecuredParty; securedParty != "" && holder != securedParty && endorsee != securedParty {
+		return errors.New(fmt.Sprintf("bill of lading %s is pledged to %s", entity.Key.ID, securedParty))
+	} else if holder == securedParty {
+		entity.Value.SecuredParty = ""
+		entity.Value.PledgedFor = ""
+	}
+
+	entity.Value.Holder = endorsee
+	entity.Value.Holders = append(entity.Value.Holders, BillOfLadingHolder{Holder: endorsee, EndorsedBy: holder, Timestamp: timestamp})
+	entity.Value.State = stateBillOfLadingEndorsed
+	entity.Value.UpdatedDate = timestamp
+
+	return nil
+}
+
+// Surrender closes the holder chain once the goods are delivered to the holder
+func (entity *BillOfLading) Surrender(holder string, timestamp int64) error {
+	if entity.Value.State == stateBillOfLadingSurrendered {
+		return errors.New(fmt.Sprintf("bill of lading %s is already surrendered", entity.Key.ID))
+	}
+
+	if entity.Value.Holder != holder {
+		return errors.New(fmt.Sprintf("only the current holder can surrender bill of lading %s", entity.Key.ID))
+	}
+
+	if entity.Value.SecuredParty != "" && holder != entity.Value.SecuredParty {
+		return errors.New(fmt.Sprintf("bill of lading %s is pledged to %s", entity.Key.ID, entity.Value.SecuredParty))
+	}
+
+	entity.Value.State = stateBillOfLadingSurrendered
+	entity.Value.UpdatedDate = timestamp
+
+	return nil
+}
+
+// Pledge secures the invoice with the bill of lading, from then on only the secured party
+// can take it over and have the goods delivered
+func (entity *BillOfLading) Pledge(holder string, securedParty string, invoiceID string, timestamp int64) error {
+	if entity.Value.State == stateBillOfLadingSurrendered {
+		return errors.New(fmt.Sprintf("bill of lading %s is surrendered", entity.Key.ID))
+	}
+
+	if entity.Value.Holder != holder {
+		return errors.New(fmt.Sprintf("only the current holder can pledge bill of lading %s", entity.Key.ID))
+	}
+
+	if entity.Value.SecuredParty != "" {
+		return errors.New(fmt.Sprintf("bill of lading %s is already pledged to %s", entity.Key.ID, entity.Value.SecuredParty))
+	}
+
+	if securedParty == "" || securedParty == holder {
+		return errors.New(fmt.Sprintf("secured party must be not empty and differ from the holder"))
+	}
+
+	entity.Value.SecuredParty = securedParty
+	entity.Value.PledgedFor = invoiceID
+	entity.Value.UpdatedDate = timestamp
+
+	return nil
+}
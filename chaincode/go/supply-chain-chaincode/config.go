@@ -5,25 +5,110 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 const chaincodeName = "SupplyChainChaincode"
 
 // Namespaces constants
 const (
-	configIndex = "ConfigSC"
+	configIndex         = "ConfigSC"
+	configRevisionIndex = "ConfigSCRevision"
 )
 
-// OrganizationalUnit constants
-var (
-	Buyer           = []string{"Buyer"}
-	Supplier        = []string{"Supplier"}
-	Auditor         = []string{"Auditor-1", "Auditor-2"}
-	Factor          = []string{"Factor-1", "Factor-2"}
-	Bank            = []string{"Bank"}
-	TransportAgency = []string{"Transporter"}
+// Entity indexes a collection can be configured for
+var entityIndexes = []string{
+	orderIndex,
+	contractIndex,
+	shipmentIndex,
+	documentIndex,
+	signatureIndex,
+	proofIndex,
+	reportIndex,
+	issuerKeyIndex,
+	revocationAuthorityIndex,
+	billOfLadingIndex,
+	eventIndex,
+}
+
+// Key-level endorsement policies: a change of the entity must be endorsed by the
+// peers of the organizations it names, see EndorsedData
+var endorsementPolicies = map[string]EndorsementPolicy{
+	contractIndex: {RoleType: statebased.RoleTypePeer, Create: CreateContract},
+}
+
+// Chaincode invoked through the bridge unless the config sets another one
+var defaultBridgeTarget = BridgeTarget{Chaincode: "trade-finance-chaincode", Channel: "common"}
+
+// Principal of a collection policy, e.g. 'ORG1MSP.member'
+var collectionPrincipal = regexp.MustCompile(`'([^'.]+)\.[a-z]+'`)
+
+// Roles of the role registry
+const (
+	roleBuyer       = "Buyer"
+	roleSupplier    = "Supplier"
+	roleAuditor     = "Auditor"
+	roleFactor      = "Factor"
+	roleBank        = "Bank"
+	roleTransporter = "Transporter"
+	roleAdmin       = "Admin"
 )
 
+// Organizational units the roles are granted to when the chaincode is instantiated
+var defaultRoleUnits = map[string][]string{
+	roleBuyer:       {"Buyer"},
+	roleSupplier:    {"Supplier"},
+	roleAuditor:     {"Auditor-1", "Auditor-2"},
+	roleFactor:      {"Factor-1", "Factor-2"},
+	roleBank:        {"Bank"},
+	roleTransporter: {"Transporter"},
+	roleAdmin:       {"Admin"},
+}
+
+// Roles named by signature rules
+var signerRoles = []string{roleBuyer, roleSupplier, roleAuditor, roleTransporter}
+
+// Roles a bill of lading can be endorsed to
+var billOfLadingEndorsees = []string{roleBank, roleFactor, roleBuyer}
+
+// Roles a bill of lading can be pledged to
+var billOfLadingSecuredParties = []string{roleBank, roleFactor}
+
+// Functions an attribute policy can be set for, with the names of the arguments
+// their policies can refer to
+var policyArguments = map[string][]string{
+	"placeOrder":                  {"orderID", "productName", "quantity", "price", "destination", "dueDate", "paymentDate"},
+	"updateOrder":                 {"orderID", "productName", "quantity", "price", "destination", "dueDate", "paymentDate"},
+	"cancelOrder":                 {"orderID"},
+	"guaranteeOrder":              {"orderID"},
+	"setExposureLimit":            {"bank", "buyer", "limit"},
+	"acceptOrder":                 {"orderID"},
+	"requestShipment":             {"shipmentID", "contractID", "shipFrom", "shipTo", "transport"},
+	"confirmShipment":             {"shipmentID"},
+	"confirmDelivery":             {"shipmentID"},
+	"uploadDocument":              {"documentID", "entityType", "entityID", "documentHash", "documentMeta", "documentType", "contractID", "category"},
+	"updateDocument":              {"documentID", "previousDocumentID", "documentHash", "documentMeta", "documentType"},
+	"signDocument":                {"documentID"},
+	"generateProof":               {"proofID", "owner", "shipmentID", "issuerID"},
+	"verifyProof":                 {"proofID", "reportState", "documentHash", "documentType"},
+	"updateProof":                 {"proofID"},
+	"setContractPredicates":       {"contractID"},
+	"issueBillOfLading":           {"billOfLadingID", "shipmentID"},
+	"endorseBillOfLading":         {"billOfLadingID", "endorsee"},
+	"pledgeBillOfLading":          {"billOfLadingID", "invoiceID", "securedParty"},
+	"registerIssuerKey":           {"issuerID", "name"},
+	"registerRevocationAuthority": {"issuerID"},
+	"publishCRI":                  {"issuerID"},
+	"revokeCredential":            {"proofID"},
+	"updateConfig":                {"config", "version"},
+	"grantRole":                   {"role", "kind", "value"},
+	"revokeRole":                  {"role", "kind", "value"},
+	"registerParticipant":         {"organizationalUnit", "mspID", "legalName", "lei", "country", "status", "kycStatus", "kycExpiry", "bankAccounts"},
+}
+
 // Type entity with documents
 const (
 	TypeUnknown = iota
@@ -52,23 +137,46 @@ var allowedDocumentTypes = map[int]bool{
 	DocTypeGIF: true,
 }
 
+// Transitions which can require documents
+var checklistTransitions = map[string]bool{
+	eventRequestShipment: true,
+	eventConfirmShipment: true,
+	eventConfirmDelivery: true,
+}
+
 // Type of events
 const (
-	eventPlaceOrder        = "placeOrder"
-	eventUpdateOrder       = "updateOrder"
-	eventGuaranteeOrder    = "guaranteeOrder"
-	eventCancelOrder       = "cancelOrder"
-	eventAcceptOrder       = "acceptOrder"
-	eventRequestShipment   = "requestShipment"
-	eventConfirmShipment   = "confirmShipment"
-	eventContractCompleted = "contractCompleted"
-	eventConfirmDelivery   = "confirmDelivery"
-	eventUploadDocument    = "uploadDocument"
-	eventGenerateProof     = "generateProof"
-	eventVerifyProof       = "verifyProof"
-	eventUpdateProof       = "updateProof"
-	eventSubmitReport      = "submitReport"
-	eventUpdateReport      = "updateReport"
+	eventPlaceOrder                  = "placeOrder"
+	eventUpdateOrder                 = "updateOrder"
+	eventGuaranteeOrder              = "guaranteeOrder"
+	eventCancelOrder                 = "cancelOrder"
+	eventAcceptOrder                 = "acceptOrder"
+	eventRequestShipment             = "requestShipment"
+	eventConfirmShipment             = "confirmShipment"
+	eventContractCompleted           = "contractCompleted"
+	eventConfirmDelivery             = "confirmDelivery"
+	eventUploadDocument              = "uploadDocument"
+	eventUpdateDocument              = "updateDocument"
+	eventSignDocument                = "signDocument"
+	eventGenerateProof               = "generateProof"
+	eventVerifyProof                 = "verifyProof"
+	eventUpdateProof                 = "updateProof"
+	eventSubmitReport                = "submitReport"
+	eventUpdateReport                = "updateReport"
+	eventRegisterIssuerKey           = "registerIssuerKey"
+	eventRegisterRevocationAuthority = "registerRevocationAuthority"
+	eventPublishCRI                  = "publishCRI"
+	eventRevokeCredential            = "revokeCredential"
+	eventSetContractPredicates       = "setContractPredicates"
+	eventIssueBillOfLading           = "issueBillOfLading"
+	eventEndorseBillOfLading         = "endorseBillOfLading"
+	eventSurrenderBillOfLading       = "surrenderBillOfLading"
+	eventPledgeBillOfLading          = "pledgeBillOfLading"
+	eventUpdateConfig                = "updateConfig"
+	eventGrantRole                   = "grantRole"
+	eventRevokeRole                  = "revokeRole"
+	eventSetExposureLimit            = "setExposureLimit"
+	eventRegisterParticipant         = "registerParticipant"
 )
 
 // Numerical constants
@@ -88,13 +196,60 @@ type ConfigKey struct {
 }
 
 type ConfigValue struct {
-	Collections   []Collection `json:"collections"`
-	ChaincodeName string       `json:"chaincodeName"`
+	Collections        []Collection       `json:"collections"`
+	ChaincodeName      string             `json:"chaincodeName"`
+	SignatureRules     []SignatureRule    `json:"signatureRules"`
+	DocumentCategories []DocumentCategory `json:"documentCategories"`
+	Checklists         []Checklist        `json:"checklists"`
+	Policies           []AccessPolicy     `json:"policies"`
+	Bridge             BridgeTarget       `json:"bridge"`
+	EventStorage       string             `json:"eventStorage"`
+	Version            int                `json:"version"`
+	UpdatedBy          string             `json:"updatedBy"`
+	UpdatedDate        int64              `json:"updatedDate"`
 }
 
+// Collection maps the entities to a private data collection shared by the members,
+// the MSP IDs of the organizations in its policy
 type Collection struct {
-	Name   string `json:"name"`
-	Policy string `json:"policy"`
+	Name     string   `json:"name"`
+	Policy   string   `json:"policy"`
+	Entities []string `json:"entities"`
+	Members  []string `json:"members"`
+}
+
+// SignatureRule lists the roles which must sign a document of the type or category
+// before it is complete
+type SignatureRule struct {
+	DocumentType int      `json:"documentType"`
+	Category     string   `json:"category"`
+	Signers      []string `json:"signers"`
+}
+
+// DocumentCategory is a business type of documents, e.g. a bill of lading,
+// and the file formats it can be uploaded in
+type DocumentCategory struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Formats []int  `json:"formats"`
+}
+
+// Checklist lists the document categories a contract must have before the transition
+type Checklist struct {
+	Transition string   `json:"transition"`
+	Categories []string `json:"categories"`
+}
+
+// AccessPolicy is the attribute policy an invoke function is restricted by, see Policy
+type AccessPolicy struct {
+	Function   string `json:"function"`
+	Expression string `json:"expression"`
+}
+
+// EndorsementPolicy is the key-level endorsement policy of an entity type
+type EndorsementPolicy struct {
+	RoleType statebased.RoleType
+	Create   FactoryMethod
 }
 
 func CreateConfig() LedgerData {
@@ -124,12 +279,339 @@ func (data *Config) FillFromArguments(stub shim.ChaincodeStubInterface, args []s
 
 	chaincodeName := args[1]
 
+	// parsing optional signature rules
+	signatureRules := []SignatureRule{}
+	if len(args) > 2 && len(args[2]) != 0 {
+		if err := json.Unmarshal([]byte(args[2]), &signatureRules); err != nil {
+			return errors.New(fmt.Sprintf("cannot unmarshaling signature rules : %s", err.Error()))
+		}
+	}
+
+	// parsing optional document categories
+	documentCategories := []DocumentCategory{}
+	if len(args) > 3 && len(args[3]) != 0 {
+		if err := json.Unmarshal([]byte(args[3]), &documentCategories); err != nil {
+			return errors.New(fmt.Sprintf("cannot unmarshaling document categories : %s", err.Error()))
+		}
+	}
+
+	// parsing optional checklists
+	checklists := []Checklist{}
+	if len(args) > 4 && len(args[4]) != 0 {
+		if err := json.Unmarshal([]byte(args[4]), &checklists); err != nil {
+			return errors.New(fmt.Sprintf("cannot unmarshaling checklists : %s", err.Error()))
+		}
+	}
+
 	data.Value.Collections = collections
 	data.Value.ChaincodeName = chaincodeName
+	data.Value.SignatureRules = signatureRules
+	data.Value.DocumentCategories = documentCategories
+	data.Value.Checklists = checklists
+
+	return data.Validate()
+}
+
+// Validate checks the config before it is stored by Init or updateConfig, it reads nothing
+// from the ledger as the peer refuses private data to Init
+func (data *Config) Validate() error {
+	if data.Value.ChaincodeName == "" {
+		return errors.New(fmt.Sprintf("chaincode name must be not empty"))
+	}
+
+	names := make(map[string]bool)
+	for _, collection := range data.Value.Collections {
+		if collection.Name == "" || names[collection.Name] {
+			return errors.New(fmt.Sprintf("collection name \"%s\" must be not empty and unique", collection.Name))
+		}
+		names[collection.Name] = true
+
+		if collection.Policy == "" {
+			return errors.New(fmt.Sprintf("collection %s must have a policy", collection.Name))
+		}
+
+		if len(collection.Entities) == 0 {
+			return errors.New(fmt.Sprintf("collection %s must be mapped to entities", collection.Name))
+		}
+
+		for _, entity := range collection.Entities {
+			known := false
+			for _, index := range entityIndexes {
+				if entity == index {
+					known = true
+				}
+			}
+
+			if !known {
+				return errors.New(fmt.Sprintf("collection %s is mapped to unknown entity %s", collection.Name, entity))
+			}
+		}
+
+		if len(collection.Members) == 0 {
+			return errors.New(fmt.Sprintf("collection %s must have members", collection.Name))
+		}
+
+		policyMembers := collectionPolicyMembers(collection.Policy)
+		for _, member := range collection.Members {
+			if !containsString(policyMembers, member) {
+				return errors.New(fmt.Sprintf("member %s of collection %s isn't in its policy", member, collection.Name))
+			}
+		}
+	}
+
+	// a member of two collections of the same entity would make its reads and writes ambiguous
+	for i, collection := range data.Value.Collections {
+		for _, other := range data.Value.Collections[i+1:] {
+			for _, entity := range collection.Entities {
+				if !containsString(other.Entities, entity) {
+					continue
+				}
+
+				for _, member := range collection.Members {
+					if containsString(other.Members, member) {
+						return errors.New(fmt.Sprintf("collections %s and %s both map %s of %s", collection.Name, other.Name, entity, member))
+					}
+				}
+			}
+		}
+	}
+
+	categories := make(map[string]bool)
+	for _, category := range data.Value.DocumentCategories {
+		if category.Code == "" || categories[category.Code] {
+			return errors.New(fmt.Sprintf("document category code \"%s\" must be not empty and unique", category.Code))
+		}
+		categories[category.Code] = true
+
+		if len(category.Formats) == 0 {
+			return errors.New(fmt.Sprintf("document category %s must allow at least one format", category.Code))
+		}
+
+		for _, format := range category.Formats {
+			if !allowedDocumentTypes[format] {
+				return errors.New(fmt.Sprintf("document category %s allows unacceptable type of document %d", category.Code, format))
+			}
+		}
+	}
+
+	for _, checklist := range data.Value.Checklists {
+		if !checklistTransitions[checklist.Transition] {
+			return errors.New(fmt.Sprintf("checklist for unknown transition %s", checklist.Transition))
+		}
+
+		for _, category := range checklist.Categories {
+			if !categories[category] {
+				return errors.New(fmt.Sprintf("checklist of %s requires unknown document category %s", checklist.Transition, category))
+			}
+		}
+	}
+
+	for _, rule := range data.Value.SignatureRules {
+		if rule.DocumentType == DocTypeUnknown && rule.Category == "" {
+			return errors.New(fmt.Sprintf("signature rule must name a type or a category of documents"))
+		}
+
+		if rule.DocumentType != DocTypeUnknown && !allowedDocumentTypes[rule.DocumentType] {
+			return errors.New(fmt.Sprintf("signature rule for unacceptable type of document %d", rule.DocumentType))
+		}
+
+		if rule.Category != "" && !categories[rule.Category] {
+			return errors.New(fmt.Sprintf("signature rule for unknown document category %s", rule.Category))
+		}
+
+		for _, signer := range rule.Signers {
+			known := false
+			for _, role := range signerRoles {
+				if role == signer {
+					known = true
+				}
+			}
+
+			if !known {
+				return errors.New(fmt.Sprintf("signature rule for unknown role %s", signer))
+			}
+		}
+	}
+
+	if bridge := data.Value.Bridge; (bridge.Chaincode == "") != (bridge.Channel == "") {
+		return errors.New(fmt.Sprintf("bridge must set both the chaincode and the channel"))
+	}
+
+	if storage := data.Value.EventStorage; storage != "" && storage != eventStorageState && storage != eventStorageNone {
+		return errors.New(fmt.Sprintf("unknown event storage %s: expected %s or %s", storage, eventStorageState, eventStorageNone))
+	}
+
+	policyFunctions := make(map[string]bool)
+	for _, policy := range data.Value.Policies {
+		if _, ok := policyArguments[policy.Function]; !ok {
+			return errors.New(fmt.Sprintf("policy for unknown function %s", policy.Function))
+		}
+
+		if policyFunctions[policy.Function] {
+			return errors.New(fmt.Sprintf("function %s has more than one policy", policy.Function))
+		}
+		policyFunctions[policy.Function] = true
+
+		if _, err := ParsePolicy(policy.Expression); err != nil {
+			return errors.New(fmt.Sprintf("policy of %s is invalid: %s", policy.Function, err.Error()))
+		}
+	}
 
 	return nil
 }
 
+// CheckCollectionsDefined reads from every collection of the config, the peer fails to read
+// from a collection missing in the collections config of the chaincode
+func (data *Config) CheckCollectionsDefined(stub shim.ChaincodeStubInterface) error {
+	for _, collection := range data.Value.Collections {
+		if _, err := stub.GetPrivateData(collection.Name, configIndex); err != nil {
+			return errors.New(fmt.Sprintf("collection %s isn't defined for the chaincode: %s", collection.Name, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// CollectionsFor returns the collection the entity is mapped to whose members include every
+// participant. An entity mapped to no collection is kept in the public state and gets none,
+// no collection or several collections matching is an error.
+func (data *Config) CollectionsFor(index string, participants []string) ([]string, error) {
+	names := []string{}
+	mapped := false
+
+	for _, collection := range data.Value.Collections {
+		if !containsString(collection.Entities, index) {
+			continue
+		}
+		mapped = true
+
+		shared := true
+		for _, participant := range participants {
+			if !containsString(collection.Members, participant) {
+				shared = false
+			}
+		}
+
+		if shared {
+			names = append(names, collection.Name)
+		}
+	}
+
+	if mapped && len(names) == 0 {
+		return names, errors.New(fmt.Sprintf("no collection of %s is shared by %s", index, strings.Join(participants, ", ")))
+	}
+
+	if len(names) > 1 {
+		sort.Strings(names)
+		return names, errors.New(fmt.Sprintf("several collections of %s are shared by %s: %s", index, strings.Join(participants, ", "), strings.Join(names, ", ")))
+	}
+
+	return names, nil
+}
+
+// collectionPolicyMembers returns the MSP IDs of the principals of the policy, e.g. ORG1MSP of 'ORG1MSP.member'
+func collectionPolicyMembers(policy string) []string {
+	members := []string{}
+	for _, principal := range collectionPrincipal.FindAllStringSubmatch(policy, -1) {
+		members = append(members, principal[1])
+	}
+
+	return members
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BridgeTarget returns the chaincode and the channel the other chaincode is invoked on
+func (data *Config) BridgeTarget() BridgeTarget {
+	if data.Value.Bridge.Chaincode == "" && data.Value.Bridge.Channel == "" {
+		return defaultBridgeTarget
+	}
+
+	return data.Value.Bridge
+}
+
+// KeepsPrivate tells whether the entities of the index are kept in private collections
+func (data *Config) KeepsPrivate(index string) bool {
+	for _, collection := range data.Value.Collections {
+		if containsString(collection.Entities, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StoresEvents tells whether the events are kept in state besides the chaincode event of the transaction
+func (data *Config) StoresEvents() bool {
+	return data.Value.EventStorage != eventStorageNone
+}
+
+// Policy returns the attribute policy expression of the function, empty if it has none
+func (data *Config) Policy(function string) string {
+	for _, policy := range data.Value.Policies {
+		if policy.Function == function {
+			return policy.Expression
+		}
+	}
+
+	return ""
+}
+
+// RequiredSigners returns the roles which must sign the document
+func (data *Config) RequiredSigners(document DocumentValue) []string {
+	signers := []string{}
+	added := make(map[string]bool)
+	for _, rule := range data.Value.SignatureRules {
+		if rule.DocumentType != DocTypeUnknown && rule.DocumentType != document.DocumentType {
+			continue
+		}
+
+		if rule.Category != "" && rule.Category != document.Category {
+			continue
+		}
+
+		for _, signer := range rule.Signers {
+			if !added[signer] {
+				added[signer] = true
+				signers = append(signers, signer)
+			}
+		}
+	}
+
+	return signers
+}
+
+// DocumentCategory returns the registered document category by its code
+func (data *Config) DocumentCategory(code string) (DocumentCategory, bool) {
+	for _, category := range data.Value.DocumentCategories {
+		if category.Code == code {
+			return category, true
+		}
+	}
+
+	return DocumentCategory{}, false
+}
+
+// RequiredCategories returns the document categories the transition requires
+func (data *Config) RequiredCategories(transition string) []string {
+	categories := []string{}
+	for _, checklist := range data.Value.Checklists {
+		if checklist.Transition == transition {
+			categories = append(categories, checklist.Categories...)
+		}
+	}
+
+	return categories
+}
+
 func (data *Config) FillFromCompositeKeyParts(compositeKeyParts []string) error {
 	return nil
 }
@@ -164,3 +646,62 @@ func (data *Config) ExistsIn(stub shim.ChaincodeStubInterface, collection string
 
 	return true
 }
+
+// Save stores the config as the given version and keeps the version in the change history
+func (data *Config) Save(stub shim.ChaincodeStubInterface, version int, updatedBy string) error {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	data.Value.Version = version
+	data.Value.UpdatedBy = updatedBy
+	data.Value.UpdatedDate = timestamp.Seconds
+
+	compositeKey, err := data.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	value, err := data.ToLedgerValue()
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(compositeKey, value); err != nil {
+		return err
+	}
+
+	revisionKey, err := stub.CreateCompositeKey(configRevisionIndex, []string{fmt.Sprintf("%010d", version)})
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(revisionKey, value)
+}
+
+// ConfigHistory returns the stored versions of the config, the oldest first
+func ConfigHistory(stub shim.ChaincodeStubInterface) ([]ConfigValue, error) {
+	history := []ConfigValue{}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(configRevisionIndex, []string{})
+	if err != nil {
+		return history, err
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return history, err
+		}
+
+		revision := ConfigValue{}
+		if err := json.Unmarshal(response.Value, &revision); err != nil {
+			return history, err
+		}
+		history = append(history, revision)
+	}
+
+	return history, nil
+}
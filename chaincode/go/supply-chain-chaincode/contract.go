@@ -7,6 +7,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/satori/go.uuid"
 	"strconv"
+	"supply-chain-chaincode/rangeproof"
 )
 
 const (
@@ -45,37 +46,43 @@ type ContractKey struct {
 }
 
 type ContractValue struct {
-	Price         float32  `json:"price"`
-	ProductName   string   `json:"productName"`
-	ConsignorName string   `json:"consignorName"`
-	ConsigneeName string   `json:"consigneeName"`
-	TotalDue      float32  `json:"totalDue"`
-	Quantity      int      `json:"quantity"`
-	Guarantor     string   `json:"guarantor"`
-	Destination   string   `json:"destination"`
-	DueDate       int64    `json:"dueDate"`
-	PaymentDate   int64    `json:"paymentDate"`
-	Documents     []string `json:"documents"`
-	State         int      `json:"state"`
-	Timestamp     int64    `json:"timestamp"`
-	UpdatedDate   int64    `json:"updatedDate"`
+	Price         float32                `json:"price"`
+	ProductName   string                 `json:"productName"`
+	ConsignorName string                 `json:"consignorName"`
+	ConsigneeName string                 `json:"consigneeName"`
+	ConsignorMSP  string                 `json:"consignorMSP"`
+	ConsigneeMSP  string                 `json:"consigneeMSP"`
+	TotalDue      float32                `json:"totalDue"`
+	Quantity      int                    `json:"quantity"`
+	Guarantor     string                 `json:"guarantor"`
+	Destination   string                 `json:"destination"`
+	DueDate       int64                  `json:"dueDate"`
+	PaymentDate   int64                  `json:"paymentDate"`
+	Documents     []string               `json:"documents"`
+	Predicates    []rangeproof.Predicate `json:"predicates"`
+	State         int                    `json:"state"`
+	Timestamp     int64                  `json:"timestamp"`
+	UpdatedDate   int64                  `json:"updatedDate"`
 }
 
 type ContractValueAdditional struct {
-	Price         float32    `json:"price"`
-	ProductName   string     `json:"productName"`
-	ConsignorName string     `json:"consignorName"`
-	ConsigneeName string     `json:"consigneeName"`
-	TotalDue      float32    `json:"totalDue"`
-	Quantity      int        `json:"quantity"`
-	Destination   string     `json:"destination"`
-	Guarantor     string     `json:"guarantor"`
-	DueDate       int64      `json:"dueDate"`
-	PaymentDate   int64      `json:"paymentDate"`
-	Documents     []Document `json:"documents"`
-	State         int        `json:"state"`
-	Timestamp     int64      `json:"timestamp"`
-	UpdatedDate   int64      `json:"updatedDate"`
+	Price         float32                `json:"price"`
+	ProductName   string                 `json:"productName"`
+	ConsignorName string                 `json:"consignorName"`
+	ConsigneeName string                 `json:"consigneeName"`
+	ConsignorMSP  string                 `json:"consignorMSP"`
+	ConsigneeMSP  string                 `json:"consigneeMSP"`
+	TotalDue      float32                `json:"totalDue"`
+	Quantity      int                    `json:"quantity"`
+	Destination   string                 `json:"destination"`
+	Guarantor     string                 `json:"guarantor"`
+	DueDate       int64                  `json:"dueDate"`
+	PaymentDate   int64                  `json:"paymentDate"`
+	Documents     []Document             `json:"documents"`
+	Predicates    []rangeproof.Predicate `json:"predicates"`
+	State         int                    `json:"state"`
+	Timestamp     int64                  `json:"timestamp"`
+	UpdatedDate   int64                  `json:"updatedDate"`
 }
 
 type Contract struct {
@@ -158,6 +165,24 @@ func (entity *Contract) FillFromArguments(stub shim.ChaincodeStubInterface, args
 	return nil
 }
 
+// SetPredicates replaces the predicates a proof for a shipment of the contract must prove
+func (entity *Contract) SetPredicates(jsonData string) error {
+	predicates := []rangeproof.Predicate{}
+	if err := json.Unmarshal([]byte(jsonData), &predicates); err != nil {
+		return errors.New(fmt.Sprintf("predicates are invalid: %s", err.Error()))
+	}
+
+	for _, predicate := range predicates {
+		if err := predicate.Check(); err != nil {
+			return errors.New(fmt.Sprintf("predicate is invalid: %s", err.Error()))
+		}
+	}
+
+	entity.Value.Predicates = predicates
+
+	return nil
+}
+
 func (entity *Contract) FillFromCompositeKeyParts(compositeKeyParts []string) error {
 	if len(compositeKeyParts) < contractKeyFieldsNumber {
 		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", contractKeyFieldsNumber))
@@ -193,3 +218,8 @@ func (entity *Contract) ToCompositeKey(stub shim.ChaincodeStubInterface) (string
 func (entity *Contract) ToLedgerValue() ([]byte, error) {
 	return json.Marshal(entity.Value)
 }
+
+// EndorsingOrganizations returns the organizations of the buyer and the supplier
+func (entity *Contract) EndorsingOrganizations() []string {
+	return []string{entity.Value.ConsigneeMSP, entity.Value.ConsignorMSP}
+}
@@ -29,6 +29,10 @@ type DocumentValue struct {
 	DocumentHash string `json:"documentHash"`
 	DocumentMeta string `json:"documentMeta"`
 	DocumentType int    `json:"documentType"`
+	Category     string `json:"category"`
+	Owner        string `json:"owner"`
+	Version      int    `json:"version"`
+	PreviousID   string `json:"previousID"`
 	Timestamp    int64  `json:"timestamp"`
 	UpdatedDate  int64  `json:"updatedDate"`
 }
@@ -38,13 +42,30 @@ type Document struct {
 	Value DocumentValue `json:"value"`
 }
 
+// DocumentVerification answers whether a hash is registered on the ledger
+type DocumentVerification struct {
+	DocumentHash string    `json:"documentHash"`
+	Registered   bool      `json:"registered"`
+	Document     *Document `json:"document"`
+	Superseded   bool      `json:"superseded"`
+	SupersededBy string    `json:"supersededBy"`
+	LatestID     string    `json:"latestID"`
+	Complete     bool      `json:"complete"`
+}
+
+// MissingDocuments lists the document categories a contract lacks for a transition
+type MissingDocuments struct {
+	Transition string   `json:"transition"`
+	Categories []string `json:"categories"`
+}
+
 func CreateDocument() LedgerData {
 	return new(Document)
 }
 
 //argument order
-//0		1			2			3				4				5				6
-//ID	EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID
+//0		1			2			3				4				5				6			7
+//ID	EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID	Category
 func (entity *Document) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
 	if len(args) < documentBasicArgumentsNumber {
 		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", documentBasicArgumentsNumber))
@@ -79,7 +100,7 @@ func (entity *Document) FillFromArguments(stub shim.ChaincodeStubInterface, args
 	entity.Value.EntityID = entityID
 
 	documentHash := args[3]
-	if entityID == "" {
+	if documentHash == "" {
 		message := fmt.Sprintf("documentHash must be not empty")
 		return errors.New(message)
 	}
@@ -112,6 +133,32 @@ func (entity *Document) FillFromArguments(stub shim.ChaincodeStubInterface, args
 	}
 	entity.Value.ContractID = contractID
 
+	//checking optional category
+	if len(args) > 7 && args[7] != "" {
+		config := Config{}
+		if err := LoadFrom(stub, &config, configIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return errors.New(message)
+		}
+
+		category, ok := config.DocumentCategory(args[7])
+		if !ok {
+			return errors.New(fmt.Sprintf("unknown document category %s", args[7]))
+		}
+
+		formatAllowed := false
+		for _, format := range category.Formats {
+			if format == documentType {
+				formatAllowed = true
+			}
+		}
+		if !formatAllowed {
+			return errors.New(fmt.Sprintf("unacceptable type of document for category %s", category.Code))
+		}
+		entity.Value.Category = category.Code
+	}
+
 	return nil
 }
 
@@ -1,17 +1,31 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
 	"github.com/satori/go.uuid"
+	"strconv"
 )
 
 const (
-	eventIndex = "Event"
+	eventIndex       = "Event"
+	eventTimeIndex   = "EventTime"
+	eventEntityIndex = "EventEntity"
 )
 
+// The time indexes of the events keep no value, an empty one would delete the key
+var eventIndexMarker = []byte{0x00}
+
+// Timestamps are zero padded in the index keys to sort them as numbers
+const eventTimestampFormat = "%019d"
+
+var errEventsNotStored = errors.New("events aren't kept in state, eventStorage of the config is none")
+
 const (
 	eventKeyFieldsNumber      = 1
 	eventBasicArgumentsNumber = 5
@@ -40,6 +54,54 @@ type Events struct {
 	Values []EventValue `json:"values"`
 }
 
+// Version of the payload of the chaincode events, a listener checks it before reading the payload
+const eventPayloadVersion = 1
+
+// Storages of the events besides the chaincode event of the transaction, see Config.StoresEvents
+const (
+	eventStorageState = "state"
+	eventStorageNone  = "none"
+)
+
+// EventActor is the identity which submitted the transaction
+type EventActor struct {
+	MSPID              string `json:"mspID"`
+	OrganizationalUnit string `json:"organizationalUnit"`
+}
+
+// EventPayload is the payload of the chaincode event of a transaction, the events carry
+// the snapshots of their entities so that listeners need nothing but the block
+type EventPayload struct {
+	Version   int        `json:"version"`
+	Chaincode string     `json:"chaincode"`
+	TxID      string     `json:"txID"`
+	Timestamp int64      `json:"timestamp"`
+	Actor     EventActor `json:"actor"`
+	Events    []Event    `json:"events"`
+}
+
+// EventDigest stands for the snapshot of an entity kept in a private collection, the block
+// carries its hash only and members of the collection check their copy against it
+type EventDigest struct {
+	Hash string `json:"hash"`
+}
+
+// DigestOf returns the digest of the snapshot, the SHA-256 of its JSON
+func DigestOf(snapshot interface{}) (EventDigest, error) {
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return EventDigest{}, err
+	}
+
+	hash := sha256.Sum256(bytes)
+	return EventDigest{Hash: hex.EncodeToString(hash[:])}, nil
+}
+
+// EventName is the name of the chaincode event of a transaction, named after its first action
+func EventName(chaincode string, action string) string {
+	return chaincode + "." + action
+}
+
 func CreateEvent() LedgerData {
 	return new(Event)
 }
@@ -89,3 +151,233 @@ func (entity *Event) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, e
 func (entity *Event) ToLedgerValue() ([]byte, error) {
 	return json.Marshal(entity.Value)
 }
+
+// Page sizes of listEvents
+const (
+	eventPageSizeDefault = 50
+	eventPageSizeMax     = 500
+)
+
+// EventFilter selects the events of listEvents, empty fields and zero times match any event
+type EventFilter struct {
+	EntityType string `json:"entityType"`
+	EntityID   string `json:"entityID"`
+	Action     string `json:"action"`
+	Creator    string `json:"creator"`
+	From       int64  `json:"from"`
+	To         int64  `json:"to"`
+}
+
+// EventPage is a page of events ordered by their timestamps, the filter may select
+// fewer events than the page size before the last page, the bookmark of which is empty
+type EventPage struct {
+	Events   []Event `json:"events"`
+	Bookmark string  `json:"bookmark"`
+}
+
+//argument order
+//0				1			2		3		4		5	6			7
+//EntityType	EntityID	Action	Creator	From	To	PageSize	Bookmark
+func ParseEventFilter(args []string) (EventFilter, int, string, error) {
+	filter := EventFilter{}
+	pageSize := eventPageSizeDefault
+	bookmark := ""
+
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+
+	filter.EntityType = arg(0)
+	filter.EntityID = arg(1)
+	filter.Action = arg(2)
+	filter.Creator = arg(3)
+
+	for i, bound := range []*int64{&filter.From, &filter.To} {
+		if value := arg(4 + i); value != "" {
+			time, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || time < 0 {
+				return filter, pageSize, bookmark, errors.New(fmt.Sprintf("time must be a non-negative integer, got %s", value))
+			}
+			*bound = time
+		}
+	}
+
+	if filter.To != 0 && filter.To < filter.From {
+		return filter, pageSize, bookmark, errors.New(fmt.Sprintf("time window ends at %d before it starts at %d", filter.To, filter.From))
+	}
+
+	if value := arg(6); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 || size > eventPageSizeMax {
+			return filter, pageSize, bookmark, errors.New(fmt.Sprintf("page size must be from 1 to %d, got %s", eventPageSizeMax, value))
+		}
+		pageSize = size
+	}
+
+	bookmark = arg(7)
+
+	return filter, pageSize, bookmark, nil
+}
+
+// Matches tells whether the event is selected by the filter
+func (filter EventFilter) Matches(event *Event) bool {
+	return (filter.EntityType == "" || event.Value.EntityType == filter.EntityType) &&
+		(filter.EntityID == "" || event.Value.EntityID == filter.EntityID) &&
+		(filter.Action == "" || event.Value.Action == filter.Action) &&
+		(filter.Creator == "" || event.Value.Creator == filter.Creator) &&
+		(filter.From == 0 || event.Value.Timestamp >= filter.From) &&
+		(filter.To == 0 || event.Value.Timestamp <= filter.To)
+}
+
+// FindEvents returns the events selected by the filter ordered by their timestamps
+func FindEvents(stub shim.ChaincodeStubInterface, filter EventFilter) ([]Event, error) {
+	page, err := scanEvents(stub, filter, 0, "")
+
+	return page.Events, err
+}
+
+// ListEvents returns the page of the events selected by the filter which follows
+// the bookmark, the first page if the bookmark is empty
+func ListEvents(stub shim.ChaincodeStubInterface, filter EventFilter, pageSize int, bookmark string) (EventPage, error) {
+	return scanEvents(stub, filter, int32(pageSize), bookmark)
+}
+
+// IndexEvent orders the event by time among all the events and among the events of its entity
+func IndexEvent(stub shim.ChaincodeStubInterface, event *Event) error {
+	timestamp := fmt.Sprintf(eventTimestampFormat, event.Value.Timestamp)
+	keys := map[string][]string{
+		eventTimeIndex:   {timestamp, event.Key.ID},
+		eventEntityIndex: {event.Value.EntityID, timestamp, event.Key.ID},
+	}
+
+	for index, parts := range keys {
+		key, err := stub.CreateCompositeKey(index, parts)
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot create %s key of event %s: %s", index, event.Key.ID, err.Error()))
+		}
+
+		if err := stub.PutState(key, eventIndexMarker); err != nil {
+			return errors.New(fmt.Sprintf("cannot put %s key of event %s: %s", index, event.Key.ID, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// IndexStoredEvents indexes the events which were stored in state before EmitEvent indexed them,
+// the chaincodes call it from Init so that an upgrade keeps the earlier events listed
+func IndexStoredEvents(stub shim.ChaincodeStubInterface) error {
+	it, err := stub.GetStateByPartialCompositeKey(eventIndex, []string{})
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get state by partial composite key %s: %s", eventIndex, err.Error()))
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		_, parts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return err
+		}
+
+		event := Event{}
+		if err := event.FillFromCompositeKeyParts(parts); err != nil {
+			return err
+		}
+		if err := event.FillFromLedgerValue(response.Value); err != nil {
+			return errors.New(fmt.Sprintf("unable to read event %s: %s", event.Key.ID, err.Error()))
+		}
+
+		if err := IndexEvent(stub, &event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanEvents walks the time ordered index of the events, the index of the entity if the filter
+// names one, a page holds the events of the next pageSize index entries the filter selects,
+// all of them if pageSize is zero
+func scanEvents(stub shim.ChaincodeStubInterface, filter EventFilter, pageSize int32, bookmark string) (EventPage, error) {
+	page := EventPage{Events: []Event{}}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		return page, errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
+	}
+
+	if !config.StoresEvents() {
+		return page, errEventsNotStored
+	}
+
+	index, partialKey := eventTimeIndex, []string{}
+	if filter.EntityID != "" {
+		index, partialKey = eventEntityIndex, []string{filter.EntityID}
+	}
+
+	var it shim.StateQueryIteratorInterface
+	var metadata *pb.QueryResponseMetadata
+	var err error
+	if pageSize > 0 {
+		it, metadata, err = stub.GetStateByPartialCompositeKeyWithPagination(index, partialKey, pageSize, bookmark)
+	} else {
+		it, err = stub.GetStateByPartialCompositeKey(index, partialKey)
+	}
+	if err != nil {
+		return page, errors.New(fmt.Sprintf("unable to get state by partial composite key %s: %s", index, err.Error()))
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return page, err
+		}
+
+		_, parts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return page, err
+		}
+
+		timestamp, err := strconv.ParseInt(parts[len(parts)-2], 10, 64)
+		if err != nil {
+			return page, errors.New(fmt.Sprintf("invalid timestamp in %s key: %s", index, err.Error()))
+		}
+
+		// no later entry of the index is in the time window
+		if filter.To != 0 && timestamp > filter.To {
+			return page, nil
+		}
+
+		if timestamp < filter.From {
+			continue
+		}
+
+		event := Event{}
+		if err := event.FillFromCompositeKeyParts(parts[len(parts)-1:]); err != nil {
+			return page, err
+		}
+
+		if err := LoadFrom(stub, &event, eventIndex); err != nil {
+			return page, errors.New(fmt.Sprintf("cannot load event %s: %s", event.Key.ID, err.Error()))
+		}
+
+		if filter.Matches(&event) {
+			page.Events = append(page.Events, event)
+		}
+	}
+
+	if metadata != nil && metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	return page, nil
+}
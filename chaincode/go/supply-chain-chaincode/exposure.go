@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"sort"
+	"strconv"
+)
+
+const (
+	exposureLimitIndex = "ExposureLimit"
+	guaranteeIndex     = "Guarantee"
+)
+
+const (
+	exposureLimitKeyFieldsNumber      = 2
+	exposureLimitBasicArgumentsNumber = 3
+	guaranteeKeyFieldsNumber          = 1
+)
+
+//guarantee state constants (from 0 to 2)
+const (
+	stateGuaranteeUnknown = iota
+	stateGuaranteeActive
+	stateGuaranteeReleased
+)
+
+type ExposureLimitKey struct {
+	Bank  string `json:"bank"`
+	Buyer string `json:"buyer"`
+}
+
+type ExposureLimitValue struct {
+	Limit       float32 `json:"limit"`
+	SetBy       string  `json:"setBy"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+// ExposureLimit caps the amount of the active guarantees of a bank, of the guarantees of
+// a bank for a buyer or, with no bank, of the guarantees for a buyer by every bank
+type ExposureLimit struct {
+	Key   ExposureLimitKey   `json:"key"`
+	Value ExposureLimitValue `json:"value"`
+}
+
+func CreateExposureLimit() LedgerData {
+	return new(ExposureLimit)
+}
+
+//argument order
+//0		1		2
+//Bank	Buyer	Limit
+func (entity *ExposureLimit) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < exposureLimitBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", exposureLimitBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:exposureLimitKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking limit
+	limit, err := strconv.ParseFloat(args[2], 32)
+	if err != nil || limit < 0 {
+		return errors.New(fmt.Sprintf("limit must be a non-negative number, got %s", args[2]))
+	}
+	entity.Value.Limit = float32(limit)
+
+	return nil
+}
+
+func (entity *ExposureLimit) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < exposureLimitKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", exposureLimitKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" && compositeKeyParts[1] == "" {
+		return errors.New("exposure limit must name a bank, a buyer or both")
+	}
+
+	entity.Key.Bank = compositeKeyParts[0]
+	entity.Key.Buyer = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *ExposureLimit) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *ExposureLimit) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.Bank,
+		entity.Key.Buyer,
+	}
+
+	return stub.CreateCompositeKey(exposureLimitIndex, compositeKeyParts)
+}
+
+func (entity *ExposureLimit) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// Covers tells whether the guarantee counts against the limit
+func (entity *ExposureLimit) Covers(guarantee GuaranteeValue) bool {
+	return (entity.Key.Bank == "" || entity.Key.Bank == guarantee.Bank) &&
+		(entity.Key.Buyer == "" || entity.Key.Buyer == guarantee.Buyer)
+}
+
+type GuaranteeKey struct {
+	ID string `json:"id"`
+}
+
+type GuaranteeValue struct {
+	Bank        string  `json:"bank"`
+	Buyer       string  `json:"buyer"`
+	Amount      float32 `json:"amount"`
+	State       int     `json:"state"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+// Guarantee is the exposure of a bank for the order it guarantees, the key is the ID of the order;
+// it is released when the order is canceled or its contract completes
+type Guarantee struct {
+	Key   GuaranteeKey   `json:"key"`
+	Value GuaranteeValue `json:"value"`
+}
+
+func CreateGuarantee() LedgerData {
+	return new(Guarantee)
+}
+
+func (entity *Guarantee) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	return errors.New("guarantee is made by guaranteeOrder")
+}
+
+func (entity *Guarantee) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < guaranteeKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", guaranteeKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *Guarantee) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Guarantee) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(guaranteeIndex, compositeKeyParts)
+}
+
+func (entity *Guarantee) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// loadExposure reads the exposure limits and the active guarantees
+func loadExposure(stub shim.ChaincodeStubInterface) ([]ExposureLimit, []Guarantee, error) {
+	limits := []ExposureLimit{}
+	limitsBytes, err := Query(stub, exposureLimitIndex, []string{}, CreateExposureLimit, EmptyFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(limitsBytes, &limits); err != nil {
+		return nil, nil, err
+	}
+
+	filterActive := func(data LedgerData) bool {
+		guarantee, ok := data.(*Guarantee)
+		return ok && guarantee.Value.State == stateGuaranteeActive
+	}
+
+	guarantees := []Guarantee{}
+	guaranteesBytes, err := Query(stub, guaranteeIndex, []string{}, CreateGuarantee, filterActive)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(guaranteesBytes, &guarantees); err != nil {
+		return nil, nil, err
+	}
+
+	return limits, guarantees, nil
+}
+
+// CheckExposure tells whether the guarantee fits into every limit covering it, together with
+// the active guarantees of other orders; a bank or buyer with no limit isn't capped
+func CheckExposure(stub shim.ChaincodeStubInterface, guarantee Guarantee) error {
+	limits, guarantees, err := loadExposure(stub)
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range limits {
+		if !limit.Covers(guarantee.Value) {
+			continue
+		}
+
+		outstanding := float64(guarantee.Value.Amount)
+		for _, active := range guarantees {
+			if active.Key.ID != guarantee.Key.ID && limit.Covers(active.Value) {
+				outstanding += float64(active.Value.Amount)
+			}
+		}
+
+		if outstanding > float64(limit.Value.Limit) {
+			return errors.New(fmt.Sprintf("exposure %.2f exceeds the limit %.2f of bank \"%s\" and buyer \"%s\"",
+				outstanding, limit.Value.Limit, limit.Key.Bank, limit.Key.Buyer))
+		}
+	}
+
+	return nil
+}
+
+// ReleaseGuarantee releases the guarantee of the order if it has an active one
+func ReleaseGuarantee(stub shim.ChaincodeStubInterface, orderID string, timestamp int64) error {
+	guarantee := Guarantee{Key: GuaranteeKey{ID: orderID}}
+	if !ExistsIn(stub, &guarantee, guaranteeIndex) {
+		return nil
+	}
+
+	if err := LoadFrom(stub, &guarantee, guaranteeIndex); err != nil {
+		return err
+	}
+
+	if guarantee.Value.State != stateGuaranteeActive {
+		return nil
+	}
+
+	guarantee.Value.State = stateGuaranteeReleased
+	guarantee.Value.UpdatedDate = timestamp
+
+	return UpdateOrInsertIn(stub, &guarantee, guaranteeIndex, []string{""}, "")
+}
+
+// Exposure is the amount of the active guarantees of a bank for a buyer
+type Exposure struct {
+	Bank        string  `json:"bank"`
+	Buyer       string  `json:"buyer"`
+	Guarantees  int     `json:"guarantees"`
+	Outstanding float64 `json:"outstanding"`
+}
+
+// ExposureUsage is how much of a limit the active guarantees take
+type ExposureUsage struct {
+	Bank        string  `json:"bank"`
+	Buyer       string  `json:"buyer"`
+	Limit       float64 `json:"limit"`
+	Outstanding float64 `json:"outstanding"`
+	Available   float64 `json:"available"`
+}
+
+// ExposureReport is the result of getExposureReport, ordered by bank and buyer
+type ExposureReport struct {
+	Exposures []Exposure      `json:"exposures"`
+	Limits    []ExposureUsage `json:"limits"`
+}
+
+// ExposureReportOf sums up the active guarantees by bank and buyer and against every limit,
+// a non-empty bank restricts the report to the guarantees and limits of that bank
+func ExposureReportOf(limits []ExposureLimit, guarantees []Guarantee, bank string) ExposureReport {
+	report := ExposureReport{Exposures: []Exposure{}, Limits: []ExposureUsage{}}
+
+	exposures := make(map[ExposureLimitKey]*Exposure)
+	for _, guarantee := range guarantees {
+		if bank != "" && guarantee.Value.Bank != bank {
+			continue
+		}
+
+		key := ExposureLimitKey{Bank: guarantee.Value.Bank, Buyer: guarantee.Value.Buyer}
+		if _, ok := exposures[key]; !ok {
+			exposures[key] = &Exposure{Bank: key.Bank, Buyer: key.Buyer}
+		}
+		exposures[key].Guarantees++
+		exposures[key].Outstanding += float64(guarantee.Value.Amount)
+	}
+
+	for _, exposure := range exposures {
+		report.Exposures = append(report.Exposures, *exposure)
+	}
+
+	for _, limit := range limits {
+		if bank != "" && limit.Key.Bank != bank {
+			continue
+		}
+
+		usage := ExposureUsage{Bank: limit.Key.Bank, Buyer: limit.Key.Buyer, Limit: float64(limit.Value.Limit)}
+		for _, guarantee := range guarantees {
+			if limit.Covers(guarantee.Value) {
+				usage.Outstanding += float64(guarantee.Value.Amount)
+			}
+		}
+		usage.Available = usage.Limit - usage.Outstanding
+
+		report.Limits = append(report.Limits, usage)
+	}
+
+	sort.Slice(report.Exposures, func(i, j int) bool {
+		if report.Exposures[i].Bank != report.Exposures[j].Bank {
+			return report.Exposures[i].Bank < report.Exposures[j].Bank
+		}
+		return report.Exposures[i].Buyer < report.Exposures[j].Buyer
+	})
+
+	sort.Slice(report.Limits, func(i, j int) bool {
+		if report.Limits[i].Bank != report.Limits[j].Bank {
+			return report.Limits[i].Bank < report.Limits[j].Bank
+		}
+		return report.Limits[i].Buyer < report.Limits[j].Buyer
+	})
+
+	return report
+}
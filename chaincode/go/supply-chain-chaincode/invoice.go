@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// invoice state constants, as kept by the trade-finance chaincode
+const (
+	stateInvoiceUnknown = iota
+	stateInvoiceIssued
+	stateInvoiceSigned
+	stateInvoiceForSale
+	stateInvoiceSold
+	stateInvoiceRemoved
+	stateInvoiceRejected
+)
+
+// Invoice is the view of the invoice registered in the trade-finance chaincode for a contract
+type Invoice struct {
+	Key   InvoiceKey   `json:"key"`
+	Value InvoiceValue `json:"value"`
+}
+
+type InvoiceKey struct {
+	ID string `json:"id"`
+}
+
+type InvoiceValue struct {
+	Debtor      string  `json:"debtor"`
+	Beneficiary string  `json:"beneficiary"`
+	TotalDue    float32 `json:"totalDue"`
+	PaymentDate int64   `json:"paymentDate"`
+	State       int     `json:"state"`
+	Guarantor   string  `json:"guarantor"`
+}
+
+// loadInvoice queries the trade-finance chaincode for the invoice,
+// errors of the trade-finance chaincode are *BridgeError
+func loadInvoice(stub shim.ChaincodeStubInterface, invoiceID string) (Invoice, error) {
+	invoice := Invoice{}
+
+	request := GetInvoiceRequest{InvoiceID: invoiceID}
+
+	err := InvokeBridge(stub, bridgeGetInvoice, request, &invoice)
+	return invoice, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/idemix"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	issuerKeyIndex = "IssuerKey"
+)
+
+const (
+	issuerKeyKeyFieldsNumber      = 1
+	issuerKeyBasicArgumentsNumber = 3
+)
+
+type IssuerKeyKey struct {
+	ID string `json:"id"`
+}
+
+type IssuerKeyValue struct {
+	Name        string                  `json:"name"`
+	Owner       string                  `json:"owner"`
+	Ipk         *idemix.IssuerPublicKey `json:"ipk"`
+	Timestamp   int64                   `json:"timestamp"`
+	UpdatedDate int64                   `json:"updatedDate"`
+}
+
+type IssuerKey struct {
+	Key   IssuerKeyKey   `json:"key"`
+	Value IssuerKeyValue `json:"value"`
+}
+
+func CreateIssuerKey() LedgerData {
+	return new(IssuerKey)
+}
+
+//argument order
+//0		1		2
+//ID	Name	IssuerPublicKey
+func (entity *IssuerKey) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < issuerKeyBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", issuerKeyBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:issuerKeyKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking name
+	name := args[1]
+	if name == "" {
+		return errors.New(fmt.Sprintf("issuer Name must be not empty"))
+	}
+	entity.Value.Name = name
+
+	//checking issuer public key
+	ipk := &idemix.IssuerPublicKey{}
+	if err := json.Unmarshal([]byte(args[2]), ipk); err != nil {
+		return errors.New(fmt.Sprintf("issuer public key is invalid: %s", err.Error()))
+	}
+
+	if len(ipk.AttributeNames) < 2 || ipk.AttributeNames[len(ipk.AttributeNames)-1] != revocationHandleAttribute {
+		return errors.New(fmt.Sprintf("issuer public key must declare attributes followed by \"%s\"", revocationHandleAttribute))
+	}
+
+	// checking the proof of knowledge of the issuer secret key
+	if err := ipk.Check(); err != nil {
+		return errors.New(fmt.Sprintf("issuer public key is not valid: %s", err.Error()))
+	}
+	entity.Value.Ipk = ipk
+
+	return nil
+}
+
+func (entity *IssuerKey) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < issuerKeyKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", issuerKeyKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *IssuerKey) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *IssuerKey) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(issuerKeyIndex, compositeKeyParts)
+}
+
+func (entity *IssuerKey) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
 	"github.com/satori/go.uuid"
 	"math/big"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -127,25 +128,16 @@ func UpdateOrInsertIn(stub shim.ChaincodeStubInterface, data LedgerData, index s
 		return errors.New(message)
 	}
 
+	organizations, roleType := endorsementOf(data, index, participiants, endorserRoleType)
+
 	if len(collections) != 0 && collections[0] != "" {
 		for _, collectionName := range collections {
 			Logger.Debug(fmt.Sprintf("PutPrivateData. collectionName: %s", collectionName))
 			if err = stub.PutPrivateData(collectionName, compositeKey, value); err != nil {
 				return err
 			}
-			if len(participiants) != 1 && participiants[0] == "" {
-				// set new endorsement policy. Start
-				ep, err := statebased.NewStateEP(nil)
-				if err != nil {
-					return err
-				}
-
-				err = ep.AddOrgs(endorserRoleType, participiants[1:]...)
-				if err != nil {
-					return err
-				}
-				// set the endorsement policy
-				epBytes, err := ep.Policy()
+			if len(organizations) != 0 {
+				epBytes, err := endorsementPolicy(roleType, organizations)
 				if err != nil {
 					return err
 				}
@@ -154,7 +146,6 @@ func UpdateOrInsertIn(stub shim.ChaincodeStubInterface, data LedgerData, index s
 				if err != nil {
 					return err
 				}
-				//set new endorsement policy. End
 			}
 		}
 	} else {
@@ -162,32 +153,107 @@ func UpdateOrInsertIn(stub shim.ChaincodeStubInterface, data LedgerData, index s
 		if err = stub.PutState(compositeKey, value); err != nil {
 			return err
 		}
-		if len(participiants) != 1 && participiants[0] == "" {
-			// set new endorsement policy. Start
-			ep, err := statebased.NewStateEP(nil)
+		if len(organizations) != 0 {
+			epBytes, err := endorsementPolicy(roleType, organizations)
 			if err != nil {
 				return err
 			}
 
-			err = ep.AddOrgs(endorserRoleType, participiants[1:]...)
+			err = stub.SetStateValidationParameter(compositeKey, epBytes)
 			if err != nil {
 				return err
 			}
-			// set the endorsement policy
-			epBytes, err := ep.Policy()
-			if err != nil {
-				return err
+		}
+	}
+
+	return nil
+}
+
+// EndorsedData is implemented by the entities of endorsementPolicies, it names the MSP IDs
+// of the organizations whose peers must endorse a change of the entity
+type EndorsedData interface {
+	EndorsingOrganizations() []string
+}
+
+// endorsementOf returns the organizations and the role of the key-level endorsement policy,
+// the one declared for the entity or else the one of the explicit participants
+func endorsementOf(data LedgerData, index string, participiants []string, endorserRoleType statebased.RoleType) ([]string, statebased.RoleType) {
+	organizations := []string{}
+
+	if policy, ok := endorsementPolicies[index]; ok {
+		if entity, ok := data.(EndorsedData); ok {
+			for _, organization := range entity.EndorsingOrganizations() {
+				if organization != "" {
+					organizations = append(organizations, organization)
+				}
 			}
+		}
 
-			err = stub.SetStateValidationParameter(compositeKey, epBytes)
-			if err != nil {
-				return err
+		return organizations, policy.RoleType
+	}
+
+	if endorserRoleType != "" && !(len(participiants) == 1 && participiants[0] == "") {
+		organizations = append(organizations, participiants...)
+	}
+
+	return organizations, endorserRoleType
+}
+
+func endorsementPolicy(roleType statebased.RoleType, organizations []string) ([]byte, error) {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ep.AddOrgs(roleType, organizations...); err != nil {
+		return nil, err
+	}
+
+	return ep.Policy()
+}
+
+// GetEndorsementOrganizations returns the organizations of the key-level endorsement policy of the entity
+func GetEndorsementOrganizations(stub shim.ChaincodeStubInterface, data LedgerData, index string) ([]string, error) {
+	compositeKey, err := data.ToCompositeKey(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := GetCollectionName(stub, index, []string{""})
+	if err != nil {
+		message := fmt.Sprintf("cannot get collection name from config: %s", err.Error())
+		return nil, errors.New(message)
+	}
+
+	var epBytes []byte
+	if len(collections) != 0 && collections[0] != "" {
+		for _, collectionName := range collections {
+			if epBytes, err = stub.GetPrivateDataValidationParameter(collectionName, compositeKey); err != nil {
+				return nil, err
 			}
-			//set new endorsement policy. End
+			if epBytes != nil {
+				break
+			}
+		}
+	} else {
+		if epBytes, err = stub.GetStateValidationParameter(compositeKey); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	if epBytes == nil {
+		return []string{}, nil
+	}
+
+	ep, err := statebased.NewStateEP(epBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations := ep.ListOrgs()
+	sort.Strings(organizations)
+
+	return organizations, nil
 }
 
 type FactoryMethod func() LedgerData
@@ -485,20 +551,9 @@ func GetCollectionName(stub shim.ChaincodeStubInterface, index string, participi
 		return collectionName, err
 	}
 
-	collections := config.Value.Collections
-
-	for _, col := range collections {
-		count := 0
-		if strings.Contains(col.Name, index) {
-			for _, participiant := range participiants {
-				if strings.Contains(col.Policy, participiant) {
-					count++
-				}
-			}
-		}
-		if len(participiants) == count {
-			collectionName = append(collectionName, col.Name)
-		}
+	collectionName, err = config.CollectionsFor(index, participiants)
+	if err != nil {
+		return collectionName, err
 	}
 
 	Logger.Debug(fmt.Sprintf("Got collection name: %s", collectionName))
@@ -596,14 +651,55 @@ func UUIDv4FromTXTimestamp(stub shim.ChaincodeStubInterface, delta int) (string,
 	return u.String(), nil
 }
 
+// EmitEvent sets the chaincode event of the transaction, named after the action of the first
+// event, with an EventPayload; the events are kept in state as well unless the config says otherwise
 func (events *Events) EmitEvent(stub shim.ChaincodeStubInterface) error {
 
 	Logger.Debug("### emitEvent started ###")
 
-	for i, value := range events.Values {
-		eventAction := value.Action
-		var err error
+	if len(events.Values) == 0 {
+		return nil
+	}
 
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+
+		return errors.New(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	payload := EventPayload{
+		Version:   eventPayloadVersion,
+		Chaincode: config.Value.ChaincodeName,
+		TxID:      stub.GetTxID(),
+		Timestamp: timestamp.Seconds,
+		Actor:     EventActor{MSPID: mspID, OrganizationalUnit: creator},
+	}
+
+	for i, value := range events.Values {
 		newID, err := UUIDv4FromTXTimestamp(stub, i+1)
 		if err != nil {
 			message := fmt.Sprintf(err.Error())
@@ -616,62 +712,54 @@ func (events *Events) EmitEvent(stub shim.ChaincodeStubInterface) error {
 			return errors.New(message)
 		}
 		event.Value = value
+		event.Value.Creator = creator
+		event.Value.Timestamp = timestamp.Seconds
 
-		creator, err := GetCreatorOrganizationalUnit(stub)
-		if err != nil {
-			message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
-			Logger.Error(message)
-			return errors.New(message)
+		// snapshots of private entities would publish them in the block
+		if config.KeepsPrivate(value.EntityType) {
+			digest, err := DigestOf(value.Other)
+			if err != nil {
+				message := fmt.Sprintf("cannot digest the snapshot of %s %s: %s", value.EntityType, value.EntityID, err.Error())
+				Logger.Error(message)
+				return errors.New(message)
+			}
+			event.Value.Other = digest
 		}
-		Logger.Debug("OrganizationalUnit: " + creator)
 
-		config := Config{}
-		if err := LoadFrom(stub, &config, configIndex); err != nil {
-			message := fmt.Sprintf("persistence error: %s", err.Error())
+		events.Keys = append(events.Keys, event.Key)
+		payload.Events = append(payload.Events, event)
 
-			return errors.New(message)
+		if !config.StoresEvents() {
+			continue
 		}
 
-		//getting transaction Timestamp
-		timestamp, err := stub.GetTxTimestamp()
-		if err != nil {
-			message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		if err := UpdateOrInsertIn(stub, &event, eventIndex, []string{""}, ""); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
 			Logger.Error(message)
 			return errors.New(message)
 		}
 
-		event.Value.Creator = creator
-		event.Value.Timestamp = timestamp.Seconds
-
-		bytes, err := json.Marshal(event)
-		if err != nil {
-			message := fmt.Sprintf("Error marshaling: %s", err.Error())
-			return errors.New(message)
-		}
-		eventName := eventIndex + "." + config.Value.ChaincodeName + "." + eventAction + "." + newID
-		events.Keys = append(events.Keys, EventKey{ID: eventName})
-
-		if err := UpdateOrInsertIn(stub, &event, eventIndex, []string{""}, ""); err != nil {
+		if err := IndexEvent(stub, &event); err != nil {
 			message := fmt.Sprintf("persistence error: %s", err.Error())
 			Logger.Error(message)
 			return errors.New(message)
 		}
 
-		Logger.Info(fmt.Sprintf("Event set: %s without errors", string(bytes)))
-		Logger.Debug(fmt.Sprintf("Success: Event set: %s", string(bytes)))
+		Logger.Debug(fmt.Sprintf("Success: Event %s stored", event.Key.ID))
 	}
 
-	generalKey, err := json.Marshal(events.Keys)
+	bytes, err := json.Marshal(payload)
 	if err != nil {
 		message := fmt.Sprintf("Error marshaling: %s", err.Error())
 		return errors.New(message)
 	}
 
-	if err := stub.SetEvent(string(generalKey), nil); err != nil {
+	eventName := EventName(config.Value.ChaincodeName, events.Values[0].Action)
+	if err := stub.SetEvent(eventName, bytes); err != nil {
 		message := fmt.Sprintf("Error setting event: %s", err.Error())
 		return errors.New(message)
 	}
-	Logger.Debug(fmt.Sprintf("generalEventName: %s", string(generalKey)))
+	Logger.Info(fmt.Sprintf("Event %s set: %s without errors", eventName, string(bytes)))
 
 	Logger.Debug("### emitEvent success ###")
 	return nil
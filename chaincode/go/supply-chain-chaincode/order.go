@@ -53,6 +53,7 @@ type OrderValue struct {
 	DueDate     int64   `json:"dueDate"`
 	PaymentDate int64   `json:"paymentDate"`
 	BuyerID     string  `json:"buyerID"`
+	BuyerMSP    string  `json:"buyerMSP"`
 	State       int     `json:"state"`
 	Guarantor   string  `json:"guarantor"`
 	Timestamp   int64   `json:"timestamp"`
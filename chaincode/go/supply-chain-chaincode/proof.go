@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,16 +10,25 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/idemix"
 	"github.com/satori/go.uuid"
-	"math/rand"
+	"supply-chain-chaincode/rangeproof"
 )
 
 const (
 	proofIndex = "Proof"
 )
 
+// name of the last attribute of every issuer key, see the proofbuilder package
+const revocationHandleAttribute = "revocationHandle"
+
 const (
 	proofKeyFieldsNumber      = 1
-	proofBasicArgumentsNumber = 3
+	proofBasicArgumentsNumber = 4
+)
+
+//proof type constants
+const (
+	proofTypeSelectiveDisclosure = iota
+	proofTypePredicate
 )
 
 //proof state constants (from 0 to 2)
@@ -51,25 +61,27 @@ type ProofKey struct {
 }
 
 type ProofValue struct {
-	SnapShot            *idemix.Signature        `json:"snapShot"`
-	DataForVerification ProofDataForVerification `json:"dataForVerification"`
-	State               int                      `json:"state"`
-	ConsignorName       string                   `json:"consignorName"`
-	Owner               string                   `json:"owner"`
-	Timestamp           int64                    `json:"timestamp"`
-	ShipmentID          string                   `json:"shipmentID"`
-	UpdatedDate         int64                    `json:"updatedDate"`
+	Type                int                         `json:"type"`
+	SnapShot            *idemix.Signature           `json:"snapShot"`
+	DataForVerification ProofDataForVerification    `json:"dataForVerification"`
+	PredicateProofs     []rangeproof.PredicateProof `json:"predicateProofs"`
+	State               int                         `json:"state"`
+	ConsignorName       string                      `json:"consignorName"`
+	IssuerID            string                      `json:"issuerID"`
+	RevocationHandle    string                      `json:"revocationHandle"`
+	Owner               string                      `json:"owner"`
+	Timestamp           int64                       `json:"timestamp"`
+	ShipmentID          string                      `json:"shipmentID"`
+	UpdatedDate         int64                       `json:"updatedDate"`
 }
 
 type ProofDataForVerification struct {
-	Disclosure          []byte                  `json:"disclosure"`
-	Ipk                 *idemix.IssuerPublicKey `json:"ipk"`
-	Msg                 []byte                  `json:"msg"`
-	AttributeValuesHash [][]byte                `json:"attributeValuesHash"`
-	AttributeValues     []string                `json:"attributeValues"`
-	RhIndex             int                     `json:"rhIndex"`
-	RevPk               string                  `json:"revPk"`
-	Epoch               int                     `json:"epoch"`
+	Disclosure       []byte   `json:"disclosure"`
+	Msg              []byte   `json:"msg"`
+	AttributeValues  []string `json:"attributeValues"`
+	RhIndex          int      `json:"rhIndex"`
+	RevocationHandle []byte   `json:"revocationHandle"`
+	Epoch            int      `json:"epoch"`
 }
 
 type Proof struct {
@@ -77,19 +89,13 @@ type Proof struct {
 	Value ProofValue `json:"value"`
 }
 
-type AttributeData struct {
-	AttributeName       string `json:"attributeName"`
-	AttributeValue      string `json:"attributeValue"`
-	AttributeDisclosure byte   `json:"attributeDisclosure"`
-}
-
 func CreateProof() LedgerData {
 	return new(Proof)
 }
 
 //argument order
-//0		1				2		3
-//ID	ArrayAttributes	Owner	ShipmentID
+//0		1		2			3
+//ID	Owner	ShipmentID	IssuerID
 func (entity *Proof) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
 	if len(args) < proofBasicArgumentsNumber {
 		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", proofBasicArgumentsNumber))
@@ -102,12 +108,26 @@ func (entity *Proof) FillFromArguments(stub shim.ChaincodeStubInterface, args []
 	}
 
 	//checking owner
-	owner := args[2]
+	owner := args[1]
 	if owner == "" {
-		return errors.New(fmt.Sprintf("proof Owner is invalid: %s (must be string)", args[2]))
+		return errors.New(fmt.Sprintf("proof Owner is invalid: %s (must be string)", args[1]))
 	}
 	entity.Value.Owner = owner
 
+	//checking issuer
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromCompositeKeyParts([]string{args[3]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	if !ExistsIn(stub, &issuerKey, issuerKeyIndex) {
+		compositeKey, _ := issuerKey.ToCompositeKey(stub)
+		return errors.New(fmt.Sprintf("issuer key with the key %s doesn't exist", compositeKey))
+	}
+	entity.Value.IssuerID = issuerKey.Key.ID
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -155,110 +175,162 @@ func (entity *Proof) ToLedgerValue() ([]byte, error) {
 	return json.Marshal(entity.Value)
 }
 
-func (entity *Proof) GenerateIdemixCrypto(jsonData string) error {
-	// making arrays of attributes names and values
-	rng, err := idemix.GetRand()
+// FillFromSubmission takes a proof built on the client side; no randomness
+// or secret attributes are handled by the chaincode
+func (entity *Proof) FillFromSubmission(jsonData string) error {
+	submission := struct {
+		SnapShot            *idemix.Signature           `json:"snapShot"`
+		DataForVerification ProofDataForVerification    `json:"dataForVerification"`
+		PredicateProofs     []rangeproof.PredicateProof `json:"predicateProofs"`
+	}{}
+
+	if err := json.Unmarshal([]byte(jsonData), &submission); err != nil {
+		return errors.New(fmt.Sprintf("input json is invalid: %s", err.Error()))
+	}
 
-	var attributesArray []AttributeData
-	err = json.Unmarshal([]byte(jsonData), &attributesArray)
-	if err != nil {
-		message := fmt.Sprintf("Input json is invalid. Error \"%s\"", err.Error())
-		Logger.Error(message)
-		return errors.New(message)
+	if submission.SnapShot == nil || submission.SnapShot.NonRevocationProof == nil {
+		return errors.New(fmt.Sprintf("proof signature is missing"))
+	}
+
+	// the signed message binds the proof to its ID, so it cannot be replayed
+	if string(submission.DataForVerification.Msg) != entity.Key.ID {
+		return errors.New(fmt.Sprintf("proof must sign its ID %s", entity.Key.ID))
+	}
+
+	if len(submission.DataForVerification.RevocationHandle) == 0 {
+		return errors.New(fmt.Sprintf("revocation handle is missing"))
+	}
+
+	entity.Value.Type = proofTypeSelectiveDisclosure
+	if len(submission.PredicateProofs) != 0 {
+		entity.Value.Type = proofTypePredicate
 	}
 
-	AttributeNames := make([]string, len(attributesArray))
-	attrs := make([]*FP256BN.BIG, len(AttributeNames))
-	disclosure := make([]byte, len(attributesArray))
-	msg := make([]byte, len(attributesArray))
-	attributeValues := make([]string, len(attributesArray))
-	var rhindex int
-
-	for i := range attributesArray {
-		h := sha256.New()
-		// make hash from value of attribute
-		h.Write([]byte(attributesArray[i].AttributeValue))
-		attrs[i] = FP256BN.FromBytes(h.Sum(nil))
-		AttributeNames[i] = attributesArray[i].AttributeName
-		disclosure[i] = attributesArray[i].AttributeDisclosure
-		msg[i] = byte(i)
-		if attributesArray[i].AttributeDisclosure == 0 {
-			rhindex = i
-			// fill hidden field random value
-			attrs[i] = FP256BN.NewBIGint(rand.Intn(10000))
-		} else {
-			attributeValues[i] = attributesArray[i].AttributeValue
+	for _, predicateProof := range submission.PredicateProofs {
+		if err := predicateProof.Predicate.Check(); err != nil {
+			return errors.New(fmt.Sprintf("predicate proof is invalid: %s", err.Error()))
 		}
 	}
 
-	// check Disclosure[rhIndex] == 0
-	if attributesArray[rhindex].AttributeDisclosure != 0 {
-		message := fmt.Sprintf("Idemix requires the revocation handle to remain undisclosed (i.e., Disclosure[rhIndex] == 0). But we have \"%d\"", attributesArray[rhindex].AttributeDisclosure)
-		Logger.Error(message)
-		return errors.New(message)
+	entity.Value.SnapShot = submission.SnapShot
+	entity.Value.DataForVerification = submission.DataForVerification
+	entity.Value.PredicateProofs = submission.PredicateProofs
+	entity.Value.RevocationHandle = revocationHandle(submission.DataForVerification.RevocationHandle)
+
+	return nil
+}
+
+// Verify checks the proof against the registered issuer public key and the
+// current epoch of the revocation authority
+func (entity *Proof) Verify(stub shim.ChaincodeStubInterface, ipk *idemix.IssuerPublicKey, revocationAuthority *RevocationAuthority) (err error) {
+	// idemix panics on malformed points and proofs submitted by the client
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("proof is malformed: %v", r))
+		}
+	}()
+
+	data := entity.Value.DataForVerification
+
+	handleIndex := len(ipk.AttributeNames) - 1
+	if handleIndex < 0 || ipk.AttributeNames[handleIndex] != revocationHandleAttribute {
+		return errors.New(fmt.Sprintf("issuer key must end with the \"%s\" attribute", revocationHandleAttribute))
 	}
 
-	// create a new key pair
-	key, err := idemix.NewIssuerKey(AttributeNames, rng)
-	if err != nil {
-		message := fmt.Sprintf("Issuer key generation should have succeeded but gave error \"%s\"", err.Error())
-		Logger.Error(message)
-		return errors.New(message)
+	if len(data.Disclosure) != len(ipk.AttributeNames) || len(data.AttributeValues) != len(ipk.AttributeNames) {
+		return errors.New(fmt.Sprintf("proof must contain %d attributes", len(ipk.AttributeNames)))
 	}
 
-	// check that the key is valid
-	err = key.GetIpk().Check()
-	if err != nil {
-		message := fmt.Sprintf("Issuer public key should be valid")
-		Logger.Error(message)
-		return errors.New(message)
+	// idemix expects its revocation handle index to point to a hidden attribute
+	if data.RhIndex < 0 || data.RhIndex >= handleIndex || data.Disclosure[data.RhIndex] != 0 {
+		return errors.New(fmt.Sprintf("attribute %d must remain hidden", data.RhIndex))
 	}
 
-	// issuance
-	sk := idemix.RandModOrder(rng)
-	ni := idemix.RandModOrder(rng)
-	m := idemix.NewCredRequest(sk, idemix.BigToBytes(ni), key.Ipk, rng)
+	if data.Disclosure[handleIndex] != 1 {
+		return errors.New(fmt.Sprintf("revocation handle must be disclosed"))
+	}
 
-	cred, err := idemix.NewCredential(key, m, attrs, rng)
+	attributeValues := make([]*FP256BN.BIG, len(ipk.AttributeNames))
+	for i := range attributeValues {
+		if data.Disclosure[i] == 1 {
+			attributeValues[i] = hashAttribute(data.AttributeValues[i])
+		}
+	}
+	attributeValues[handleIndex] = FP256BN.FromBytes(data.RevocationHandle)
 
-	// generate a revocation key pair
-	revocationKey, err := idemix.GenerateLongTermRevocationKey()
+	if err := revocationAuthority.VerifyEpoch(entity.Value.SnapShot); err != nil {
+		return errors.New(fmt.Sprintf("proof is not valid in the current epoch: %s", err.Error()))
+	}
 
-	// create CRI that contains no revocation mechanism
-	epoch := 0
-	cri, err := idemix.CreateCRI(revocationKey, []*FP256BN.BIG{}, epoch, idemix.ALG_NO_REVOCATION, rng)
-	if err != nil {
-		message := fmt.Sprintf("Create CRI return error: %s", err.Error())
-		Logger.Error(message)
-		return errors.New(message)
+	if revocationAuthority.IsRevoked(stub, entity.Value.RevocationHandle) {
+		return errors.New(fmt.Sprintf("credential of proof %s is revoked", entity.Key.ID))
 	}
 
-	// signing selective disclosure
-	Nym, RandNym := idemix.MakeNym(sk, key.Ipk, rng)
-	sig, err := idemix.NewSignature(cred, sk, Nym, RandNym, key.Ipk, disclosure, msg, rhindex, cri, rng)
+	revocationPublicKey, err := parseRevocationPublicKey(revocationAuthority.Value.PublicKey)
 	if err != nil {
-		message := fmt.Sprintf("Idemix NewSignature return error: %s", err.Error())
-		Logger.Error(message)
-		return errors.New(message)
+		return err
 	}
 
-	attributeValuesBytes := make([][]byte, len(attrs))
-	for i := 0; i < len(attrs); i++ {
-		row := make([]byte, FP256BN.MODBYTES)
-		attributeValue := attrs[i]
-		attributeValue.ToBytes(row)
-		attributeValuesBytes[i] = row
+	if err := entity.Value.SnapShot.Ver(data.Disclosure, ipk, data.Msg, attributeValues, data.RhIndex, revocationPublicKey, revocationAuthority.Value.Epoch); err != nil {
+		return err
 	}
 
-	entity.Value.SnapShot = sig
-	entity.Value.DataForVerification.Disclosure = disclosure
-	entity.Value.DataForVerification.Ipk = key.Ipk
-	entity.Value.DataForVerification.Msg = msg
-	entity.Value.DataForVerification.AttributeValuesHash = attributeValuesBytes
-	entity.Value.DataForVerification.AttributeValues = attributeValues
-	entity.Value.DataForVerification.RhIndex = rhindex
-	entity.Value.DataForVerification.RevPk = encode(&revocationKey.PublicKey)
-	entity.Value.DataForVerification.Epoch = epoch
+	// a predicate is proven over the commitment certified as a disclosed attribute
+	for _, predicateProof := range entity.Value.PredicateProofs {
+		index := attributeIndex(ipk, predicateProof.Predicate.Attribute)
+		if index < 0 || index == handleIndex {
+			return errors.New(fmt.Sprintf("issuer key has no attribute \"%s\"", predicateProof.Predicate.Attribute))
+		}
+
+		if data.Disclosure[index] != 1 || data.AttributeValues[index] != rangeproof.CommitmentString(predicateProof.Commitment) {
+			return errors.New(fmt.Sprintf("commitment to \"%s\" must be disclosed", predicateProof.Predicate.Attribute))
+		}
+
+		if err := predicateProof.Verify(data.Msg); err != nil {
+			return errors.New(fmt.Sprintf("predicate %s %s %d is not proven: %s", predicateProof.Predicate.Attribute,
+				predicateProof.Predicate.Operator, predicateProof.Predicate.Bound, err.Error()))
+		}
+	}
 
 	return nil
 }
+
+// Satisfies reports the first of the required predicates the proof doesn't prove
+func (entity *Proof) Satisfies(required []rangeproof.Predicate) (rangeproof.Predicate, bool) {
+	for _, predicate := range required {
+		proven := false
+		for _, predicateProof := range entity.Value.PredicateProofs {
+			if predicateProof.Predicate.Implies(predicate) {
+				proven = true
+				break
+			}
+		}
+
+		if !proven {
+			return predicate, false
+		}
+	}
+
+	return rangeproof.Predicate{}, true
+}
+
+func attributeIndex(ipk *idemix.IssuerPublicKey, name string) int {
+	for i, attributeName := range ipk.AttributeNames {
+		if attributeName == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// hashAttribute maps an attribute value to the group order as the proof builder does
+func hashAttribute(value string) *FP256BN.BIG {
+	h := sha256.Sum256([]byte(value))
+	return FP256BN.FromBytes(h[:])
+}
+
+// revocationHandle returns the hash of the disclosed handle which is kept on the ledger
+func revocationHandle(handle []byte) string {
+	return hex.EncodeToString(idemix.BigToBytes(idemix.HashModOrder(idemix.BigToBytes(FP256BN.FromBytes(handle)))))
+}
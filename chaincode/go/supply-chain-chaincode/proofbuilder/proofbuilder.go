@@ -0,0 +1,220 @@
+// Package proofbuilder builds Idemix proofs on the client side, so that secret
+// attributes and randomness never reach the supply chain chaincode. The
+// chaincode only accepts a built proof and verifies it against the registered
+// issuer public key and the current CRI of the revocation authority.
+package proofbuilder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric-amcl/amcl/FP256BN"
+	"github.com/hyperledger/fabric/idemix"
+	"supply-chain-chaincode/rangeproof"
+)
+
+// RevocationHandleAttribute is the name of the last attribute of every issuer key;
+// its value is a random handle the revocation authority uses to revoke the credential
+const RevocationHandleAttribute = "revocationHandle"
+
+// Attribute is a plain attribute value and the decision to disclose it in a proof
+type Attribute struct {
+	Name      string `json:"attributeName"`
+	Value     string `json:"attributeValue"`
+	Disclosed bool   `json:"attributeDisclosed"`
+}
+
+// Credential is kept by the holder and never sent to the chaincode
+type Credential struct {
+	Cred *idemix.Credential `json:"cred"`
+	Sk   []byte             `json:"sk"`
+}
+
+// Proof is the payload accepted by generateProof and updateProof
+type Proof struct {
+	SnapShot            *idemix.Signature           `json:"snapShot"`
+	DataForVerification DataForVerification         `json:"dataForVerification"`
+	PredicateProofs     []rangeproof.PredicateProof `json:"predicateProofs"`
+}
+
+type DataForVerification struct {
+	Disclosure       []byte   `json:"disclosure"`
+	Msg              []byte   `json:"msg"`
+	AttributeValues  []string `json:"attributeValues"`
+	RhIndex          int      `json:"rhIndex"`
+	RevocationHandle []byte   `json:"revocationHandle"`
+	Epoch            int      `json:"epoch"`
+}
+
+// HashAttribute maps an attribute value to the group order, the same way the chaincode does
+func HashAttribute(value string) *FP256BN.BIG {
+	h := sha256.Sum256([]byte(value))
+	return FP256BN.FromBytes(h[:])
+}
+
+// NewIssuerKey creates the key pair of an issuer; the public key is registered
+// with registerIssuerKey and the secret key stays with the issuer
+func NewIssuerKey(attributeNames []string) (*idemix.IssuerKey, error) {
+	if len(attributeNames) == 0 {
+		return nil, errors.New("at least one attribute name is required")
+	}
+
+	for _, name := range attributeNames {
+		if name == RevocationHandleAttribute {
+			return nil, errors.New(fmt.Sprintf("attribute name \"%s\" is reserved", RevocationHandleAttribute))
+		}
+	}
+
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, err
+	}
+
+	names := append(append([]string{}, attributeNames...), RevocationHandleAttribute)
+
+	return idemix.NewIssuerKey(names, rng)
+}
+
+// NewCredentialRequest is run by the holder; the secret key must be kept
+// to build proofs with the issued credential
+func NewCredentialRequest(ipk *idemix.IssuerPublicKey, issuerNonce []byte) ([]byte, *idemix.CredRequest, error) {
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sk := idemix.RandModOrder(rng)
+
+	return idemix.BigToBytes(sk), idemix.NewCredRequest(sk, issuerNonce, ipk, rng), nil
+}
+
+// IssueCredential is run by the issuer; values follow the attribute names of the key
+// without the revocation handle, which is drawn here
+func IssueCredential(key *idemix.IssuerKey, request *idemix.CredRequest, values []string) (*idemix.Credential, error) {
+	if len(values)+1 != len(key.Ipk.AttributeNames) {
+		return nil, errors.New(fmt.Sprintf("issuer key expects %d attribute values, got %d", len(key.Ipk.AttributeNames)-1, len(values)))
+	}
+
+	if err := request.Check(key.Ipk); err != nil {
+		return nil, errors.New(fmt.Sprintf("credential request is invalid: %s", err.Error()))
+	}
+
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]*FP256BN.BIG, len(key.Ipk.AttributeNames))
+	for i, value := range values {
+		attrs[i] = HashAttribute(value)
+	}
+	attrs[len(values)] = idemix.RandModOrder(rng)
+
+	return idemix.NewCredential(key, request, attrs, rng)
+}
+
+// BuildProof signs msg with the credential, disclosing only the attributes marked
+// as disclosed; msg is expected to be the ID of the proof on the ledger
+func BuildProof(ipk *idemix.IssuerPublicKey, credential *Credential, attributes []Attribute, cri *idemix.CredentialRevocationInformation, msg []byte) (*Proof, error) {
+	handleIndex := len(ipk.AttributeNames) - 1
+	if handleIndex < 0 || ipk.AttributeNames[handleIndex] != RevocationHandleAttribute {
+		return nil, errors.New(fmt.Sprintf("issuer key must end with the \"%s\" attribute", RevocationHandleAttribute))
+	}
+
+	if len(attributes) != handleIndex {
+		return nil, errors.New(fmt.Sprintf("issuer key expects %d attributes, got %d", handleIndex, len(attributes)))
+	}
+
+	sk := FP256BN.FromBytes(credential.Sk)
+	if err := credential.Cred.Ver(sk, ipk); err != nil {
+		return nil, errors.New(fmt.Sprintf("credential is invalid: %s", err.Error()))
+	}
+
+	disclosure := make([]byte, len(ipk.AttributeNames))
+	attributeValues := make([]string, len(ipk.AttributeNames))
+	rhIndex := -1
+	for i, attribute := range attributes {
+		if attribute.Name != ipk.AttributeNames[i] {
+			return nil, errors.New(fmt.Sprintf("attribute %d must be \"%s\", got \"%s\"", i, ipk.AttributeNames[i], attribute.Name))
+		}
+
+		if !attribute.Disclosed {
+			if rhIndex < 0 {
+				rhIndex = i
+			}
+			continue
+		}
+
+		// a disclosed value must be the one certified by the issuer
+		if !bytes.Equal(idemix.BigToBytes(HashAttribute(attribute.Value)), credential.Cred.Attrs[i]) {
+			return nil, errors.New(fmt.Sprintf("value of attribute \"%s\" differs from the credential", attribute.Name))
+		}
+
+		disclosure[i] = 1
+		attributeValues[i] = attribute.Value
+	}
+
+	// idemix requires its revocation handle index to point to a hidden attribute;
+	// without a revocation algorithm it is not used otherwise
+	if rhIndex < 0 {
+		return nil, errors.New("at least one attribute must remain hidden")
+	}
+
+	// the revocation handle is disclosed, which binds it to the proof
+	disclosure[handleIndex] = 1
+
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, err
+	}
+
+	nym, randNym := idemix.MakeNym(sk, ipk, rng)
+	sig, err := idemix.NewSignature(credential.Cred, sk, nym, randNym, ipk, disclosure, msg, rhIndex, cri, rng)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot sign the proof: %s", err.Error()))
+	}
+
+	proof := &Proof{SnapShot: sig}
+	proof.DataForVerification.Disclosure = disclosure
+	proof.DataForVerification.Msg = msg
+	proof.DataForVerification.AttributeValues = attributeValues
+	proof.DataForVerification.RhIndex = rhIndex
+	proof.DataForVerification.RevocationHandle = credential.Cred.Attrs[handleIndex]
+	proof.DataForVerification.Epoch = int(cri.Epoch)
+
+	return proof, nil
+}
+
+// AddPredicate proves a predicate over an attribute certified as a commitment,
+// see rangeproof.Commit; the commitment must be disclosed by the proof while
+// value and blinding stay with the holder
+func (proof *Proof) AddPredicate(ipk *idemix.IssuerPublicKey, predicate rangeproof.Predicate, value uint64, blinding []byte) error {
+	index := -1
+	for i, name := range ipk.AttributeNames {
+		if name == predicate.Attribute && name != RevocationHandleAttribute {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return errors.New(fmt.Sprintf("issuer key has no attribute \"%s\"", predicate.Attribute))
+	}
+
+	if proof.DataForVerification.Disclosure[index] != 1 {
+		return errors.New(fmt.Sprintf("commitment to \"%s\" must be disclosed", predicate.Attribute))
+	}
+
+	predicateProof, err := rangeproof.Prove(predicate, value, blinding, proof.DataForVerification.Msg)
+	if err != nil {
+		return err
+	}
+
+	if rangeproof.CommitmentString(predicateProof.Commitment) != proof.DataForVerification.AttributeValues[index] {
+		return errors.New(fmt.Sprintf("value and blinding don't open the commitment to \"%s\"", predicate.Attribute))
+	}
+
+	proof.PredicateProofs = append(proof.PredicateProofs, *predicateProof)
+
+	return nil
+}
@@ -0,0 +1,347 @@
+// Package rangeproof proves predicates such as "value >= bound" over a
+// Pedersen commitment without revealing the committed value. The value is
+// split into bits, each bit commitment carries an OR-proof that it opens
+// to 0 or 1, and the weighted sum of bit commitments must equal the
+// commitment shifted by the bound.
+//
+// The commitment is certified by an Idemix issuer as a disclosed attribute,
+// so a predicate proof is only as trustworthy as the credential carrying it.
+// It is shared by the chaincode verifier and the client side proof builder.
+package rangeproof
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric-amcl/amcl"
+	"github.com/hyperledger/fabric-amcl/amcl/FP256BN"
+	"github.com/hyperledger/fabric/idemix"
+)
+
+// Bits is the width of proven ranges: value - bound must lie in [0, 2^Bits)
+const Bits = 64
+
+// predicate operators
+const (
+	OperatorAtLeast = ">="
+	OperatorAtMost  = "<="
+)
+
+var allowedOperators = map[string]bool{
+	OperatorAtLeast: true,
+	OperatorAtMost:  true,
+}
+
+// g is the generator of G1 and h a second generator nobody knows the discrete logarithm of
+var (
+	g = idemix.GenG1
+	h = hashToPoint("supply-chain-chaincode/rangeproof/h")
+)
+
+// Predicate is a condition over a committed attribute; a range is expressed as two predicates
+type Predicate struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator"`
+	Bound     uint64 `json:"bound"`
+}
+
+type BitProof struct {
+	Commitment *idemix.ECP `json:"commitment"`
+	C0         []byte      `json:"c0"`
+	C1         []byte      `json:"c1"`
+	Z0         []byte      `json:"z0"`
+	Z1         []byte      `json:"z1"`
+}
+
+type PredicateProof struct {
+	Predicate  Predicate   `json:"predicate"`
+	Commitment *idemix.ECP `json:"commitment"`
+	Bits       []BitProof  `json:"bits"`
+}
+
+func (predicate Predicate) Check() error {
+	if predicate.Attribute == "" {
+		return errors.New("predicate attribute must be not empty")
+	}
+
+	if !allowedOperators[predicate.Operator] {
+		return errors.New(fmt.Sprintf("unacceptable predicate operator \"%s\"", predicate.Operator))
+	}
+
+	return nil
+}
+
+// Implies reports whether a proof of predicate also proves required
+func (predicate Predicate) Implies(required Predicate) bool {
+	if predicate.Attribute != required.Attribute || predicate.Operator != required.Operator {
+		return false
+	}
+
+	if predicate.Operator == OperatorAtLeast {
+		return predicate.Bound >= required.Bound
+	}
+
+	return predicate.Bound <= required.Bound
+}
+
+// Holds reports whether value satisfies the predicate
+func (predicate Predicate) Holds(value uint64) bool {
+	if predicate.Operator == OperatorAtLeast {
+		return value >= predicate.Bound
+	}
+
+	return value <= predicate.Bound
+}
+
+// Commit returns the commitment to value, its string form certified as an
+// attribute value by the issuer, and the blinding factor kept by the holder
+func Commit(value uint64) (*idemix.ECP, string, []byte, error) {
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	r := idemix.RandModOrder(rng)
+	commitment := idemix.EcpToProto(commit(bigFromUint64(value), r))
+
+	return commitment, CommitmentString(commitment), idemix.BigToBytes(r), nil
+}
+
+// CommitmentString is the attribute value certifying a commitment
+func CommitmentString(commitment *idemix.ECP) string {
+	return hex.EncodeToString(commitment.GetX()) + hex.EncodeToString(commitment.GetY())
+}
+
+// Prove builds a proof that the value committed with blinding satisfies the
+// predicate; ctx binds the proof to its use, e.g. the proof ID
+func Prove(predicate Predicate, value uint64, blinding []byte, ctx []byte) (*PredicateProof, error) {
+	if err := predicate.Check(); err != nil {
+		return nil, err
+	}
+
+	if !predicate.Holds(value) {
+		return nil, errors.New(fmt.Sprintf("value doesn't satisfy %s %s %d", predicate.Attribute, predicate.Operator, predicate.Bound))
+	}
+
+	rng, err := idemix.GetRand()
+	if err != nil {
+		return nil, err
+	}
+
+	r := FP256BN.FromBytes(blinding)
+	commitment := commit(bigFromUint64(value), r)
+
+	// the shifted commitment opens to the non-negative difference
+	difference := value - predicate.Bound
+	shiftedBlinding := r
+	if predicate.Operator == OperatorAtMost {
+		difference = predicate.Bound - value
+		shiftedBlinding = FP256BN.Modneg(r, idemix.GroupOrder)
+	}
+
+	proof := &PredicateProof{
+		Predicate:  predicate,
+		Commitment: idemix.EcpToProto(commitment),
+		Bits:       make([]BitProof, Bits),
+	}
+
+	// blinding factors of the bits must add up to the shifted blinding
+	blindings := make([]*FP256BN.BIG, Bits)
+	sum := FP256BN.NewBIGint(0)
+	for i := 1; i < Bits; i++ {
+		blindings[i] = idemix.RandModOrder(rng)
+		sum = idemix.Modadd(sum, FP256BN.Modmul(blindings[i], powerOfTwo(i), idemix.GroupOrder), idemix.GroupOrder)
+	}
+	blindings[0] = idemix.Modsub(shiftedBlinding, sum, idemix.GroupOrder)
+
+	for i := 0; i < Bits; i++ {
+		bit := int((difference >> uint(i)) & 1)
+		proof.Bits[i] = proveBit(bit, blindings[i], bitContext(ctx, predicate, i), rng)
+	}
+
+	return proof, nil
+}
+
+// Verify checks the proof; ctx must be the one the proof was built with
+func (proof *PredicateProof) Verify(ctx []byte) error {
+	if err := proof.Predicate.Check(); err != nil {
+		return err
+	}
+
+	if len(proof.Bits) != Bits {
+		return errors.New(fmt.Sprintf("predicate proof must contain %d bits, got %d", Bits, len(proof.Bits)))
+	}
+
+	commitment, err := ecpFromProto(proof.Commitment)
+	if err != nil {
+		return err
+	}
+
+	// shifting the commitment so it opens to the non-negative difference
+	shifted := FP256BN.NewECP()
+	if proof.Predicate.Operator == OperatorAtLeast {
+		shifted.Copy(commitment)
+		shifted.Sub(g.Mul(bigFromUint64(proof.Predicate.Bound)))
+	} else {
+		shifted.Copy(g.Mul(bigFromUint64(proof.Predicate.Bound)))
+		shifted.Sub(commitment)
+	}
+
+	sum := FP256BN.NewECP()
+	for i, bitProof := range proof.Bits {
+		bitCommitment, err := verifyBit(bitProof, bitContext(ctx, proof.Predicate, i))
+		if err != nil {
+			return errors.New(fmt.Sprintf("bit %d: %s", i, err.Error()))
+		}
+		sum.Add(bitCommitment.Mul(powerOfTwo(i)))
+	}
+
+	if !sum.Equals(shifted) {
+		return errors.New(fmt.Sprintf("bit commitments don't add up to the commitment"))
+	}
+
+	return nil
+}
+
+// proveBit proves that g^bit * h^r opens to 0 or 1 by a Fiat-Shamir OR-proof
+// of knowledge of log_h(C) or log_h(C/g)
+func proveBit(bit int, r *FP256BN.BIG, ctx []byte, rng *amcl.RAND) BitProof {
+	commitment := commit(FP256BN.NewBIGint(bit), r)
+	statements := bitStatements(commitment)
+
+	c := make([]*FP256BN.BIG, 2)
+	z := make([]*FP256BN.BIG, 2)
+	a := make([]*FP256BN.ECP, 2)
+
+	// simulating the branch of the other bit value
+	other := 1 - bit
+	c[other] = idemix.RandModOrder(rng)
+	z[other] = idemix.RandModOrder(rng)
+	a[other] = h.Mul(z[other])
+	a[other].Sub(statements[other].Mul(c[other]))
+
+	k := idemix.RandModOrder(rng)
+	a[bit] = h.Mul(k)
+
+	challenge := bitChallenge(ctx, commitment, a[0], a[1])
+	c[bit] = idemix.Modsub(challenge, c[other], idemix.GroupOrder)
+	z[bit] = idemix.Modadd(k, FP256BN.Modmul(c[bit], r, idemix.GroupOrder), idemix.GroupOrder)
+
+	return BitProof{
+		Commitment: idemix.EcpToProto(commitment),
+		C0:         idemix.BigToBytes(c[0]),
+		C1:         idemix.BigToBytes(c[1]),
+		Z0:         idemix.BigToBytes(z[0]),
+		Z1:         idemix.BigToBytes(z[1]),
+	}
+}
+
+func verifyBit(proof BitProof, ctx []byte) (*FP256BN.ECP, error) {
+	commitment, err := ecpFromProto(proof.Commitment)
+	if err != nil {
+		return nil, err
+	}
+
+	scalars := [][]byte{proof.C0, proof.C1, proof.Z0, proof.Z1}
+	for _, scalar := range scalars {
+		if len(scalar) != idemix.FieldBytes {
+			return nil, errors.New(fmt.Sprintf("scalar must be %d bytes long", idemix.FieldBytes))
+		}
+	}
+
+	statements := bitStatements(commitment)
+	c := []*FP256BN.BIG{scalarFromBytes(proof.C0), scalarFromBytes(proof.C1)}
+	z := []*FP256BN.BIG{scalarFromBytes(proof.Z0), scalarFromBytes(proof.Z1)}
+
+	a := make([]*FP256BN.ECP, 2)
+	for j := range a {
+		a[j] = h.Mul(z[j])
+		a[j].Sub(statements[j].Mul(c[j]))
+	}
+
+	challenge := bitChallenge(ctx, commitment, a[0], a[1])
+	if !bigEquals(idemix.Modadd(c[0], c[1], idemix.GroupOrder), challenge) {
+		return nil, errors.New("bit proof is invalid")
+	}
+
+	return commitment, nil
+}
+
+// bitStatements returns C and C/g, one of which is a power of h
+func bitStatements(commitment *FP256BN.ECP) []*FP256BN.ECP {
+	one := FP256BN.NewECP()
+	one.Copy(commitment)
+	one.Sub(g)
+
+	return []*FP256BN.ECP{commitment, one}
+}
+
+func bitChallenge(ctx []byte, commitment, a0, a1 *FP256BN.ECP) *FP256BN.BIG {
+	data := append([]byte{}, ctx...)
+	data = append(data, idemix.EcpToBytes(commitment)...)
+	data = append(data, idemix.EcpToBytes(a0)...)
+	data = append(data, idemix.EcpToBytes(a1)...)
+
+	return idemix.HashModOrder(data)
+}
+
+func bitContext(ctx []byte, predicate Predicate, i int) []byte {
+	data := append([]byte{}, ctx...)
+	data = append(data, []byte(predicate.Attribute+predicate.Operator)...)
+
+	buffer := make([]byte, 16)
+	binary.BigEndian.PutUint64(buffer, predicate.Bound)
+	binary.BigEndian.PutUint64(buffer[8:], uint64(i))
+
+	return append(data, buffer...)
+}
+
+func commit(value *FP256BN.BIG, r *FP256BN.BIG) *FP256BN.ECP {
+	return g.Mul2(value, h, r)
+}
+
+func hashToPoint(label string) *FP256BN.ECP {
+	digest := sha256.Sum256([]byte(label))
+	return FP256BN.ECP_mapit(digest[:])
+}
+
+func ecpFromProto(point *idemix.ECP) (*FP256BN.ECP, error) {
+	if point == nil || len(point.GetX()) != idemix.FieldBytes || len(point.GetY()) != idemix.FieldBytes {
+		return nil, errors.New("commitment is malformed")
+	}
+
+	result := idemix.EcpFromProto(point)
+	if result.Is_infinity() {
+		return nil, errors.New("commitment is not a point of the curve")
+	}
+
+	return result, nil
+}
+
+func bigFromUint64(value uint64) *FP256BN.BIG {
+	buffer := make([]byte, idemix.FieldBytes)
+	binary.BigEndian.PutUint64(buffer[idemix.FieldBytes-8:], value)
+
+	return FP256BN.FromBytes(buffer)
+}
+
+func powerOfTwo(i int) *FP256BN.BIG {
+	buffer := make([]byte, idemix.FieldBytes)
+	buffer[idemix.FieldBytes-1-i/8] = 1 << uint(i%8)
+
+	return FP256BN.FromBytes(buffer)
+}
+
+func scalarFromBytes(data []byte) *FP256BN.BIG {
+	scalar := FP256BN.FromBytes(data)
+	scalar.Mod(idemix.GroupOrder)
+
+	return scalar
+}
+
+func bigEquals(a, b *FP256BN.BIG) bool {
+	return bytes.Equal(idemix.BigToBytes(a), idemix.BigToBytes(b))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Kinds of the mismatches between a contract and its invoice
+const (
+	mismatchMissingInvoice     = "MISSING_INVOICE"
+	mismatchInvoiceUnavailable = "INVOICE_UNAVAILABLE"
+	mismatchAmountDrift        = "AMOUNT_DRIFT"
+	mismatchParties            = "PARTY_MISMATCH"
+	mismatchPaymentDate        = "PAYMENT_DATE_MISMATCH"
+	mismatchGuarantor          = "GUARANTOR_MISMATCH"
+	mismatchStateDivergence    = "STATE_DIVERGENCE"
+)
+
+// Amounts of a contract and its invoice closer than this agree, they pass through float32 and text
+const reconciliationAmountTolerance = 0.01
+
+// States an invoice may be in for each state of its contract: the invoice is registered
+// on acceptOrder and accepted on confirmDelivery
+var reconciledInvoiceStates = map[int][]int{
+	stateContractSigned:    {stateInvoiceIssued},
+	stateContractProcessed: {stateInvoiceIssued},
+	stateContractCompleted: {stateInvoiceSigned, stateInvoiceForSale, stateInvoiceSold},
+}
+
+// ReconciliationMismatch is a disagreement of a contract and its invoice on a field
+type ReconciliationMismatch struct {
+	ContractID    string `json:"contractID"`
+	Kind          string `json:"kind"`
+	Field         string `json:"field,omitempty"`
+	ContractValue string `json:"contractValue,omitempty"`
+	InvoiceValue  string `json:"invoiceValue,omitempty"`
+}
+
+// ReconciliationReport is the result of reconcileContracts, the mismatches are ordered by contract
+type ReconciliationReport struct {
+	TxID       string                   `json:"txID"`
+	Timestamp  int64                    `json:"timestamp"`
+	Contracts  int                      `json:"contracts"`
+	Reconciled int                      `json:"reconciled"`
+	Totals     map[string]int           `json:"totals"`
+	Mismatches []ReconciliationMismatch `json:"mismatches"`
+}
+
+// ReconcileContracts looks up the invoice of every contract in the trade-finance chaincode
+// and reports where the two disagree
+func ReconcileContracts(stub shim.ChaincodeStubInterface, contracts []Contract) (ReconciliationReport, error) {
+	report := ReconciliationReport{
+		TxID:       stub.GetTxID(),
+		Contracts:  len(contracts),
+		Totals:     make(map[string]int),
+		Mismatches: []ReconciliationMismatch{},
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return report, err
+	}
+	report.Timestamp = timestamp.Seconds
+
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].Key.ID < contracts[j].Key.ID
+	})
+
+	for _, contract := range contracts {
+		var mismatches []ReconciliationMismatch
+
+		invoice, err := loadInvoice(stub, contract.Key.ID)
+		if err != nil {
+			kind := mismatchInvoiceUnavailable
+			if bridgeError, ok := err.(*BridgeError); ok && bridgeError.Code == bridgeErrorNotFound {
+				kind = mismatchMissingInvoice
+			}
+			mismatches = []ReconciliationMismatch{{ContractID: contract.Key.ID, Kind: kind, InvoiceValue: err.Error()}}
+		} else {
+			mismatches = reconcileContract(contract, invoice)
+		}
+
+		if len(mismatches) == 0 {
+			report.Reconciled++
+		}
+
+		for _, mismatch := range mismatches {
+			report.Totals[mismatch.Kind]++
+		}
+		report.Mismatches = append(report.Mismatches, mismatches...)
+	}
+
+	return report, nil
+}
+
+// reconcileContract compares the contract with its invoice field by field
+func reconcileContract(contract Contract, invoice Invoice) []ReconciliationMismatch {
+	mismatches := []ReconciliationMismatch{}
+
+	mismatch := func(kind, field, contractValue, invoiceValue string) {
+		mismatches = append(mismatches, ReconciliationMismatch{
+			ContractID:    contract.Key.ID,
+			Kind:          kind,
+			Field:         field,
+			ContractValue: contractValue,
+			InvoiceValue:  invoiceValue,
+		})
+	}
+
+	if math.Abs(float64(contract.Value.TotalDue-invoice.Value.TotalDue)) > reconciliationAmountTolerance {
+		mismatch(mismatchAmountDrift, "totalDue", fmt.Sprintf("%.2f", contract.Value.TotalDue), fmt.Sprintf("%.2f", invoice.Value.TotalDue))
+	}
+
+	if contract.Value.ConsigneeName != invoice.Value.Debtor {
+		mismatch(mismatchParties, "debtor", contract.Value.ConsigneeName, invoice.Value.Debtor)
+	}
+
+	if contract.Value.ConsignorName != invoice.Value.Beneficiary {
+		mismatch(mismatchParties, "beneficiary", contract.Value.ConsignorName, invoice.Value.Beneficiary)
+	}
+
+	if contract.Value.PaymentDate != invoice.Value.PaymentDate {
+		mismatch(mismatchPaymentDate, "paymentDate", strconv.FormatInt(contract.Value.PaymentDate, 10), strconv.FormatInt(invoice.Value.PaymentDate, 10))
+	}
+
+	if contract.Value.Guarantor != invoice.Value.Guarantor {
+		mismatch(mismatchGuarantor, "guarantor", contract.Value.Guarantor, invoice.Value.Guarantor)
+	}
+
+	expected := false
+	for _, state := range reconciledInvoiceStates[contract.Value.State] {
+		if state == invoice.Value.State {
+			expected = true
+		}
+	}
+
+	if !expected {
+		mismatch(mismatchStateDivergence, "state", strconv.Itoa(contract.Value.State), strconv.Itoa(invoice.Value.State))
+	}
+
+	return mismatches
+}
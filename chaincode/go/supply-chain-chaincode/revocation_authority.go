@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/idemix"
+)
+
+const (
+	revocationAuthorityIndex = "RevocationAuthority"
+)
+
+const (
+	revocationAuthorityKeyFieldsNumber      = 1
+	revocationAuthorityBasicArgumentsNumber = 3
+)
+
+// revocation algorithms supported by the vendored idemix
+var allowedRevocationAlgorithms = map[int32]bool{
+	int32(idemix.ALG_NO_REVOCATION): true,
+}
+
+// the revocation authority is keyed by the issuer key it serves
+type RevocationAuthorityKey struct {
+	IssuerID string `json:"issuerID"`
+}
+
+// the revoked handles are those listed when the CRI of the epoch was published
+type RevocationAuthorityValue struct {
+	Owner          string       `json:"owner"`
+	PublicKey      string       `json:"publicKey"`
+	Epoch          int          `json:"epoch"`
+	EpochPk        *idemix.ECP2 `json:"epochPk"`
+	EpochPkSig     []byte       `json:"epochPkSig"`
+	RevocationAlg  int32        `json:"revocationAlg"`
+	RevokedHandles []string     `json:"revokedHandles"`
+	Timestamp      int64        `json:"timestamp"`
+	UpdatedDate    int64        `json:"updatedDate"`
+}
+
+type RevocationAuthority struct {
+	Key   RevocationAuthorityKey   `json:"key"`
+	Value RevocationAuthorityValue `json:"value"`
+}
+
+func CreateRevocationAuthority() LedgerData {
+	return new(RevocationAuthority)
+}
+
+//argument order
+//0			1			2
+//IssuerID	PublicKey	CRI
+func (entity *RevocationAuthority) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < revocationAuthorityBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", revocationAuthorityBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:revocationAuthorityKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking issuer
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromCompositeKeyParts([]string{entity.Key.IssuerID}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	if !ExistsIn(stub, &issuerKey, issuerKeyIndex) {
+		compositeKey, _ := issuerKey.ToCompositeKey(stub)
+		return errors.New(fmt.Sprintf("issuer key with the key %s doesn't exist", compositeKey))
+	}
+
+	//checking long term public key
+	if _, err := parseRevocationPublicKey(args[1]); err != nil {
+		return err
+	}
+	entity.Value.PublicKey = args[1]
+
+	//checking the first CRI
+	if err := entity.PublishCRI(args[2]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (entity *RevocationAuthority) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < revocationAuthorityKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", revocationAuthorityKeyFieldsNumber))
+	}
+
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromCompositeKeyParts(compositeKeyParts[:issuerKeyKeyFieldsNumber]); err != nil {
+		return err
+	}
+
+	entity.Key.IssuerID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *RevocationAuthority) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *RevocationAuthority) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.IssuerID,
+	}
+
+	return stub.CreateCompositeKey(revocationAuthorityIndex, compositeKeyParts)
+}
+
+func (entity *RevocationAuthority) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// PublishCRI checks a CRI signed off-chain with the long term revocation key
+// and makes it current; every new CRI must open a later epoch
+func (entity *RevocationAuthority) PublishCRI(jsonData string) error {
+	cri := &idemix.CredentialRevocationInformation{}
+	if err := json.Unmarshal([]byte(jsonData), cri); err != nil {
+		return errors.New(fmt.Sprintf("CRI is invalid: %s", err.Error()))
+	}
+
+	if !allowedRevocationAlgorithms[cri.RevocationAlg] {
+		return errors.New(fmt.Sprintf("unsupported revocation algorithm: %d", cri.RevocationAlg))
+	}
+
+	if entity.Value.EpochPk != nil && int(cri.Epoch) <= entity.Value.Epoch {
+		return errors.New(fmt.Sprintf("CRI epoch must be later than the current epoch %d, got %d", entity.Value.Epoch, cri.Epoch))
+	}
+
+	if cri.Epoch < 0 {
+		return errors.New(fmt.Sprintf("CRI epoch must be not negative"))
+	}
+
+	publicKey, err := parseRevocationPublicKey(entity.Value.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := idemix.VerifyEpochPK(publicKey, cri.EpochPk, cri.EpochPkSig, int(cri.Epoch), idemix.RevocationAlgorithm(cri.RevocationAlg)); err != nil {
+		return errors.New(fmt.Sprintf("CRI is not signed by the revocation authority: %s", err.Error()))
+	}
+
+	entity.Value.Epoch = int(cri.Epoch)
+	entity.Value.EpochPk = cri.EpochPk
+	entity.Value.EpochPkSig = cri.EpochPkSig
+	entity.Value.RevocationAlg = cri.RevocationAlg
+
+	return nil
+}
+
+// ToCRI returns the CRI of the current epoch
+func (entity *RevocationAuthority) ToCRI() *idemix.CredentialRevocationInformation {
+	return &idemix.CredentialRevocationInformation{
+		Epoch:         int64(entity.Value.Epoch),
+		EpochPk:       entity.Value.EpochPk,
+		EpochPkSig:    entity.Value.EpochPkSig,
+		RevocationAlg: entity.Value.RevocationAlg,
+	}
+}
+
+// VerifyEpoch checks that a signature was made against the CRI of the current epoch
+func (entity *RevocationAuthority) VerifyEpoch(sig *idemix.Signature) error {
+	if sig == nil {
+		return errors.New(fmt.Sprintf("signature is empty"))
+	}
+
+	if int(sig.Epoch) != entity.Value.Epoch {
+		return errors.New(fmt.Sprintf("signature was made for epoch %d, current epoch is %d", sig.Epoch, entity.Value.Epoch))
+	}
+
+	if sig.NonRevocationProof == nil || sig.NonRevocationProof.RevocationAlg != entity.Value.RevocationAlg {
+		return errors.New(fmt.Sprintf("signature doesn't use the revocation algorithm of the current epoch"))
+	}
+
+	publicKey, err := parseRevocationPublicKey(entity.Value.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	return idemix.VerifyEpochPK(publicKey, sig.RevocationEpochPk, sig.RevocationPkSig, int(sig.Epoch), idemix.RevocationAlgorithm(sig.NonRevocationProof.RevocationAlg))
+}
+
+// IsRevoked tells whether the handle was revoked, also after the CRI of the current epoch was published
+func (entity *RevocationAuthority) IsRevoked(stub shim.ChaincodeStubInterface, revocationHandle string) bool {
+	revokedHandle := RevokedHandle{Key: RevokedHandleKey{IssuerID: entity.Key.IssuerID, Handle: revocationHandle}}
+
+	return ExistsIn(stub, &revokedHandle, revokedHandleIndex)
+}
+
+func parseRevocationPublicKey(pemEncodedPub string) (*ecdsa.PublicKey, error) {
+	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
+	if blockPub == nil {
+		return nil, errors.New(fmt.Sprintf("revocation public key must be PEM encoded"))
+	}
+
+	genericPublicKey, err := x509.ParsePKIXPublicKey(blockPub.Bytes)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("revocation public key is invalid: %s", err.Error()))
+	}
+
+	publicKey, ok := genericPublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("revocation public key must be an ECDSA key"))
+	}
+
+	return publicKey, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	revokedHandleIndex = "RevokedHandle"
+)
+
+const (
+	revokedHandleKeyFieldsNumber      = 2
+	revokedHandleBasicArgumentsNumber = 2
+)
+
+// each revoked handle has its own key, so that revocations don't conflict with each other
+type RevokedHandleKey struct {
+	IssuerID string `json:"issuerID"`
+	Handle   string `json:"handle"`
+}
+
+type RevokedHandleValue struct {
+	ProofID   string `json:"proofID"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type RevokedHandle struct {
+	Key   RevokedHandleKey   `json:"key"`
+	Value RevokedHandleValue `json:"value"`
+}
+
+func CreateRevokedHandle() LedgerData {
+	return new(RevokedHandle)
+}
+
+//argument order
+//0			1
+//IssuerID	Handle
+func (entity *RevokedHandle) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < revokedHandleBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", revokedHandleBasicArgumentsNumber))
+	}
+
+	return entity.FillFromCompositeKeyParts(args[:revokedHandleKeyFieldsNumber])
+}
+
+func (entity *RevokedHandle) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < revokedHandleKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", revokedHandleKeyFieldsNumber))
+	}
+
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromCompositeKeyParts(compositeKeyParts[:issuerKeyKeyFieldsNumber]); err != nil {
+		return err
+	}
+
+	if compositeKeyParts[1] == "" {
+		return errors.New(fmt.Sprintf("revocation handle must be not empty"))
+	}
+
+	entity.Key.IssuerID = compositeKeyParts[0]
+	entity.Key.Handle = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *RevokedHandle) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *RevokedHandle) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.IssuerID,
+		entity.Key.Handle,
+	}
+
+	return stub.CreateCompositeKey(revokedHandleIndex, compositeKeyParts)
+}
+
+func (entity *RevokedHandle) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
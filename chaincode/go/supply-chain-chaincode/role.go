@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"strings"
+)
+
+const (
+	roleMemberIndex = "RoleMember"
+)
+
+const (
+	roleMemberKeyFieldsNumber      = 3
+	roleMemberBasicArgumentsNumber = 3
+)
+
+// Kinds of identities a role can be granted to
+const (
+	memberKindMSPID              = "mspid"
+	memberKindOrganizationalUnit = "ou"
+	memberKindAttribute          = "attribute"
+)
+
+type RoleMemberKey struct {
+	Role  string `json:"role"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type RoleMemberValue struct {
+	GrantedBy string `json:"grantedBy"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// RoleMember grants the role to every creator with the MSPID, the organizational
+// unit or the certificate attribute (given as name=value)
+type RoleMember struct {
+	Key   RoleMemberKey   `json:"key"`
+	Value RoleMemberValue `json:"value"`
+}
+
+func CreateRoleMember() LedgerData {
+	return new(RoleMember)
+}
+
+//argument order
+//0		1		2
+//Role	Kind	Value
+func (entity *RoleMember) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < roleMemberBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", roleMemberBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:roleMemberKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	return nil
+}
+
+func (entity *RoleMember) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < roleMemberKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", roleMemberKeyFieldsNumber))
+	}
+
+	if _, ok := defaultRoleUnits[compositeKeyParts[0]]; !ok {
+		return errors.New(fmt.Sprintf("unknown role %s", compositeKeyParts[0]))
+	}
+
+	switch compositeKeyParts[1] {
+	case memberKindMSPID, memberKindOrganizationalUnit:
+		if compositeKeyParts[2] == "" {
+			return errors.New(fmt.Sprintf("%s must be not empty", compositeKeyParts[1]))
+		}
+	case memberKindAttribute:
+		if parts := strings.SplitN(compositeKeyParts[2], "=", 2); len(parts) != 2 || parts[0] == "" {
+			return errors.New(fmt.Sprintf("attribute must be given as name=value, got \"%s\"", compositeKeyParts[2]))
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown kind of role member %s", compositeKeyParts[1]))
+	}
+
+	entity.Key.Role = compositeKeyParts[0]
+	entity.Key.Kind = compositeKeyParts[1]
+	entity.Key.Value = compositeKeyParts[2]
+
+	return nil
+}
+
+func (entity *RoleMember) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *RoleMember) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.Role,
+		entity.Key.Kind,
+		entity.Key.Value,
+	}
+
+	return stub.CreateCompositeKey(roleMemberIndex, compositeKeyParts)
+}
+
+func (entity *RoleMember) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// Save writes the member to the public state, the registry is read before any collection is known
+func (entity *RoleMember) Save(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := entity.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	value, err := entity.ToLedgerValue()
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(compositeKey, value)
+}
+
+func (entity *RoleMember) Delete(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := entity.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	return stub.DelState(compositeKey)
+}
+
+func (entity *RoleMember) Exists(stub shim.ChaincodeStubInterface) bool {
+	compositeKey, err := entity.ToCompositeKey(stub)
+	if err != nil {
+		return false
+	}
+
+	if data, err := stub.GetState(compositeKey); err != nil || data == nil {
+		return false
+	}
+
+	return true
+}
+
+// FindRoleMembers returns the members of the role, or of every role if it's empty
+func FindRoleMembers(stub shim.ChaincodeStubInterface, role string) ([]RoleMember, error) {
+	members := []RoleMember{}
+
+	keyParts := []string{}
+	if role != "" {
+		keyParts = append(keyParts, role)
+	}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(roleMemberIndex, keyParts)
+	if err != nil {
+		return members, err
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return members, err
+		}
+
+		_, compositeKeyParts, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return members, err
+		}
+
+		member := RoleMember{}
+		if err := member.FillFromCompositeKeyParts(compositeKeyParts); err != nil {
+			return members, err
+		}
+
+		if err := member.FillFromLedgerValue(response.Value); err != nil {
+			return members, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// SeedRoleMembers grants the roles to their default organizational units
+// unless the registry is already filled
+func SeedRoleMembers(stub shim.ChaincodeStubInterface) error {
+	members, err := FindRoleMembers(stub, "")
+	if err != nil {
+		return err
+	}
+
+	if len(members) != 0 {
+		return nil
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	for role, units := range defaultRoleUnits {
+		for _, unit := range units {
+			member := RoleMember{}
+			member.Key = RoleMemberKey{Role: role, Kind: memberKindOrganizationalUnit, Value: unit}
+			member.Value.Timestamp = timestamp.Seconds
+
+			if err := member.Save(stub); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the creator of the transaction is the member
+func (entity *RoleMember) Matches(stub shim.ChaincodeStubInterface, mspID string, organizationalUnit string) bool {
+	switch entity.Key.Kind {
+	case memberKindMSPID:
+		return entity.Key.Value == mspID
+	case memberKindOrganizationalUnit:
+		return entity.Key.Value == organizationalUnit
+	case memberKindAttribute:
+		parts := strings.SplitN(entity.Key.Value, "=", 2)
+		value, found, err := cid.GetAttributeValue(stub, parts[0])
+		return err == nil && found && value == parts[1]
+	}
+
+	return false
+}
+
+// HasRole reports whether the creator of the transaction holds one of the roles
+func HasRole(stub shim.ChaincodeStubInterface, roles ...string) (bool, error) {
+	organizationalUnit, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error()))
+	}
+
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error()))
+	}
+
+	for _, role := range roles {
+		members, err := FindRoleMembers(stub, role)
+		if err != nil {
+			return false, err
+		}
+
+		for _, member := range members {
+			if member.Matches(stub, mspID, organizationalUnit) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// UnitHasRole reports whether the role is granted to the organizational unit itself
+func UnitHasRole(stub shim.ChaincodeStubInterface, organizationalUnit string, roles ...string) (bool, error) {
+	for _, role := range roles {
+		member := RoleMember{}
+		member.Key = RoleMemberKey{Role: role, Kind: memberKindOrganizationalUnit, Value: organizationalUnit}
+
+		if member.Exists(stub) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"math/big"
+)
+
+const (
+	signatureIndex = "Signature"
+)
+
+const (
+	signatureKeyFieldsNumber      = 2
+	signatureBasicArgumentsNumber = 2
+)
+
+type SignatureKey struct {
+	DocumentID string `json:"documentID"`
+	Signer     string `json:"signer"`
+}
+
+type SignatureValue struct {
+	Role         string `json:"role"`
+	MSPID        string `json:"mspID"`
+	Certificate  string `json:"certificate"`
+	DocumentHash string `json:"documentHash"`
+	Signature    string `json:"signature"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+type Signature struct {
+	Key   SignatureKey   `json:"key"`
+	Value SignatureValue `json:"value"`
+}
+
+// DocumentSignatures is the signature collection of a document and whether the
+// signatures required for its type are complete
+type DocumentSignatures struct {
+	Document   Document    `json:"document"`
+	Signatures []Signature `json:"signatures"`
+	Required   []string    `json:"required"`
+	Missing    []string    `json:"missing"`
+	Complete   bool        `json:"complete"`
+}
+
+func CreateSignature() LedgerData {
+	return new(Signature)
+}
+
+//argument order
+//0				1
+//DocumentID	Signature
+func (entity *Signature) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < signatureBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", signatureBasicArgumentsNumber))
+	}
+
+	//the signer is the submitter of the transaction
+	signer, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error()))
+	}
+
+	if err := entity.FillFromCompositeKeyParts([]string{args[0], signer}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	role, err := signerRole(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's role: %s", err.Error()))
+	}
+
+	if role == "" {
+		return errors.New(fmt.Sprintf("organizational unit %s cannot sign documents", signer))
+	}
+	entity.Value.Role = role
+
+	//checking document
+	document := Document{}
+	if err := document.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	if !ExistsIn(stub, &document, documentIndex) {
+		compositeKey, _ := document.ToCompositeKey(stub)
+		return errors.New(fmt.Sprintf("document with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &document, documentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+	entity.Value.DocumentHash = document.Value.DocumentHash
+
+	//checking signature against the enrollment certificate of the submitter
+	signature, err := base64.StdEncoding.DecodeString(args[1])
+	if err != nil {
+		return errors.New(fmt.Sprintf("signature is invalid: %s (must be base64)", err.Error()))
+	}
+
+	identity, err := cid.New(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's identity: %s", err.Error()))
+	}
+
+	certificate, err := identity.GetX509Certificate()
+	if err != nil || certificate == nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's certificate"))
+	}
+
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New(fmt.Sprintf("creator's certificate must hold an ECDSA key"))
+	}
+
+	// the signature is made over the SHA-256 digest of the document hash
+	rs := struct{ R, S *big.Int }{}
+	if rest, err := asn1.Unmarshal(signature, &rs); err != nil || len(rest) != 0 || rs.R == nil || rs.S == nil {
+		return errors.New(fmt.Sprintf("signature is invalid: must be an ASN.1 encoded ECDSA signature"))
+	}
+
+	digest := sha256.Sum256([]byte(document.Value.DocumentHash))
+	if !ecdsa.Verify(publicKey, digest[:], rs.R, rs.S) {
+		return errors.New(fmt.Sprintf("signature doesn't match the document hash and the creator's certificate"))
+	}
+	entity.Value.Signature = args[1]
+	entity.Value.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error()))
+	}
+	entity.Value.MSPID = mspID
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+	entity.Value.Timestamp = timestamp.Seconds
+
+	return nil
+}
+
+func (entity *Signature) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < signatureKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", signatureKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	if compositeKeyParts[1] == "" {
+		return errors.New("signer must be not empty")
+	}
+
+	entity.Key.DocumentID = compositeKeyParts[0]
+	entity.Key.Signer = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *Signature) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Signature) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.DocumentID,
+		entity.Key.Signer,
+	}
+
+	return stub.CreateCompositeKey(signatureIndex, compositeKeyParts)
+}
+
+func (entity *Signature) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// signerRole returns the role the creator signs documents in
+func signerRole(stub shim.ChaincodeStubInterface) (string, error) {
+	for _, role := range signerRoles {
+		ok, err := HasRole(stub, role)
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			return role, nil
+		}
+	}
+
+	return "", nil
+}
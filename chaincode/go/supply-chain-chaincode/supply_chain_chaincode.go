@@ -1,17 +1,14 @@
 package main
 
 import (
-	"crypto/ecdsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"github.com/hyperledger/fabric-amcl/amcl/FP256BN"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"strconv"
+	"strings"
 )
 
 type SupplyChainChaincode struct {
@@ -25,29 +22,34 @@ func (cc *SupplyChainChaincode) Init(stub shim.ChaincodeStubInterface) pb.Respon
 	message := fmt.Sprintf("Received args: %s", []string(args))
 	Logger.Debug(message)
 
+	// the config is changed by updateConfig once it is stored, an upgrade keeps it
 	config := Config{}
-	if err := config.FillFromArguments(stub, args); err != nil {
-		message := fmt.Sprintf("cannot fill a config from arguments: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
-	}
+	if config.ExistsIn(stub, "") {
+		Logger.Debug("Config already exists")
+	} else {
+		if err := config.FillFromArguments(stub, args); err != nil {
+			message := fmt.Sprintf("cannot fill a config from arguments: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
 
-	compositeKey, err := config.ToCompositeKey(stub)
-	if err != nil {
-		message := fmt.Sprintf("persistence error: %s", err.Error())
-		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		Logger.Debug("PutState")
+		if err := config.Save(stub, 1, ""); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
 	}
 
-	value, err := config.ToLedgerValue()
-	if err != nil {
+	// the default roles are granted once, later the registry is changed by grantRole and revokeRole
+	if err := SeedRoleMembers(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
 	}
 
-	Logger.Debug("PutState")
-	if err = stub.PutState(compositeKey, value); err != nil {
+	// the events stored before they were indexed by time are indexed on upgrade
+	if err := IndexStoredEvents(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
@@ -60,6 +62,17 @@ func (cc *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 	Logger.Debug("Invoke")
 
 	function, args := stub.GetFunctionAndParameters()
+
+	// the attribute policy of the function, if the config sets one, applies before its own checks
+	if err, result := checkAccessForPolicy(stub, function, args); err != nil || !result {
+		message := fmt.Sprintf("access to %s is denied by its policy", function)
+		if err != nil {
+			message = fmt.Sprintf("%s: %s", message, err.Error())
+		}
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	if function == "placeOrder" {
 		// Buyer places order
 		return cc.placeOrder(stub, args)
@@ -78,8 +91,20 @@ func (cc *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		return cc.confirmDelivery(stub, args)
 	} else if function == "guaranteeOrder" {
 		return cc.guaranteeOrder(stub, args)
+	} else if function == "setExposureLimit" {
+		// Admin caps the guarantees of a bank, of a bank for a buyer or of every bank for a buyer
+		return cc.setExposureLimit(stub, args)
+	} else if function == "getExposureReport" {
+		// Active guarantees by bank and buyer and the use of the exposure limits
+		return cc.getExposureReport(stub, args)
 	} else if function == "uploadDocument" {
 		return cc.uploadDocument(stub, args)
+	} else if function == "updateDocument" {
+		// a new version of the document supersedes the previous one
+		return cc.updateDocument(stub, args)
+	} else if function == "signDocument" {
+		// parties countersign the document hash with their enrollment key
+		return cc.signDocument(stub, args)
 	} else if function == "generateProof" {
 		// Supplier generates a proof for an Auditor
 		return cc.generateProof(stub, args)
@@ -87,12 +112,44 @@ func (cc *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		return cc.verifyProof(stub, args)
 	} else if function == "updateProof" {
 		return cc.updateProof(stub, args)
+	} else if function == "setContractPredicates" {
+		// Buyer declares the predicates proofs for the contract must prove
+		return cc.setContractPredicates(stub, args)
+	} else if function == "issueBillOfLading" {
+		// Transporter issues the title document for a confirmed shipment
+		return cc.issueBillOfLading(stub, args)
+	} else if function == "endorseBillOfLading" {
+		// current holder transfers the title to a bank or buyer
+		return cc.endorseBillOfLading(stub, args)
+	} else if function == "registerIssuerKey" {
+		// auditor or admin acting as the certification body registers its Idemix issuer public key
+		return cc.registerIssuerKey(stub, args)
+	} else if function == "listIssuerKeys" {
+		return cc.listIssuerKeys(stub, args)
+	} else if function == "registerRevocationAuthority" {
+		return cc.registerRevocationAuthority(stub, args)
+	} else if function == "publishCRI" {
+		// Revocation authority opens a new epoch
+		return cc.publishCRI(stub, args)
+	} else if function == "revokeCredential" {
+		return cc.revokeCredential(stub, args)
+	} else if function == "listRevocationAuthorities" {
+		return cc.listRevocationAuthorities(stub, args)
 	} else if function == "listOrders" {
 		// List all orders
 		return cc.listOrders(stub, args)
 	} else if function == "listContracts" {
 		// List contracts for the party from every collection
 		return cc.listContracts(stub, args)
+	} else if function == "reconcileContracts" {
+		// Auditor reports where contracts and their invoices in the trade-finance chaincode disagree
+		return cc.reconcileContracts(stub, args)
+	} else if function == "getSupplierPerformance" {
+		// On-time deliveries, order-to-delivery time and report pass ratio per supplier in a time window
+		return cc.getSupplierPerformance(stub, args)
+	} else if function == "getTradeVolumes" {
+		// Contracted quantities and amounts by product and destination in a time window
+		return cc.getTradeVolumes(stub, args)
 	} else if function == "listProofs" {
 		return cc.listProofs(stub, args)
 	} else if function == "listProofsByOwner" {
@@ -107,16 +164,57 @@ func (cc *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		return cc.listShipments(stub, args)
 	} else if function == "getDocument" {
 		return cc.getDocument(stub, args)
+	} else if function == "verifyDocument" {
+		return cc.verifyDocument(stub, args)
+	} else if function == "getDocumentSignatures" {
+		return cc.getDocumentSignatures(stub, args)
+	} else if function == "listMissingDocuments" {
+		// documents a contract lacks for the checklists of its transitions
+		return cc.listMissingDocuments(stub, args)
+	} else if function == "getBillOfLading" {
+		return cc.getBillOfLading(stub, args)
+	} else if function == "getEndorsementPolicy" {
+		// Organizations whose peers must endorse a change of the entity
+		return cc.getEndorsementPolicy(stub, args)
+	} else if function == bridgeFunction {
+		// The other chaincode calls a function through the versioned bridge schema
+		return cc.bridge(stub, args)
 	} else if function == "getEventPayload" {
 		return cc.getEventPayload(stub, args)
+	} else if function == "listEvents" {
+		// Events filtered by entity, action, creator and time window, page by page
+		return cc.listEvents(stub, args)
+	} else if function == "grantRole" {
+		// Admin grants a role to an MSP, an organizational unit or a certificate attribute
+		return cc.grantRole(stub, args)
+	} else if function == "revokeRole" {
+		return cc.revokeRole(stub, args)
+	} else if function == "listRoleMembers" {
+		return cc.listRoleMembers(stub, args)
+	} else if function == "registerParticipant" {
+		// Bank or admin registers the legal identity and KYC status behind an organizational unit
+		return cc.registerParticipant(stub, args)
+	} else if function == "listParticipants" {
+		return cc.listParticipants(stub, args)
+	} else if function == "getConfig" {
+		return cc.getConfig(stub, args)
+	} else if function == "getConfigHistory" {
+		return cc.getConfigHistory(stub, args)
+	} else if function == "updateConfig" {
+		// Admin replaces the config, the previous versions are kept in its history
+		return cc.updateConfig(stub, args)
 	}
 	// (optional) add other query functions
 
 	fnList := "{placeOrder, updateOrder, cancelOrder, acceptOrder, " +
-		"requestShipment, confirmShipment, uploadDocument, " +
+		"requestShipment, confirmShipment, uploadDocument, updateDocument, signDocument, " +
 		"generateProof, verifyProof, submitReport, " +
-		"acceptInvoice, rejectInvoice, listProofsByOwner, updateProof, " +
-		"listOrders, listContracts, listProofs, listReports, listShipments, getEventPayload, getDocument}"
+		"acceptInvoice, rejectInvoice, listProofsByOwner, updateProof, setContractPredicates, " +
+		"issueBillOfLading, endorseBillOfLading, " +
+		"registerIssuerKey, listIssuerKeys, registerRevocationAuthority, publishCRI, " +
+		"revokeCredential, listRevocationAuthorities, " +
+		"setExposureLimit, getExposureReport, listOrders, listContracts, reconcileContracts, getSupplierPerformance, getTradeVolumes, listProofs, listReports, listShipments, getEventPayload, listEvents, getDocument, verifyDocument, getDocumentSignatures, listMissingDocuments, getBillOfLading, " +
+		"getEndorsementPolicy, bridge, getConfig, getConfigHistory, updateConfig, grantRole, revokeRole, listRoleMembers, registerParticipant, listParticipants}"
 	message := fmt.Sprintf("invalid invoke function name: expected one of %s, got %s", fnList, function)
 	Logger.Debug(message)
 
@@ -134,12 +232,19 @@ func (cc *SupplyChainChaincode) placeOrder(stub shim.ChaincodeStubInterface, arg
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place an order")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	//checking the buyer is registered and can trade
+	if err := CheckCreatorParticipant(stub); err != nil {
+		message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//filling from arguments
 	order := Order{}
 	if err := order.FillFromArguments(stub, args); err != nil {
@@ -162,9 +267,17 @@ func (cc *SupplyChainChaincode) placeOrder(stub shim.ChaincodeStubInterface, arg
 	}
 	Logger.Debug("OrganizationalUnit: " + creator)
 
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	order.Value.State = stateOrderNew
 	order.Value.UpdatedDate = order.Value.Timestamp
 	order.Value.BuyerID = creator
+	order.Value.BuyerMSP = mspID
 
 	//setting optional values
 	destination := args[4]
@@ -208,7 +321,7 @@ func (cc *SupplyChainChaincode) updateOrder(stub shim.ChaincodeStubInterface, ar
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to edit an order")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -265,6 +378,33 @@ func (cc *SupplyChainChaincode) updateOrder(stub shim.ChaincodeStubInterface, ar
 		return shim.Error(message)
 	}
 
+	//checking exposure limits of the guarantee with the new amount
+	guarantee := Guarantee{}
+	guarantee.Key.ID = orderToUpdate.Key.ID
+	if orderToUpdate.Value.Guarantor != "" && ExistsIn(stub, &guarantee, guaranteeIndex) {
+		if err := LoadFrom(stub, &guarantee, guaranteeIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		if guarantee.Value.State == stateGuaranteeActive {
+			guarantee.Value.Amount = order.Value.Amount
+			guarantee.Value.UpdatedDate = timestamp.Seconds
+			if err := CheckExposure(stub, guarantee); err != nil {
+				message := fmt.Sprintf("unable to update the guaranteed order: %s", err.Error())
+				Logger.Error(message)
+				return shim.Error(message)
+			}
+
+			if err := UpdateOrInsertIn(stub, &guarantee, guaranteeIndex, []string{""}, ""); err != nil {
+				message := fmt.Sprintf("persistence error: %s", err.Error())
+				Logger.Error(message)
+				return pb.Response{Status: 500, Message: message}
+			}
+		}
+	}
+
 	//setting new values
 	orderToUpdate.Value.ProductName = order.Value.ProductName
 	orderToUpdate.Value.Quantity = order.Value.Quantity
@@ -316,7 +456,7 @@ func (cc *SupplyChainChaincode) cancelOrder(stub shim.ChaincodeStubInterface, ar
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to cancel an order")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -387,6 +527,13 @@ func (cc *SupplyChainChaincode) cancelOrder(stub shim.ChaincodeStubInterface, ar
 		return pb.Response{Status: 500, Message: message}
 	}
 
+	//releasing the guarantee of the order
+	if err := ReleaseGuarantee(stub, orderToUpdate.Key.ID, timestamp.Seconds); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
 	//emitting Event
 	events := Events{}
 
@@ -414,7 +561,7 @@ func (cc *SupplyChainChaincode) guaranteeOrder(stub shim.ChaincodeStubInterface,
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Bank}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBank}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to guarantee an order")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -471,6 +618,22 @@ func (cc *SupplyChainChaincode) guaranteeOrder(stub shim.ChaincodeStubInterface,
 		return shim.Error(message)
 	}
 
+	//checking exposure limits
+	guarantee := Guarantee{}
+	guarantee.Key.ID = orderToUpdate.Key.ID
+	guarantee.Value.Bank = creator
+	guarantee.Value.Buyer = orderToUpdate.Value.BuyerID
+	guarantee.Value.Amount = orderToUpdate.Value.Amount
+	guarantee.Value.State = stateGuaranteeActive
+	guarantee.Value.Timestamp = timestamp.Seconds
+	guarantee.Value.UpdatedDate = timestamp.Seconds
+
+	if err := CheckExposure(stub, guarantee); err != nil {
+		message := fmt.Sprintf("unable to guarantee the order: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//setting new values
 	orderToUpdate.Value.Guarantor = creator
 	orderToUpdate.Value.UpdatedDate = timestamp.Seconds
@@ -486,6 +649,12 @@ func (cc *SupplyChainChaincode) guaranteeOrder(stub shim.ChaincodeStubInterface,
 		return pb.Response{Status: 500, Message: message}
 	}
 
+	if err := UpdateOrInsertIn(stub, &guarantee, guaranteeIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
 	//emitting Event
 	events := Events{}
 
@@ -507,6 +676,129 @@ func (cc *SupplyChainChaincode) guaranteeOrder(stub shim.ChaincodeStubInterface,
 	return shim.Success(nil)
 }
 
+//0		1		2
+//Bank	Buyer	Limit
+//an empty bank or buyer stands for any
+func (cc *SupplyChainChaincode) setExposureLimit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to set an exposure limit")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	limit := ExposureLimit{}
+	if err := limit.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill an exposure limit from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//keeping the time the limit was first set
+	existing := ExposureLimit{Key: limit.Key}
+	limit.Value.Timestamp = timestamp.Seconds
+	if ExistsIn(stub, &existing, exposureLimitIndex) {
+		if err := LoadFrom(stub, &existing, exposureLimitIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+		limit.Value.Timestamp = existing.Value.Timestamp
+	}
+
+	limit.Value.SetBy = creator
+	limit.Value.UpdatedDate = timestamp.Seconds
+
+	if bytes, err := json.Marshal(limit); err == nil {
+		Logger.Debug("ExposureLimit: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &limit, exposureLimitIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = setExposureLimit
+	eventValue := EventValue{}
+	eventValue.EntityType = exposureLimitIndex
+	eventValue.EntityID = limit.Key.Bank + "/" + limit.Key.Buyer
+	eventValue.Other = limit.Value
+	eventValue.Action = eventSetExposureLimit
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+func (cc *SupplyChainChaincode) getExposureReport(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor, Admin, Bank
+	// a bank gets the report of its own guarantees
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin, roleBank}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get the exposure report")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	bank := ""
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin}, stub); err != nil || !result {
+		creator, err := GetCreatorOrganizationalUnit(stub)
+		if err != nil {
+			message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+		bank = creator
+	}
+
+	limits, guarantees, err := loadExposure(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(ExposureReportOf(limits, guarantees, bank))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
 //0		1	2	3	4	5	6
 //ID	0	0	0	0	0	0
 func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -521,7 +813,7 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to cancel an order")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -556,6 +848,19 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 		return shim.Error(message)
 	}
 
+	//checking both parties are registered and can trade
+	if err := CheckCreatorParticipant(stub); err != nil {
+		message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := CheckParticipant(stub, orderToUpdate.Value.BuyerID, orderToUpdate.Value.BuyerMSP); err != nil {
+		message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
 		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
@@ -564,6 +869,13 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 	}
 	Logger.Debug("OrganizationalUnit: " + creator)
 
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -593,6 +905,8 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 	contract.Value.ProductName = orderToUpdate.Value.ProductName
 	contract.Value.ConsignorName = creator
 	contract.Value.ConsigneeName = orderToUpdate.Value.BuyerID
+	contract.Value.ConsignorMSP = mspID
+	contract.Value.ConsigneeMSP = orderToUpdate.Value.BuyerMSP
 	contract.Value.TotalDue = orderToUpdate.Value.Amount
 	contract.Value.Price = orderToUpdate.Value.Price
 	contract.Value.Quantity = orderToUpdate.Value.Quantity
@@ -616,21 +930,18 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 	}
 
 	//invoking another chaincode for registering invoice
-	fcnName := "registerInvoice"
-	chaincodeName := "trade-finance-chaincode"
-	channelName := "common"
-	invoiceID := contract.Key.ID
-	invoiceDebtor := contract.Value.ConsigneeName
-	invoiceBeneficiary := contract.Value.ConsignorName
-	invoiceTotalDue := fmt.Sprintf("%f", contract.Value.TotalDue)
-	invoicePaymentDate := fmt.Sprintf("%d", contract.Value.PaymentDate)
-	invoiceGuarantor := orderToUpdate.Value.Guarantor
-
-	argsByte := [][]byte{[]byte(fcnName), []byte(invoiceID), []byte(invoiceDebtor), []byte(invoiceBeneficiary), []byte(invoiceTotalDue), []byte(invoicePaymentDate), []byte(invoiceGuarantor)}
-
-	response := stub.InvokeChaincode(chaincodeName, argsByte, channelName)
-	if response.Status >= 400 {
-		message := fmt.Sprintf("Unable to invoke \"%s\": %s", chaincodeName, response.Message)
+	invoiceRequest := RegisterInvoiceRequest{
+		InvoiceID:   contract.Key.ID,
+		Debtor:      contract.Value.ConsigneeName,
+		Beneficiary: contract.Value.ConsignorName,
+		TotalDue:    contract.Value.TotalDue,
+		PaymentDate: contract.Value.PaymentDate,
+		Guarantor:   orderToUpdate.Value.Guarantor,
+	}
+
+	if err := InvokeBridge(stub, bridgeRegisterInvoice, invoiceRequest, nil); err != nil {
+		message := fmt.Sprintf("Unable to invoke \"%s\": %s", bridgeRegisterInvoice, err.Error())
+		Logger.Error(message)
 		return pb.Response{Status: 400, Message: message}
 	}
 
@@ -666,13 +977,13 @@ func (cc *SupplyChainChaincode) acceptOrder(stub shim.ChaincodeStubInterface, ar
 	return shim.Success(nil)
 }
 
-//0				1			2			3		4			5			6				7				8
-//ShipmentID	ContractID	ShipFrom	ShipTo	Transport	Description	DocumentHash	DocumentType	DocumentMeta
+//0				1			2			3		4			5			6				7				8				9
+//ShipmentID	ContractID	ShipFrom	ShipTo	Transport	Description	DocumentHash	DocumentType	DocumentMeta	DocumentCategory
 func (cc *SupplyChainChaincode) requestShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to request a shipment")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -724,6 +1035,18 @@ func (cc *SupplyChainChaincode) requestShipment(stub shim.ChaincodeStubInterface
 		return shim.Error(message)
 	}
 
+	//checking documents required by the transition, counting the one uploaded with it
+	documentCategory := ""
+	if len(args) > 9 && args[6] != "" && args[7] != "" {
+		documentCategory = args[9]
+	}
+
+	if err := checkRequiredDocuments(stub, eventRequestShipment, contract.Key.ID, documentCategory); err != nil {
+		message := fmt.Sprintf("cannot request shipment: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//setting automatic values
 	shipment.Value.State = stateShipmentRequested
 	shipment.Value.Description = fmt.Sprintf("<span style=\"font-weight: bold\">%s: </span>%s<br>", creator, args[5])
@@ -769,7 +1092,7 @@ func (cc *SupplyChainChaincode) requestShipment(stub shim.ChaincodeStubInterface
 			Logger.Error(message)
 			return pb.Response{Status: 500, Message: message}
 		}
-		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipment.Key.ID, documentHash, documentMeta, documentType, shipment.Value.ContractID}
+		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipment.Key.ID, documentHash, documentMeta, documentType, shipment.Value.ContractID, documentCategory}
 		err, document = processingUploadDocument(stub, documentFields, contract)
 		if err != nil {
 			message := fmt.Sprintf("Error during processing upload document: %s", err.Error())
@@ -812,13 +1135,13 @@ func (cc *SupplyChainChaincode) requestShipment(stub shim.ChaincodeStubInterface
 	return shim.Success(nil)
 }
 
-//0		1	2	3	4	5 			6				7				8
-//ID	0	0	0	0	Description DocumentHash	DocumentType	DocumentMeta
+//0		1	2	3	4	5 			6				7				8				9
+//ID	0	0	0	0	Description DocumentHash	DocumentType	DocumentMeta	DocumentCategory
 func (cc *SupplyChainChaincode) confirmShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{TransportAgency}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleTransporter}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -865,6 +1188,18 @@ func (cc *SupplyChainChaincode) confirmShipment(stub shim.ChaincodeStubInterface
 		return shim.Error(message)
 	}
 
+	//checking documents required by the transition, counting the one uploaded with it
+	documentCategory := ""
+	if len(args) > 9 && args[6] != "" && args[7] != "" {
+		documentCategory = args[9]
+	}
+
+	if err := checkRequiredDocuments(stub, eventConfirmShipment, shipmentToUpdate.Value.ContractID, documentCategory); err != nil {
+		message := fmt.Sprintf("cannot confirm shipment: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -904,7 +1239,7 @@ func (cc *SupplyChainChaincode) confirmShipment(stub shim.ChaincodeStubInterface
 			Logger.Error(message)
 			return pb.Response{Status: 500, Message: message}
 		}
-		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipmentToUpdate.Key.ID, documentHash, documentMeta, documentType, shipmentToUpdate.Value.ContractID}
+		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipmentToUpdate.Key.ID, documentHash, documentMeta, documentType, shipmentToUpdate.Value.ContractID, documentCategory}
 		err, document = processingUploadDocument(stub, documentFields, Contract{})
 		if err != nil {
 			message := fmt.Sprintf("Error during processing upload document: %s", err.Error())
@@ -943,13 +1278,13 @@ func (cc *SupplyChainChaincode) confirmShipment(stub shim.ChaincodeStubInterface
 	return shim.Success(nil)
 }
 
-//0		1	2	3	4	5			6				7				8
-//ID	0	0	0	0	Description	DocumentHash	DocumentType	DocumentMeta
+//0		1	2	3	4	5			6				7				8				9
+//ID	0	0	0	0	Description	DocumentHash	DocumentType	DocumentMeta	DocumentCategory
 func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -1042,6 +1377,26 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 		}
 	}
 
+	//checking documents required by the transition, counting the one uploaded with it
+	documentCategory := ""
+	if len(args) > 9 && args[6] != "" && args[7] != "" {
+		documentCategory = args[9]
+	}
+
+	if err := checkRequiredDocuments(stub, eventConfirmDelivery, contract.Key.ID, documentCategory); err != nil {
+		message := fmt.Sprintf("cannot confirm delivery: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//checking the bill of lading, the goods are delivered only to its holder
+	billOfLading, err := findBillOfLadingByShipment(stub, shipmentToUpdate.Key.ID)
+	if err != nil {
+		message := fmt.Sprintf("cannot find bill of lading by shipment: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -1050,8 +1405,17 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 		return shim.Error(message)
 	}
 
+	if billOfLading != nil {
+		if err := billOfLading.Surrender(creator, timestamp.Seconds); err != nil {
+			message := fmt.Sprintf("cannot confirm delivery: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
 	//setting new values
 	shipmentToUpdate.Value.State = stateShipmentDelivered
+	shipmentToUpdate.Value.DeliveryDate = timestamp.Seconds
 	shipmentToUpdate.Value.UpdatedDate = timestamp.Seconds
 
 	if shippmentDesription := args[5]; shippmentDesription != "" && shippmentDesription != "0" {
@@ -1078,12 +1442,28 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 	}
 
 	//saving contract to ledger
-	if err := UpdateOrInsertIn(stub, &contract, contractIndex, []string{creator, shipmentToUpdate.Value.Consignor}, statebased.RoleTypePeer); err != nil {
+	if err := UpdateOrInsertIn(stub, &contract, contractIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//releasing the guarantee of the order as the contract completes
+	if err := ReleaseGuarantee(stub, contract.Key.ID, timestamp.Seconds); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
 	}
 
+	//saving surrendered bill of lading to ledger
+	if billOfLading != nil {
+		if err := UpdateOrInsertIn(stub, billOfLading, billOfLadingIndex, []string{""}, ""); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+	}
+
 	// uploading document
 	documentHash := args[6]
 	documentType := args[7]
@@ -1096,7 +1476,7 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 			Logger.Error(message)
 			return pb.Response{Status: 500, Message: message}
 		}
-		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipmentToUpdate.Key.ID, documentHash, documentMeta, documentType, shipmentToUpdate.Value.ContractID}
+		documentFields := []string{documentID, strconv.Itoa(TypeShipment), shipmentToUpdate.Key.ID, documentHash, documentMeta, documentType, shipmentToUpdate.Value.ContractID, documentCategory}
 		err, document = processingUploadDocument(stub, documentFields, contract)
 		if err != nil {
 			message := fmt.Sprintf("Error during processing upload document: %s", err.Error())
@@ -1106,20 +1486,11 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 	}
 
 	// invoking trade-finance chaincode for updating invoice state
-	fcnName := "acceptInvoice"
-	chaincodeName := "trade-finance-chaincode"
-	channelName := "common"
-	invoiceID := shipmentToUpdate.Value.ContractID
-
-	argsByte := [][]byte{[]byte(fcnName), []byte(invoiceID), []byte("0"), []byte("0"), []byte("0"), []byte("0"), []byte("0"), []byte("0")}
-
-	for _, oneArg := range args {
-		argsByte = append(argsByte, []byte(oneArg))
-	}
+	invoiceRequest := AcceptInvoiceRequest{InvoiceID: shipmentToUpdate.Value.ContractID}
 
-	response := stub.InvokeChaincode(chaincodeName, argsByte, channelName)
-	if response.Status >= 400 {
-		message := fmt.Sprintf("Unable to invoke \"%s\": %s", chaincodeName, response.Message)
+	if err := InvokeBridge(stub, bridgeAcceptInvoice, invoiceRequest, nil); err != nil {
+		message := fmt.Sprintf("Unable to invoke \"%s\": %s", bridgeAcceptInvoice, err.Error())
+		Logger.Error(message)
 		return pb.Response{Status: 400, Message: message}
 	}
 
@@ -1141,8 +1512,17 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 	eventValue.Action = eventContractCompleted
 	events.Values = append(events.Values, eventValue)
 
+	if billOfLading != nil {
+		//event = surrenderBillOfLading
+		eventValue.EntityType = billOfLadingIndex
+		eventValue.EntityID = billOfLading.Key.ID
+		eventValue.Other = billOfLading.Value
+		eventValue.Action = eventSurrenderBillOfLading
+		events.Values = append(events.Values, eventValue)
+	}
+
 	if documentHash != "" && documentType != "" {
-		//event3 = uploadDocument
+		//event = uploadDocument
 		eventValue.EntityType = documentIndex
 		eventValue.EntityID = document.Key.ID
 		eventValue.Other = document.Value
@@ -1160,13 +1540,13 @@ func (cc *SupplyChainChaincode) confirmDelivery(stub shim.ChaincodeStubInterface
 	return shim.Success(nil)
 }
 
-//0					1			2			3				4				5				6
-//DocumentID		EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID
+//0					1			2			3				4				5				6			7
+//DocumentID		EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID	Category
 func (cc *SupplyChainChaincode) uploadDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier, Buyer, Auditor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier, roleBuyer, roleAuditor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to upload a document")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -1200,36 +1580,141 @@ func (cc *SupplyChainChaincode) uploadDocument(stub shim.ChaincodeStubInterface,
 	return shim.Success(nil)
 }
 
-//0					1			2			3				4				5				6
-//DocumentID		EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID
-func processingUploadDocument(stub shim.ChaincodeStubInterface, args []string, contract Contract) (error, Document) {
+//0				1					2				3				4
+//DocumentID	PreviousDocumentID	DocumentHash	DocumentMeta	DocumentType
+func (cc *SupplyChainChaincode) updateDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
 
-	//checking document exist
-	document := Document{}
-	if err := document.FillFromArguments(stub, args); err != nil {
-		message := fmt.Sprintf("cannot fill an document from arguments: %s", err.Error())
+	//checking role
+	if err, result := checkAccessForRole([]string{roleSupplier, roleBuyer, roleAuditor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to update a document")
 		Logger.Error(message)
-		return errors.New(message), Document{}
+		return shim.Error(message)
 	}
 
-	if ExistsIn(stub, &document, documentIndex) {
-		compositeKey, _ := document.ToCompositeKey(stub)
-		message := fmt.Sprintf("document with the key %s already exists", compositeKey)
+	err, document := processingVersionDocument(stub, args)
+	if err != nil {
+		message := fmt.Sprintf("Error during processing document version: %s", err.Error())
 		Logger.Error(message)
-		return errors.New(message), Document{}
+		return shim.Error(message)
 	}
 
-	//additional checking
-	findedDocuments, err := findDocumentByHash(stub, document.Value.DocumentHash)
-	if err != nil {
-		message := fmt.Sprintf("persistence error: %s", err.Error())
+	//emitting Event
+	events := Events{}
+
+	//event = updateDocument
+	eventValue := EventValue{}
+	eventValue.EntityType = documentIndex
+	eventValue.EntityID = document.Key.ID
+	eventValue.Other = document.Value
+	eventValue.Action = eventUpdateDocument
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
 		Logger.Error(message)
-		return errors.New(message), Document{}
+		return pb.Response{Status: 500, Message: message}
 	}
-	if len(findedDocuments) != 0 {
-		message := fmt.Sprintf("document with hash %s already exists", document.Value.DocumentHash)
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0				1
+//DocumentID	Signature
+func (cc *SupplyChainChaincode) signDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleSupplier, roleBuyer, roleAuditor, roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to sign a document")
 		Logger.Error(message)
-		return errors.New(message), Document{}
+		return shim.Error(message)
+	}
+
+	signature := Signature{}
+	if err := signature.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a signature from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if ExistsIn(stub, &signature, signatureIndex) {
+		compositeKey, _ := signature.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("signature with the key %s already exists", compositeKey))
+	}
+
+	// a superseded version can't collect signatures any more
+	successors, err := findDocumentSuccessors(stub, signature.Key.DocumentID)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+	if len(successors) != 0 {
+		message := fmt.Sprintf("document %s is superseded by %s", signature.Key.DocumentID, successors[0].Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// updating state in ledger
+	if err := UpdateOrInsertIn(stub, &signature, signatureIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = signDocument
+	eventValue := EventValue{}
+	eventValue.EntityType = signatureIndex
+	eventValue.EntityID = signature.Key.DocumentID
+	eventValue.Other = signature.Value
+	eventValue.Action = eventSignDocument
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0					1			2			3				4				5				6			7
+//DocumentID		EntityType	EntityID	DocumentHash 	DocumentMeta	DocumentType	ContractID	Category
+func processingUploadDocument(stub shim.ChaincodeStubInterface, args []string, contract Contract) (error, Document) {
+
+	//checking document exist
+	document := Document{}
+	if err := document.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill an document from arguments: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	if ExistsIn(stub, &document, documentIndex) {
+		compositeKey, _ := document.ToCompositeKey(stub)
+		message := fmt.Sprintf("document with the key %s already exists", compositeKey)
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	//additional checking
+	findedDocuments, err := findDocumentByHash(stub, document.Value.DocumentHash)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+	if len(findedDocuments) != 0 {
+		message := fmt.Sprintf("document with hash %s already exists", document.Value.DocumentHash)
+		Logger.Error(message)
+		return errors.New(message), Document{}
 	}
 
 	//getting transaction Timestamp
@@ -1240,10 +1725,19 @@ func processingUploadDocument(stub shim.ChaincodeStubInterface, args []string, c
 		return errors.New(message), Document{}
 	}
 
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
 	//setting optional values
 	document.Value.DocumentMeta = args[4]
 
 	//setting automatic values
+	document.Value.Owner = creator
+	document.Value.Version = 1
 	document.Value.Timestamp = timestamp.Seconds
 	document.Value.UpdatedDate = document.Value.Timestamp
 
@@ -1284,19 +1778,103 @@ func processingUploadDocument(stub shim.ChaincodeStubInterface, args []string, c
 	return nil, document
 }
 
-//0			1				2		3
-//ProofID	ArrayAttributes	Owner	ShipmentID
+//0				1					2				3				4
+//DocumentID	PreviousDocumentID	DocumentHash	DocumentMeta	DocumentType
+func processingVersionDocument(stub shim.ChaincodeStubInterface, args []string) (error, Document) {
+	if len(args) < 5 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	// getting the version to supersede
+	previous := Document{}
+	if err := previous.FillFromCompositeKeyParts([]string{args[1]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	if !ExistsIn(stub, &previous, documentIndex) {
+		compositeKey, _ := previous.ToCompositeKey(stub)
+		message := fmt.Sprintf("document with the key %s doesn't exist", compositeKey)
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	if err := LoadFrom(stub, &previous, documentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	// documents uploaded before versioning have no owner
+	if previous.Value.Owner != "" && previous.Value.Owner != creator {
+		message := fmt.Sprintf("only the owner can upload a new version of the document")
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	// versions form a chain, so only the latest one can be superseded
+	successors, err := findDocumentSuccessors(stub, previous.Key.ID)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+	if len(successors) != 0 {
+		message := fmt.Sprintf("document %s is already superseded by %s", previous.Key.ID, successors[0].Key.ID)
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	documentFields := []string{args[0], strconv.Itoa(previous.Value.EntityType), previous.Value.EntityID, args[2], args[3], args[4], previous.Value.ContractID, previous.Value.Category}
+	err, document := processingUploadDocument(stub, documentFields, Contract{})
+	if err != nil {
+		return err, Document{}
+	}
+
+	document.Value.Version = previous.Value.Version + 1
+	document.Value.PreviousID = previous.Key.ID
+
+	if err := UpdateOrInsertIn(stub, &document, documentIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), Document{}
+	}
+
+	return nil, document
+}
+
+//0			1		2			3
+//ProofID	Owner	ShipmentID	IssuerID
+//the proof itself is passed in the transient map, see transientSchemas
 func (cc *SupplyChainChaincode) generateProof(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to upload a document")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	submission := ProofSubmission{}
+	if err := GetTransientInput(stub, "generateProof", &submission); err != nil {
+		message := fmt.Sprintf("cannot read the transient input: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	// checking proof exist
 	proof := Proof{}
 	if err := proof.FillFromArguments(stub, args); err != nil {
@@ -1312,7 +1890,7 @@ func (cc *SupplyChainChaincode) generateProof(stub shim.ChaincodeStubInterface,
 
 	//additional checking
 	shipment := Shipment{}
-	shipmentID := args[3]
+	shipmentID := args[2]
 	if err := shipment.FillFromCompositeKeyParts([]string{shipmentID}); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
@@ -1359,9 +1937,30 @@ func (cc *SupplyChainChaincode) generateProof(stub shim.ChaincodeStubInterface,
 	proof.Value.Timestamp = timestamp.Seconds
 	proof.Value.UpdatedDate = proof.Value.Timestamp
 
-	// parsing input json and generate Idemix crypto
-	if err := proof.GenerateIdemixCrypto(args[1]); err != nil {
-		message := fmt.Sprintf("Idemix Crypto error: %s", err.Error())
+	// accepting the proof built on the client side
+	if err := proof.FillFromSubmission(string(submission.Proof)); err != nil {
+		message := fmt.Sprintf("cannot accept the proof: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// getting the registered issuer key
+	issuerKey, err := loadIssuerKey(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load issuer key: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority, err := loadRevocationAuthority(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load revocation authority: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := proof.Verify(stub, issuerKey.Value.Ipk, &revocationAuthority); err != nil {
+		message := fmt.Sprintf("Signature verification was failed. Error: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
@@ -1394,18 +1993,32 @@ func (cc *SupplyChainChaincode) generateProof(stub shim.ChaincodeStubInterface,
 	return shim.Success(nil)
 }
 
-//0			1				2				3					4				5
-//ProofID	ReportState		Description		DocumentHash 		DocumentType	DocumentMeta
+//0			1				2				3
+//ProofID	ReportState		DocumentHash	DocumentType
+//the description and the document meta are passed in the transient map, see transientSchemas
 func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Auditor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleAuditor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to upload a document")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	if len(args) < 4 {
+		message := fmt.Sprintf("arguments array must contain at least 4 items")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	details := ReportDetails{}
+	if err := GetTransientInput(stub, "verifyProof", &details); err != nil {
+		message := fmt.Sprintf("cannot read the transient input: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	// checking proof exist
 	proof := Proof{}
 	if err := proof.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
@@ -1447,25 +2060,59 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	attributeValuesBytes := make([]*FP256BN.BIG, len(proof.Value.DataForVerification.AttributeValuesHash))
 
-	for i := range proof.Value.DataForVerification.AttributeValuesHash {
-		attributeValuesBytes[i] = FP256BN.FromBytes(proof.Value.DataForVerification.AttributeValuesHash[i])
+	// verifying against the registered issuer public key only
+	issuerKey, err := loadIssuerKey(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load issuer key: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
 	}
-	err = proof.Value.SnapShot.Ver(proof.Value.DataForVerification.Disclosure,
-		proof.Value.DataForVerification.Ipk,
-		proof.Value.DataForVerification.Msg,
-		attributeValuesBytes,
-		proof.Value.DataForVerification.RhIndex,
-		decode(proof.Value.DataForVerification.RevPk),
-		proof.Value.DataForVerification.Epoch)
 
+	// checking the signature against the current epoch and the revocation list
+	revocationAuthority, err := loadRevocationAuthority(stub, proof.Value.IssuerID)
 	if err != nil {
+		message := fmt.Sprintf("cannot load revocation authority: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := proof.Verify(stub, issuerKey.Value.Ipk, &revocationAuthority); err != nil {
 		message := fmt.Sprintf("Signature verification was failed. Error: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	// checking the predicates required by the contract of the shipment
+	err, contractID := findContractIDByEntity(stub, TypeShipment, proof.Value.ShipmentID)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if contractID != "" {
+		contract := Contract{}
+		if err := contract.FillFromCompositeKeyParts([]string{contractID}); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		if err := LoadFrom(stub, &contract, contractIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		if predicate, ok := proof.Satisfies(contract.Value.Predicates); !ok {
+			message := fmt.Sprintf("proof doesn't prove the predicate %s %s %d required by the contract",
+				predicate.Attribute, predicate.Operator, predicate.Bound)
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -1490,9 +2137,9 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 	events := Events{}
 	eventValue := EventValue{}
 
-	documentHash := args[3]
-	documentType := args[4]
-	documentMeta := args[5]
+	documentHash := args[2]
+	documentType := args[3]
+	documentMeta := details.DocumentMeta
 
 	if proof.Value.State == stateProofGenerated {
 		// making new report
@@ -1511,7 +2158,7 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 		report.Value.Owner = proof.Value.Owner
 		report.Value.ShipmentID = proof.Value.ShipmentID
 		report.Value.State = reportState
-		report.Value.Description = args[2]
+		report.Value.Description = details.Description
 		report.Value.ProofID = proof.Key.ID
 		report.Value.ConsignorName = proof.Value.ConsignorName
 		report.Value.Timestamp = timestamp.Seconds
@@ -1548,18 +2195,22 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 				return shim.Error(message)
 			}
 
-			//event = uploadDocument
+			//event = uploadDocument, the meta came in the transient input and stays out of the block
+			snapshot := document.Value
+			snapshot.DocumentMeta = ""
 			eventValue.EntityType = documentIndex
 			eventValue.EntityID = document.Key.ID
-			eventValue.Other = document.Value
+			eventValue.Other = snapshot
 			eventValue.Action = eventUploadDocument
 			events.Values = append(events.Values, eventValue)
 		}
 
-		//event = submitReport
+		//event = submitReport, the description came in the transient input and stays out of the block
+		snapshot := report.Value
+		snapshot.Description = ""
 		eventValue.EntityType = reportIndex
 		eventValue.EntityID = report.Key.ID
-		eventValue.Other = report.Value
+		eventValue.Other = snapshot
 		eventValue.Action = eventSubmitReport
 		events.Values = append(events.Values, eventValue)
 
@@ -1571,9 +2222,10 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 			Logger.Error(message)
 			return shim.Error(message)
 		}
+		documentVersions := 0
 		for _, report := range reports {
 			report.Value.State = reportState
-			report.Value.Description = args[2]
+			report.Value.Description = details.Description
 			report.Value.UpdatedDate = timestamp.Seconds
 
 			//updating state in ledger
@@ -1607,42 +2259,44 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 					return shim.Error(message)
 				}
 
-				for _, document := range documents {
+				// documents are immutable, a new version supersedes the latest one
+				for _, document := range latestDocuments(documents) {
+					if document.Value.DocumentHash == documentHash {
+						continue
+					}
 
-					//setting new values
-					document.Value.UpdatedDate = timestamp.Seconds
-					//checking type of document
-					convertedDocumentType, err := strconv.Atoi(documentType)
+					documentVersions++
+					documentID, err := UUIDv4FromTXTimestamp(stub, documentVersions+1)
 					if err != nil {
-						return shim.Error(fmt.Sprintf("documentType is invalid: %s (must be int)", documentType))
-					}
-					if !allowedDocumentTypes[convertedDocumentType] {
-						return shim.Error(fmt.Sprintf("unacceptable type of document"))
+						message := fmt.Sprintf("cannot generate new uuid from tx timestamp: %s", err.Error())
+						Logger.Error(message)
+						return pb.Response{Status: 500, Message: message}
 					}
 
-					document.Value.DocumentType = convertedDocumentType
-					document.Value.DocumentHash = documentHash
-					document.Value.DocumentMeta = documentMeta
-
-					if err := UpdateOrInsertIn(stub, &document, documentIndex, []string{""}, ""); err != nil {
-						message := fmt.Sprintf("persistence error: %s", err.Error())
+					err, version := processingVersionDocument(stub, []string{documentID, document.Key.ID, documentHash, documentMeta, documentType})
+					if err != nil {
+						message := fmt.Sprintf("Error during processing document version: %s", err.Error())
 						Logger.Error(message)
 						return shim.Error(message)
 					}
 
-					//event = uploadDocument
+					//event = updateDocument, the meta came in the transient input and stays out of the block
+					snapshot := version.Value
+					snapshot.DocumentMeta = ""
 					eventValue.EntityType = documentIndex
-					eventValue.EntityID = document.Key.ID
-					eventValue.Other = document.Value
-					eventValue.Action = eventUploadDocument
+					eventValue.EntityID = version.Key.ID
+					eventValue.Other = snapshot
+					eventValue.Action = eventUpdateDocument
 					events.Values = append(events.Values, eventValue)
 				}
 			}
 
-			//event = updateReport
+			//event = updateReport, the description came in the transient input and stays out of the block
+			snapshot := report.Value
+			snapshot.Description = ""
 			eventValue.EntityType = reportIndex
 			eventValue.EntityID = report.Key.ID
-			eventValue.Other = report.Value
+			eventValue.Other = snapshot
 			eventValue.Action = eventUpdateReport
 			events.Values = append(events.Values, eventValue)
 		}
@@ -1681,18 +2335,26 @@ func (cc *SupplyChainChaincode) verifyProof(stub shim.ChaincodeStubInterface, ar
 	return shim.Success(nil)
 }
 
-//0			1				2		3
-//ProofID	ArrayAttributes	Owner	ShipmentID
+//0
+//ProofID
+//the proof itself is passed in the transient map, see transientSchemas
 func (cc *SupplyChainChaincode) updateProof(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to upload a document")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	submission := ProofSubmission{}
+	if err := GetTransientInput(stub, "updateProof", &submission); err != nil {
+		message := fmt.Sprintf("cannot read the transient input: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	// checking proof exist
 	proof := Proof{}
 	if err := proof.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
@@ -1740,9 +2402,30 @@ func (cc *SupplyChainChaincode) updateProof(stub shim.ChaincodeStubInterface, ar
 	proof.Value.State = stateProofUpdated
 	proof.Value.UpdatedDate = timestamp.Seconds
 
-	// parsing input json and generate Idemix crypto
-	if err := proof.GenerateIdemixCrypto(args[1]); err != nil {
-		message := fmt.Sprintf("Idemix Crypto error: %s", err.Error())
+	// accepting the proof built on the client side
+	if err := proof.FillFromSubmission(string(submission.Proof)); err != nil {
+		message := fmt.Sprintf("cannot accept the proof: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// getting the registered issuer key
+	issuerKey, err := loadIssuerKey(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load issuer key: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority, err := loadRevocationAuthority(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load revocation authority: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := proof.Verify(stub, issuerKey.Value.Ipk, &revocationAuthority); err != nil {
+		message := fmt.Sprintf("Signature verification was failed. Error: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
@@ -1775,393 +2458,2349 @@ func (cc *SupplyChainChaincode) updateProof(stub shim.ChaincodeStubInterface, ar
 	return shim.Success(nil)
 }
 
-func (cc *SupplyChainChaincode) listOrders(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	// list all of the orders in common channel
-	// (optional) filter entries by status
+//0				1
+//ContractID	Predicates
+func (cc *SupplyChainChaincode) setContractPredicates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
-	orders := []Order{}
-	ordersBytes, err := Query(stub, orderIndex, []string{}, CreateOrder, EmptyFilter)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to set contract predicates")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(ordersBytes, &orders); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("insufficient number of arguments")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := json.Marshal(orders)
-
-	Logger.Debug("Result: " + string(resultBytes))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
-}
+	contract := Contract{}
+	if err := contract.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
 
-func (cc *SupplyChainChaincode) listContracts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	// check role == Buyer or Supplier
-	// list all of the contracts for the caller from all collections
-	Notifier(stub, NoticeRuningType)
+	if !ExistsIn(stub, &contract, contractIndex) {
+		compositeKey, _ := contract.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("contract with the key %s doesnt exist", compositeKey))
+	}
 
-	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer, Supplier}, stub); err != nil || !result {
-		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
+	if err := LoadFrom(stub, &contract, contractIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return pb.Response{Status: 500, Message: message}
 	}
 
-	contracts := []Contract{}
-	contractsBytes, err := Query(stub, contractIndex, []string{}, CreateContract, EmptyFilter)
+	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(contractsBytes, &contracts); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if contract.Value.ConsigneeName != creator {
+		message := fmt.Sprintf("each buyer can set predicates only for their contract")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := joinByContractsAndDocuments(stub, contracts)
+	// predicates can't change once shipments are requested under the contract
+	if contract.Value.State != stateContractSigned {
+		message := fmt.Sprintf("predicates can be set only for a signed contract")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := contract.SetPredicates(args[1]); err != nil {
+		message := fmt.Sprintf("cannot set predicates: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		message := fmt.Sprintf("cannot join by contract and document: %s", err.Error())
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	contract.Value.UpdatedDate = timestamp.Seconds
+
+	// updating state in ledger
+	if err := UpdateOrInsertIn(stub, &contract, contractIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = setContractPredicates
+	eventValue := EventValue{}
+	eventValue.EntityType = contractIndex
+	eventValue.EntityID = contract.Key.ID
+	eventValue.Other = contract.Value
+	eventValue.Action = eventSetContractPredicates
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
 	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return shim.Success(nil)
 }
 
-func (cc *SupplyChainChaincode) listProofs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	// check role == Auditor
-	// list all proofs for Auditor's name/id/etc
+//0		1
+//ID	ShipmentID
+func (cc *SupplyChainChaincode) issueBillOfLading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
 	//checking role
+	if err, result := checkAccessForRole([]string{roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to issue a bill of lading")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	billOfLading := BillOfLading{}
+	if err := billOfLading.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a bill of lading from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if ExistsIn(stub, &billOfLading, billOfLadingIndex) {
+		compositeKey, _ := billOfLading.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("bill of lading with the key %s already exists", compositeKey))
+	}
+
+	//there is one title document per shipment
+	if existing, err := findBillOfLadingByShipment(stub, billOfLading.Value.ShipmentID); err != nil {
+		message := fmt.Sprintf("cannot find bill of lading by shipment: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	} else if existing != nil {
+		message := fmt.Sprintf("bill of lading %s is already issued for shipment %s", existing.Key.ID, billOfLading.Value.ShipmentID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if bytes, err := json.Marshal(billOfLading); err == nil {
+		Logger.Debug("BillOfLading: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &billOfLading, billOfLadingIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = issueBillOfLading
+	eventValue := EventValue{}
+	eventValue.EntityType = billOfLadingIndex
+	eventValue.EntityID = billOfLading.Key.ID
+	eventValue.Other = billOfLading.Value
+	eventValue.Action = eventIssueBillOfLading
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1
+//ID	Endorsee
+func (cc *SupplyChainChaincode) endorseBillOfLading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Auditor, Buyer, Supplier, TransportAgency}, stub); err != nil || !result {
-		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
+	if err, result := checkAccessForRole([]string{roleSupplier, roleBank, roleFactor, roleBuyer}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to endorse a bill of lading")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	proofs := []Proof{}
-	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, EmptyFilter)
+	if len(args) < 2 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	billOfLading := BillOfLading{}
+	if err := billOfLading.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &billOfLading, billOfLadingIndex) {
+		compositeKey, _ := billOfLading.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("bill of lading with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &billOfLading, billOfLadingIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	endorsee := args[1]
+	allowed, err := UnitHasRole(stub, endorsee, billOfLadingEndorsees...)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain roles of %s: %s", endorsee, err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := json.Marshal(proofs)
+	if !allowed {
+		message := fmt.Sprintf("bill of lading cannot be endorsed to %s", endorsee)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	if err := CheckParticipant(stub, endorsee, ""); err != nil {
+		message := fmt.Sprintf("bill of lading cannot be endorsed to %s: %s", endorsee, err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := billOfLading.Endorse(creator, endorsee, timestamp.Seconds); err != nil {
+		message := fmt.Sprintf("cannot endorse bill of lading: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if bytes, err := json.Marshal(billOfLading); err == nil {
+		Logger.Debug("BillOfLading: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &billOfLading, billOfLadingIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = endorseBillOfLading
+	eventValue := EventValue{}
+	eventValue.EntityType = billOfLadingIndex
+	eventValue.EntityID = billOfLading.Key.ID
+	eventValue.Other = billOfLading.Value
+	eventValue.Action = eventEndorseBillOfLading
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
 	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return shim.Success(nil)
 }
 
-func (cc *SupplyChainChaincode) listProofsByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	// check role == Auditor
-	// list all proofs for Auditor's name
+//0		1			2
+//ID	InvoiceID	SecuredParty
+func (cc *SupplyChainChaincode) pledgeBillOfLading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// served only through the bridge, the trade-finance chaincode has checked the invoice
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Auditor}, stub); err != nil || !result {
-		message := fmt.Sprintf("this organizational unit is not allowed to get proofs by owner")
+	if err, result := checkAccessForRole([]string{roleSupplier, roleFactor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to pledge a bill of lading")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	//get owner
-	owner, err := GetCreatorOrganizationalUnit(stub)
+	if len(args) < 3 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	billOfLading := BillOfLading{}
+	if err := billOfLading.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &billOfLading, billOfLadingIndex) {
+		compositeKey, _ := billOfLading.ToCompositeKey(stub)
+		return pb.Response{Status: 404, Message: fmt.Sprintf("bill of lading with the key %s doesn't exist", compositeKey)}
+	}
+
+	if err := LoadFrom(stub, &billOfLading, billOfLadingIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
 		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	Logger.Debug("OrganizationalUnit: " + owner)
+	Logger.Debug("OrganizationalUnit: " + creator)
 
-	filterByOwner := func(data LedgerData) bool {
-		entity, ok := data.(*Proof)
-		if ok && entity.Value.Owner == owner {
-			return true
-		}
+	// invoices are registered under the ID of the supply-chain contract
+	invoiceID := args[1]
+	if billOfLading.Value.ContractID != invoiceID {
+		message := fmt.Sprintf("bill of lading %s isn't issued for the contract of invoice %s", billOfLading.Key.ID, invoiceID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
 
-		return false
+	securedParty := args[2]
+	allowed, err := UnitHasRole(stub, securedParty, billOfLadingSecuredParties...)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain roles of %s: %s", securedParty, err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
 	}
 
-	proofs := []Proof{}
-	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, filterByOwner)
+	if !allowed {
+		message := fmt.Sprintf("bill of lading cannot be pledged to %s", securedParty)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := CheckParticipant(stub, securedParty, ""); err != nil {
+		message := fmt.Sprintf("bill of lading cannot be pledged to %s: %s", securedParty, err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if err := billOfLading.Pledge(creator, securedParty, invoiceID, timestamp.Seconds); err != nil {
+		message := fmt.Sprintf("cannot pledge bill of lading: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := json.Marshal(proofs)
+	if bytes, err := json.Marshal(billOfLading); err == nil {
+		Logger.Debug("BillOfLading: " + string(bytes))
+	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	if err := UpdateOrInsertIn(stub, &billOfLading, billOfLadingIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = pledgeBillOfLading
+	eventValue := EventValue{}
+	eventValue.EntityType = billOfLadingIndex
+	eventValue.EntityID = billOfLading.Key.ID
+	eventValue.Other = billOfLading.Value
+	eventValue.Action = eventPledgeBillOfLading
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
 	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return shim.Success(nil)
 }
 
-//0
-//ShipmentID
-func (cc *SupplyChainChaincode) listProofsByShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+//0		1		2
+//ID	Name	IssuerPublicKey
+func (cc *SupplyChainChaincode) registerIssuerKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Auditor, Supplier, Buyer, TransportAgency}, stub); err != nil || !result {
-		message := fmt.Sprintf("this organizational unit is not allowed to get proofs by owner")
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to register an issuer key")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill an issuer key from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if ExistsIn(stub, &issuerKey, issuerKeyIndex) {
+		compositeKey, _ := issuerKey.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("issuer key with the key %s already exists", compositeKey))
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	// each issuer registers its key only once
+	issuerKeys, err := findIssuerKeysByOwner(stub, creator)
+	if err != nil {
+		message := fmt.Sprintf("cannot find issuer keys: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	shipmentID := args[0]
-	shipment := Shipment{}
-	if err := shipment.FillFromCompositeKeyParts([]string{shipmentID}); err != nil {
+	if len(issuerKeys) > 0 {
+		message := fmt.Sprintf("issuer key of %s is already registered: %s", creator, issuerKeys[0].Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// setting automatic values
+	issuerKey.Value.Owner = creator
+	issuerKey.Value.Timestamp = timestamp.Seconds
+	issuerKey.Value.UpdatedDate = issuerKey.Value.Timestamp
+
+	// updating state in ledger
+	if err := UpdateOrInsertIn(stub, &issuerKey, issuerKeyIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = registerIssuerKey
+	eventValue := EventValue{}
+	eventValue.EntityType = issuerKeyIndex
+	eventValue.EntityID = issuerKey.Key.ID
+	eventValue.Other = issuerKey.Value
+	eventValue.Action = eventRegisterIssuerKey
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+func (cc *SupplyChainChaincode) listIssuerKeys(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBuyer, roleSupplier, roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get issuer keys")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	issuerKeys := []IssuerKey{}
+	issuerKeysBytes, err := Query(stub, issuerKeyIndex, []string{}, CreateIssuerKey, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(issuerKeysBytes, &issuerKeys); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(issuerKeys)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1			2
+//IssuerID	PublicKey	CRI
+func (cc *SupplyChainChaincode) registerRevocationAuthority(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to register a revocation authority")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority := RevocationAuthority{}
+	if err := revocationAuthority.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a revocation authority from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if ExistsIn(stub, &revocationAuthority, revocationAuthorityIndex) {
+		compositeKey, _ := revocationAuthority.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("revocation authority with the key %s already exists", compositeKey))
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	issuerKey, err := loadIssuerKey(stub, revocationAuthority.Key.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load issuer key: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if issuerKey.Value.Owner != creator {
+		message := fmt.Sprintf("only the owner of the issuer key can register its revocation authority")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// setting automatic values
+	revocationAuthority.Value.Owner = creator
+	revocationAuthority.Value.RevokedHandles = []string{}
+	revocationAuthority.Value.Timestamp = timestamp.Seconds
+	revocationAuthority.Value.UpdatedDate = revocationAuthority.Value.Timestamp
+
+	// updating state in ledger
+	if err := UpdateOrInsertIn(stub, &revocationAuthority, revocationAuthorityIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = registerRevocationAuthority
+	eventValue := EventValue{}
+	eventValue.EntityType = revocationAuthorityIndex
+	eventValue.EntityID = revocationAuthority.Key.IssuerID
+	eventValue.Other = revocationAuthority.Value
+	eventValue.Action = eventRegisterRevocationAuthority
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0			1
+//IssuerID	CRI
+func (cc *SupplyChainChaincode) publishCRI(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to publish a CRI")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority, err := loadRevocationAuthority(stub, args[0])
+	if err != nil {
+		message := fmt.Sprintf("cannot load revocation authority: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if revocationAuthority.Value.Owner != creator {
+		message := fmt.Sprintf("only the revocation authority can publish its CRI")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := revocationAuthority.PublishCRI(args[1]); err != nil {
+		message := fmt.Sprintf("cannot publish CRI: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revokedHandles, err := findRevokedHandles(stub, revocationAuthority.Key.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot find revoked handles: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority.Value.RevokedHandles = []string{}
+	for _, revokedHandle := range revokedHandles {
+		revocationAuthority.Value.RevokedHandles = append(revocationAuthority.Value.RevokedHandles, revokedHandle.Key.Handle)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority.Value.UpdatedDate = timestamp.Seconds
+
+	// updating state in ledger
+	if err := UpdateOrInsertIn(stub, &revocationAuthority, revocationAuthorityIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = publishCRI
+	eventValue := EventValue{}
+	eventValue.EntityType = revocationAuthorityIndex
+	eventValue.EntityID = revocationAuthority.Key.IssuerID
+	eventValue.Other = revocationAuthority.Value
+	eventValue.Action = eventPublishCRI
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//ProofID
+func (cc *SupplyChainChaincode) revokeCredential(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to revoke a credential")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(args) < 1 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// checking proof exist
+	proof := Proof{}
+	if err := proof.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &proof, proofIndex) {
+		compositeKey, _ := proof.ToCompositeKey(stub)
+		message := fmt.Sprintf("proof with the key %s doesn't exist", compositeKey)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := LoadFrom(stub, &proof, proofIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthority, err := loadRevocationAuthority(stub, proof.Value.IssuerID)
+	if err != nil {
+		message := fmt.Sprintf("cannot load revocation authority: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if revocationAuthority.Value.Owner != creator {
+		message := fmt.Sprintf("only the revocation authority can revoke a credential")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revokedHandle := RevokedHandle{}
+	if err := revokedHandle.FillFromArguments(stub, []string{proof.Value.IssuerID, proof.Value.RevocationHandle}); err != nil {
+		message := fmt.Sprintf("cannot fill a revoked handle from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if revocationAuthority.IsRevoked(stub, revokedHandle.Key.Handle) {
+		message := fmt.Sprintf("credential of proof %s is already revoked", proof.Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revokedHandle.Value.ProofID = proof.Key.ID
+	revokedHandle.Value.Timestamp = timestamp.Seconds
+
+	// the proofs of the handle are refused right away, the next CRI lists it
+	if err := UpdateOrInsertIn(stub, &revokedHandle, revokedHandleIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = revokeCredential
+	eventValue := EventValue{}
+	eventValue.EntityType = proofIndex
+	eventValue.EntityID = proof.Key.ID
+	eventValue.Other = proof.Value
+	eventValue.Action = eventRevokeCredential
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+func (cc *SupplyChainChaincode) listRevocationAuthorities(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBuyer, roleSupplier, roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get revocation authorities")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	revocationAuthorities := []RevocationAuthority{}
+	revocationAuthoritiesBytes, err := Query(stub, revocationAuthorityIndex, []string{}, CreateRevocationAuthority, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(revocationAuthoritiesBytes, &revocationAuthorities); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(revocationAuthorities)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listOrders(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// list all of the orders in common channel
+	// (optional) filter entries by status
+	Notifier(stub, NoticeRuningType)
+	orders := []Order{}
+	ordersBytes, err := Query(stub, orderIndex, []string{}, CreateOrder, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(ordersBytes, &orders); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(orders)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listContracts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Buyer or Supplier
+	// list all of the contracts for the caller from all collections
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBuyer, roleSupplier}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	contracts := []Contract{}
+	contractsBytes, err := Query(stub, contractIndex, []string{}, CreateContract, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(contractsBytes, &contracts); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByContractsAndDocuments(stub, contracts)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by contract and document: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) reconcileContracts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor
+	// look up the invoice of every contract and report the mismatches
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to reconcile contracts")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	contracts := []Contract{}
+	contractsBytes, err := Query(stub, contractIndex, []string{}, CreateContract, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(contractsBytes, &contracts); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	report, err := ReconcileContracts(stub, contracts)
+	if err != nil {
+		message := fmt.Sprintf("unable to reconcile contracts: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1
+//From	To
+func (cc *SupplyChainChaincode) getSupplierPerformance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor, Buyer
+	// rate the suppliers by their deliveries and reports in the time window
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBuyer}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get supplier performance")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	window, err := ParseAnalyticsWindow(args)
+	if err != nil {
+		message := fmt.Sprintf("invalid time window: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	orders := []Order{}
+	contracts := []Contract{}
+	shipments := []Shipment{}
+	reports := []Report{}
+	for _, query := range []struct {
+		index   string
+		create  FactoryMethod
+		entries interface{}
+	}{
+		{orderIndex, CreateOrder, &orders},
+		{contractIndex, CreateContract, &contracts},
+		{shipmentIndex, CreateShipment, &shipments},
+		{reportIndex, CreateReport, &reports},
+	} {
+		entriesBytes, err := Query(stub, query.index, []string{}, query.create, EmptyFilter)
+		if err != nil {
+			message := fmt.Sprintf("unable to perform method: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+		if err := json.Unmarshal(entriesBytes, query.entries); err != nil {
+			message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	resultBytes, err := json.Marshal(SupplierPerformances(window, orders, contracts, shipments, reports))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1
+//From	To
+func (cc *SupplyChainChaincode) getTradeVolumes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor, Buyer, Supplier
+	// sum up the contracts signed in the time window by product and destination
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBuyer, roleSupplier}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get trade volumes")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	window, err := ParseAnalyticsWindow(args)
+	if err != nil {
+		message := fmt.Sprintf("invalid time window: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	contracts := []Contract{}
+	contractsBytes, err := Query(stub, contractIndex, []string{}, CreateContract, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(contractsBytes, &contracts); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(TradeVolumesOf(window, contracts))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+
+func (cc *SupplyChainChaincode) listProofs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor
+	// list all proofs for Auditor's name/id/etc
+	//checking role
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBuyer, roleSupplier, roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	proofs := []Proof{}
+	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(proofs)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listProofsByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor
+	// list all proofs for Auditor's name
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get proofs by owner")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//get owner
+	owner, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + owner)
+
+	filterByOwner := func(data LedgerData) bool {
+		entity, ok := data.(*Proof)
+		if ok && entity.Value.Owner == owner {
+			return true
+		}
+
+		return false
+	}
+
+	proofs := []Proof{}
+	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, filterByOwner)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(proofs)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//ShipmentID
+func (cc *SupplyChainChaincode) listProofsByShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleSupplier, roleBuyer, roleTransporter}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get proofs by owner")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	shipmentID := args[0]
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts([]string{shipmentID}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		compositeKey, _ := shipment.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("shipment with the key %s doesnt exist", compositeKey))
+	}
+
+	filterByShipment := func(data LedgerData) bool {
+		entity, ok := data.(*Proof)
+		if ok && entity.Value.ShipmentID == shipmentID {
+			return true
+		}
+
+		return false
+	}
+
+	proofs := []Proof{}
+	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, filterByShipment)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(proofs)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listReports(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// args: contract id
+	// list all Auditors' reports related to the contract
+	Notifier(stub, NoticeRuningType)
+
+	reports := []Report{}
+	reportsBytes, err := Query(stub, reportIndex, []string{}, CreateReport, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(reportsBytes, &reports); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByReportsAndDocuments(stub, reports)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by report and contract: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//ShipmentID
+func (cc *SupplyChainChaincode) listReportsByShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	shipmentID := args[0]
+	shipment := Shipment{}
+	if err := shipment.FillFromCompositeKeyParts([]string{shipmentID}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	if !ExistsIn(stub, &shipment, shipmentIndex) {
+		compositeKey, _ := shipment.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("shipment with the key %s doesnt exist", compositeKey))
+	}
+
+	filterByShipment := func(data LedgerData) bool {
+		entity, ok := data.(*Report)
+		if ok && entity.Value.ShipmentID == shipmentID {
+			return true
+		}
+
+		return false
+	}
+
+	reports := []Report{}
+	reportsBytes, err := Query(stub, reportIndex, []string{}, CreateReport, filterByShipment)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(reportsBytes, &reports); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByReportsAndDocuments(stub, reports)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by report and contract: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) listShipments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	shipments := []Shipment{}
+	shipmentsBytes, err := Query(stub, shipmentIndex, []string{}, CreateShipment, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(shipmentsBytes, &shipments); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByShipmentsAndContractsAndDocumentsAndEvents(stub, shipments)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by shipment and contract: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *SupplyChainChaincode) getConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get the config")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(config.Value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+func (cc *SupplyChainChaincode) getConfigHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get the config history")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	history, err := ConfigHistory(stub)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(history)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0			1
+//Config	Version
+func (cc *SupplyChainChaincode) updateConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to update the config")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	current := Config{}
+	if err := LoadFrom(stub, &current, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	// the version the update is based on guards against concurrent changes
+	version, err := strconv.Atoi(args[1])
+	if err != nil {
+		message := fmt.Sprintf("version is invalid: %s (must be int)", args[1])
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if version != current.Value.Version {
+		message := fmt.Sprintf("config is at version %d, cannot update version %d", current.Value.Version, version)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	config := Config{}
+	if err := json.Unmarshal([]byte(args[0]), &config.Value); err != nil {
+		message := fmt.Sprintf("input json is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := config.Validate(); err != nil {
+		message := fmt.Sprintf("config is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := config.CheckCollectionsDefined(stub); err != nil {
+		message := fmt.Sprintf("config is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if err := config.Save(stub, current.Value.Version+1, creator); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = updateConfig
+	eventValue := EventValue{}
+	eventValue.EntityType = configIndex
+	eventValue.EntityID = strconv.Itoa(config.Value.Version)
+	eventValue.Other = config.Value
+	eventValue.Action = eventUpdateConfig
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1		2
+//Role	Kind	Value
+func (cc *SupplyChainChaincode) grantRole(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to grant a role")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	member := RoleMember{}
+	if err := member.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a role member from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if member.Exists(stub) {
+		message := fmt.Sprintf("role %s is already granted to %s %s", member.Key.Role, member.Key.Kind, member.Key.Value)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	member.Value.GrantedBy = creator
+
+	if err := member.Save(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = grantRole
+	eventValue := EventValue{}
+	eventValue.EntityType = roleMemberIndex
+	eventValue.EntityID = member.Key.Role
+	eventValue.Other = member
+	eventValue.Action = eventGrantRole
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1		2
+//Role	Kind	Value
+func (cc *SupplyChainChaincode) revokeRole(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to revoke a role")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	member := RoleMember{}
+	if err := member.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !member.Exists(stub) {
+		message := fmt.Sprintf("role %s isn't granted to %s %s", member.Key.Role, member.Key.Kind, member.Key.Value)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the registry can't be left without an admin
+	if member.Key.Role == roleAdmin {
+		admins, err := FindRoleMembers(stub, roleAdmin)
+		if err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		if len(admins) < 2 {
+			message := fmt.Sprintf("cannot revoke the last member of role %s", roleAdmin)
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	if err := member.Delete(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = revokeRole
+	eventValue := EventValue{}
+	eventValue.EntityType = roleMemberIndex
+	eventValue.EntityID = member.Key.Role
+	eventValue.Other = member
+	eventValue.Action = eventRevokeRole
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//Role
+func (cc *SupplyChainChaincode) listRoleMembers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to list role members")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	role := ""
+	if len(args) > 0 {
+		role = args[0]
+	}
+
+	members, err := FindRoleMembers(stub, role)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(members)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+func (cc *SupplyChainChaincode) registerParticipant(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBank, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to register a participant")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	participant := Participant{}
+	if err := participant.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a participant from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//keeping the time the participant was first registered
+	existing := Participant{Key: participant.Key}
+	participant.Value.Timestamp = timestamp.Seconds
+	if ExistsIn(stub, &existing, participantIndex) {
+		if err := LoadFrom(stub, &existing, participantIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+		participant.Value.Timestamp = existing.Value.Timestamp
+	}
+
+	participant.Value.RegisteredBy = creator
+	participant.Value.UpdatedDate = timestamp.Seconds
+
+	if bytes, err := json.Marshal(participant); err == nil {
+		Logger.Debug("Participant: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &participant, participantIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = registerParticipant
+	eventValue := EventValue{}
+	eventValue.EntityType = participantIndex
+	eventValue.EntityID = participant.Key.OrganizationalUnit + "/" + participant.Key.MSPID
+	eventValue.Other = participant.Value
+	eventValue.Action = eventRegisterParticipant
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+func (cc *SupplyChainChaincode) listParticipants(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBank, roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to list participants")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	organizationalUnit := ""
+	if len(args) > 0 {
+		organizationalUnit = args[0]
+	}
+
+	participants, err := FindParticipants(stub, organizationalUnit)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(participants)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//eventID
+func (cc *SupplyChainChaincode) getEventPayload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	event := Event{}
+	if err := event.FillFromCompositeKeyParts(args[:eventKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf(err.Error())
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &event, eventIndex) {
+		compositeKey, _ := event.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("event with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &event, eventIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(event)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0				1			2		3		4		5	6			7
+//EntityType	EntityID	Action	Creator	From	To	PageSize	Bookmark
+func (cc *SupplyChainChaincode) listEvents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	filter, pageSize, bookmark, err := ParseEventFilter(args)
+	if err != nil {
+		message := fmt.Sprintf("invalid event filter: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	page, err := ListEvents(stub, filter, pageSize, bookmark)
+	if err != nil {
+		message := fmt.Sprintf("unable to list events: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//documentID
+func (cc *SupplyChainChaincode) getDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	document := Document{}
+	if err := document.FillFromCompositeKeyParts(args[:documentKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf(err.Error())
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &document, documentIndex) {
+		compositeKey, _ := document.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("document with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &document, documentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(document)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//ID
+func (cc *SupplyChainChaincode) getBillOfLading(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	billOfLading := BillOfLading{}
+	if err := billOfLading.FillFromCompositeKeyParts(args[:billOfLadingKeyFieldsNumber]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &billOfLading, billOfLadingIndex) {
+		compositeKey, _ := billOfLading.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("bill of lading with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &billOfLading, billOfLadingIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(billOfLading)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//argument order
+//0				1
+//EntityType	ID
+func (cc *SupplyChainChaincode) getEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least 2 items")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	policy, ok := endorsementPolicies[args[0]]
+	if !ok {
+		message := fmt.Sprintf("entity type %s has no endorsement policy", args[0])
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	entity := policy.Create()
+	if err := entity.FillFromCompositeKeyParts(args[1:2]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, entity, args[0]) {
+		compositeKey, _ := entity.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("entity with the key %s doesn't exist", compositeKey))
+	}
+
+	organizations, err := GetEndorsementOrganizations(stub, entity, args[0])
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(struct {
+		EntityType    string              `json:"entityType"`
+		EntityID      string              `json:"entityID"`
+		RoleType      statebased.RoleType `json:"roleType"`
+		Organizations []string            `json:"organizations"`
+	}{
+		EntityType:    args[0],
+		EntityID:      args[1],
+		RoleType:      policy.RoleType,
+		Organizations: organizations,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//argument order
+//0
+//BridgeRequest
+func (cc *SupplyChainChaincode) bridge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	request, bridgeError := ParseBridgeRequest(args)
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+
+	functionArgs, bridgeError := request.Arguments()
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+
+	// the policy of the function applies to the calls of the other chaincode as well
+	if err, result := checkAccessForPolicy(stub, request.Function, functionArgs); err != nil || !result {
+		return BridgeFailure(403, &BridgeError{Code: bridgeErrorDenied, Message: fmt.Sprintf("access to %s is denied by its policy", request.Function)})
+	}
+
+	var response pb.Response
+	switch request.Function {
+	case bridgeGetBillOfLading:
+		response = cc.getBillOfLading(stub, functionArgs)
+	case bridgePledgeBillOfLading:
+		response = cc.pledgeBillOfLading(stub, functionArgs)
+	default:
+		return BridgeFailure(404, &BridgeError{Code: bridgeErrorFunction, Message: fmt.Sprintf("function %s isn't served by %s", request.Function, chaincodeName)})
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return BridgeReply(response)
+}
+
+//0
+//DocumentHash
+func (cc *SupplyChainChaincode) verifyDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 1 || args[0] == "" {
+		message := fmt.Sprintf("documentHash must be not empty")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	verification := DocumentVerification{DocumentHash: args[0]}
+
+	documents, err := findDocumentByHash(stub, args[0])
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	if len(documents) != 0 {
+		verification.Registered = true
+		verification.Document = &documents[0]
+		verification.LatestID = documents[0].Key.ID
+
+		// following the version chain to the latest version
+		for documentID := documents[0].Key.ID; ; {
+			successors, err := findDocumentSuccessors(stub, documentID)
+			if err != nil {
+				message := fmt.Sprintf("persistence error: %s", err.Error())
+				Logger.Error(message)
+				return pb.Response{Status: 500, Message: message}
+			}
+
+			if len(successors) == 0 {
+				break
+			}
+
+			if !verification.Superseded {
+				verification.Superseded = true
+				verification.SupersededBy = successors[0].Key.ID
+			}
+			documentID = successors[0].Key.ID
+			verification.LatestID = documentID
+		}
+
+		// checking the signatures required for the document type
+		signatures, err := findDocumentSignatures(stub, documents[0])
+		if err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+		verification.Complete = signatures.Complete
+	}
+
+	result, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0				1
+//ContractID	Transition
+func (cc *SupplyChainChaincode) listMissingDocuments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	contract := Contract{}
+	if err := contract.FillFromCompositeKeyParts(args[:contractKeyFieldsNumber]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &contract, contractIndex) {
+		compositeKey, _ := contract.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("contract with the key %s doesnt exist", compositeKey))
+	}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	// all transitions with a checklist unless one is asked
+	transitions := []string{}
+	if len(args) > 1 && args[1] != "" {
+		if !checklistTransitions[args[1]] {
+			return shim.Error(fmt.Sprintf("unknown transition %s", args[1]))
+		}
+		transitions = append(transitions, args[1])
+	} else {
+		for _, checklist := range config.Value.Checklists {
+			transitions = append(transitions, checklist.Transition)
+		}
+	}
+
+	result := []MissingDocuments{}
+	for _, transition := range transitions {
+		missing, err := findMissingDocuments(stub, config, transition, contract.Key.ID, nil)
+		if err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		result = append(result, MissingDocuments{Transition: transition, Categories: missing})
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//DocumentID
+func (cc *SupplyChainChaincode) getDocumentSignatures(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	document := Document{}
+	if err := document.FillFromCompositeKeyParts(args[:documentKeyFieldsNumber]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &document, documentIndex) {
+		compositeKey, _ := document.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("document with the key %s doesn't exist", compositeKey))
+	}
+
+	if err := LoadFrom(stub, &document, documentIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	signatures, err := findDocumentSignatures(stub, document)
+	if err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
 	}
 
-	if !ExistsIn(stub, &shipment, shipmentIndex) {
-		compositeKey, _ := shipment.ToCompositeKey(stub)
-		return shim.Error(fmt.Sprintf("shipment with the key %s doesnt exist", compositeKey))
+	result, err := json.Marshal(signatures)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	filterByShipment := func(data LedgerData) bool {
-		entity, ok := data.(*Proof)
-		if ok && entity.Value.ShipmentID == shipmentID {
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+func findIssuerKeysByOwner(stub shim.ChaincodeStubInterface, owner string) ([]IssuerKey, error) {
+
+	filterByOwner := func(data LedgerData) bool {
+		entity, ok := data.(*IssuerKey)
+		if ok && entity.Value.Owner == owner {
 			return true
 		}
 
 		return false
 	}
 
-	proofs := []Proof{}
-	proofsBytes, err := Query(stub, proofIndex, []string{}, CreateProof, filterByShipment)
+	issuerKeys := []IssuerKey{}
+	issuerKeysBytes, err := Query(stub, issuerKeyIndex, []string{}, CreateIssuerKey, filterByOwner)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return issuerKeys, errors.New(message)
 	}
-	if err := json.Unmarshal(proofsBytes, &proofs); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if err := json.Unmarshal(issuerKeysBytes, &issuerKeys); err != nil {
+		message := fmt.Sprintf("unable to unmarshal issuer keys query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return issuerKeys, errors.New(message)
 	}
 
-	resultBytes, err := json.Marshal(proofs)
-
-	Logger.Debug("Result: " + string(resultBytes))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return issuerKeys, nil
 }
 
-func (cc *SupplyChainChaincode) listReports(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	// args: contract id
-	// list all Auditors' reports related to the contract
-	Notifier(stub, NoticeRuningType)
-
-	reports := []Report{}
-	reportsBytes, err := Query(stub, reportIndex, []string{}, CreateReport, EmptyFilter)
+func findRevokedHandles(stub shim.ChaincodeStubInterface, issuerID string) ([]RevokedHandle, error) {
+	revokedHandles := []RevokedHandle{}
+	revokedHandlesBytes, err := Query(stub, revokedHandleIndex, []string{issuerID}, CreateRevokedHandle, EmptyFilter)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return revokedHandles, errors.New(message)
 	}
-	if err := json.Unmarshal(reportsBytes, &reports); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if err := json.Unmarshal(revokedHandlesBytes, &revokedHandles); err != nil {
+		message := fmt.Sprintf("unable to unmarshal revoked handles query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return revokedHandles, errors.New(message)
 	}
 
-	resultBytes, err := joinByReportsAndDocuments(stub, reports)
-	if err != nil {
-		message := fmt.Sprintf("cannot join by report and contract: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
+	return revokedHandles, nil
+}
+
+func loadIssuerKey(stub shim.ChaincodeStubInterface, issuerID string) (IssuerKey, error) {
+	issuerKey := IssuerKey{}
+	if err := issuerKey.FillFromCompositeKeyParts([]string{issuerID}); err != nil {
+		return issuerKey, errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	if !ExistsIn(stub, &issuerKey, issuerKeyIndex) {
+		compositeKey, _ := issuerKey.ToCompositeKey(stub)
+		return issuerKey, errors.New(fmt.Sprintf("issuer key with the key %s doesn't exist", compositeKey))
+	}
 
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	if err := LoadFrom(stub, &issuerKey, issuerKeyIndex); err != nil {
+		return issuerKey, errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
+	}
+
+	return issuerKey, nil
 }
 
-//0
-//ShipmentID
-func (cc *SupplyChainChaincode) listReportsByShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+func loadRevocationAuthority(stub shim.ChaincodeStubInterface, issuerID string) (RevocationAuthority, error) {
+	revocationAuthority := RevocationAuthority{}
+	if err := revocationAuthority.FillFromCompositeKeyParts([]string{issuerID}); err != nil {
+		return revocationAuthority, errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
+	}
 
-	shipmentID := args[0]
-	shipment := Shipment{}
-	if err := shipment.FillFromCompositeKeyParts([]string{shipmentID}); err != nil {
-		message := fmt.Sprintf("persistence error: %s", err.Error())
-		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+	if !ExistsIn(stub, &revocationAuthority, revocationAuthorityIndex) {
+		compositeKey, _ := revocationAuthority.ToCompositeKey(stub)
+		return revocationAuthority, errors.New(fmt.Sprintf("revocation authority with the key %s doesn't exist", compositeKey))
 	}
 
-	if !ExistsIn(stub, &shipment, shipmentIndex) {
-		compositeKey, _ := shipment.ToCompositeKey(stub)
-		return shim.Error(fmt.Sprintf("shipment with the key %s doesnt exist", compositeKey))
+	if err := LoadFrom(stub, &revocationAuthority, revocationAuthorityIndex); err != nil {
+		return revocationAuthority, errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
 	}
 
-	filterByShipment := func(data LedgerData) bool {
-		entity, ok := data.(*Report)
-		if ok && entity.Value.ShipmentID == shipmentID {
+	return revocationAuthority, nil
+}
+
+func findDocumentByHash(stub shim.ChaincodeStubInterface, documentHash string) ([]Document, error) {
+
+	filterByDocumentHash := func(data LedgerData) bool {
+		entity, ok := data.(*Document)
+		if ok && entity.Value.DocumentHash == documentHash {
 			return true
 		}
 
 		return false
 	}
 
-	reports := []Report{}
-	reportsBytes, err := Query(stub, reportIndex, []string{}, CreateReport, filterByShipment)
+	documents := []Document{}
+	documentsBytes, err := Query(stub, documentIndex, []string{}, CreateDocument, filterByDocumentHash)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
-	}
-	if err := json.Unmarshal(reportsBytes, &reports); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
+		return documents, errors.New(message)
 	}
 
-	resultBytes, err := joinByReportsAndDocuments(stub, reports)
-	if err != nil {
-		message := fmt.Sprintf("cannot join by report and contract: %s", err.Error())
+	if err := json.Unmarshal(documentsBytes, &documents); err != nil {
+		message := fmt.Sprintf("unable to unmarshal documents query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return documents, errors.New(message)
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return documents, nil
 }
 
-func (cc *SupplyChainChaincode) listShipments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+// findBillOfLadingByShipment returns the bill of lading issued for the shipment or nil
+func findBillOfLadingByShipment(stub shim.ChaincodeStubInterface, shipmentID string) (*BillOfLading, error) {
 
-	shipments := []Shipment{}
-	shipmentsBytes, err := Query(stub, shipmentIndex, []string{}, CreateShipment, EmptyFilter)
+	filterByShipmentID := func(data LedgerData) bool {
+		entity, ok := data.(*BillOfLading)
+		if ok && entity.Value.ShipmentID == shipmentID {
+			return true
+		}
+
+		return false
+	}
+
+	billsOfLading := []BillOfLading{}
+	billsOfLadingBytes, err := Query(stub, billOfLadingIndex, []string{}, CreateBillOfLading, filterByShipmentID)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
-	}
-	if err := json.Unmarshal(shipmentsBytes, &shipments); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
+		return nil, errors.New(message)
 	}
 
-	resultBytes, err := joinByShipmentsAndContractsAndDocumentsAndEvents(stub, shipments)
-	if err != nil {
-		message := fmt.Sprintf("cannot join by shipment and contract: %s", err.Error())
+	if err := json.Unmarshal(billsOfLadingBytes, &billsOfLading); err != nil {
+		message := fmt.Sprintf("unable to unmarshal bills of lading query result: %s", err.Error())
 		Logger.Error(message)
-		return shim.Error(message)
+		return nil, errors.New(message)
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	if len(billsOfLading) == 0 {
+		return nil, nil
+	}
 
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return &billsOfLading[0], nil
 }
 
-//0
-//eventID
-func (cc *SupplyChainChaincode) getEventPayload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+func findDocumentSuccessors(stub shim.ChaincodeStubInterface, documentID string) ([]Document, error) {
 
-	event := Event{}
-	if err := event.FillFromCompositeKeyParts(args[:eventKeyFieldsNumber]); err != nil {
-		message := fmt.Sprintf(err.Error())
-		return pb.Response{Status: 404, Message: message}
-	}
+	filterByPreviousID := func(data LedgerData) bool {
+		entity, ok := data.(*Document)
+		if ok && entity.Value.PreviousID == documentID {
+			return true
+		}
 
-	if !ExistsIn(stub, &event, eventIndex) {
-		compositeKey, _ := event.ToCompositeKey(stub)
-		return shim.Error(fmt.Sprintf("event with the key %s doesn't exist", compositeKey))
+		return false
 	}
 
-	if err := LoadFrom(stub, &event, eventIndex); err != nil {
-		message := fmt.Sprintf("persistence error: %s", err.Error())
+	documents := []Document{}
+	documentsBytes, err := Query(stub, documentIndex, []string{}, CreateDocument, filterByPreviousID)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return documents, errors.New(message)
 	}
 
-	result, err := json.Marshal(event)
-	if err != nil {
-		return shim.Error(err.Error())
+	if err := json.Unmarshal(documentsBytes, &documents); err != nil {
+		message := fmt.Sprintf("unable to unmarshal documents query result: %s", err.Error())
+		Logger.Error(message)
+		return documents, errors.New(message)
 	}
 
-	Logger.Debug("Result: " + string(result))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(result)
+	return documents, nil
 }
 
-//0
-//documentID
-func (cc *SupplyChainChaincode) getDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+// findDocumentSignatures collects the signatures of a document and checks them
+// against the signature rules of its type
+func findDocumentSignatures(stub shim.ChaincodeStubInterface, document Document) (DocumentSignatures, error) {
+	result := DocumentSignatures{Document: document, Signatures: []Signature{}, Missing: []string{}}
 
-	document := Document{}
-	if err := document.FillFromCompositeKeyParts(args[:documentKeyFieldsNumber]); err != nil {
-		message := fmt.Sprintf(err.Error())
-		return pb.Response{Status: 404, Message: message}
+	signaturesBytes, err := Query(stub, signatureIndex, []string{document.Key.ID}, CreateSignature, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return result, errors.New(message)
 	}
 
-	if !ExistsIn(stub, &document, documentIndex) {
-		compositeKey, _ := document.ToCompositeKey(stub)
-		return shim.Error(fmt.Sprintf("document with the key %s doesn't exist", compositeKey))
+	if err := json.Unmarshal(signaturesBytes, &result.Signatures); err != nil {
+		message := fmt.Sprintf("unable to unmarshal signatures query result: %s", err.Error())
+		Logger.Error(message)
+		return result, errors.New(message)
 	}
 
-	if err := LoadFrom(stub, &document, documentIndex); err != nil {
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		return result, errors.New(message)
 	}
+	result.Required = config.RequiredSigners(document.Value)
 
-	result, err := json.Marshal(document)
-	if err != nil {
-		return shim.Error(err.Error())
+	signed := make(map[string]bool)
+	for _, signature := range result.Signatures {
+		// a signature made over another hash doesn't count
+		if signature.Value.DocumentHash == document.Value.DocumentHash {
+			signed[signature.Value.Role] = true
+		}
 	}
 
-	Logger.Debug("Result: " + string(result))
+	for _, role := range result.Required {
+		if !signed[role] {
+			result.Missing = append(result.Missing, role)
+		}
+	}
+	result.Complete = len(result.Missing) == 0
 
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(result)
+	return result, nil
 }
 
-func findDocumentByHash(stub shim.ChaincodeStubInterface, documentHash string) ([]Document, error) {
+// findMissingDocuments returns the categories required by the transition which the
+// contract has no document of; uploaded are categories of documents the transaction uploads
+func findMissingDocuments(stub shim.ChaincodeStubInterface, config Config, transition string, contractID string, uploaded []string) ([]string, error) {
+	missing := []string{}
 
-	filterByDocumentHash := func(data LedgerData) bool {
+	required := config.RequiredCategories(transition)
+	if len(required) == 0 {
+		return missing, nil
+	}
+
+	filterByContract := func(data LedgerData) bool {
 		entity, ok := data.(*Document)
-		if ok && entity.Value.DocumentHash == documentHash {
+		if ok && entity.Value.ContractID == contractID && entity.Value.Category != "" {
 			return true
 		}
 
@@ -2169,20 +4808,73 @@ func findDocumentByHash(stub shim.ChaincodeStubInterface, documentHash string) (
 	}
 
 	documents := []Document{}
-	documentsBytes, err := Query(stub, documentIndex, []string{}, CreateDocument, filterByDocumentHash)
+	documentsBytes, err := Query(stub, documentIndex, []string{}, CreateDocument, filterByContract)
 	if err != nil {
 		message := fmt.Sprintf("unable to perform method: %s", err.Error())
 		Logger.Error(message)
-		return documents, errors.New(message)
+		return missing, errors.New(message)
 	}
 
 	if err := json.Unmarshal(documentsBytes, &documents); err != nil {
 		message := fmt.Sprintf("unable to unmarshal documents query result: %s", err.Error())
 		Logger.Error(message)
-		return documents, errors.New(message)
+		return missing, errors.New(message)
 	}
 
-	return documents, nil
+	present := make(map[string]bool)
+	for _, document := range latestDocuments(documents) {
+		present[document.Value.Category] = true
+	}
+	for _, category := range uploaded {
+		present[category] = true
+	}
+
+	for _, category := range required {
+		if !present[category] {
+			missing = append(missing, category)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkRequiredDocuments fails when the contract lacks a document required by the transition;
+// uploaded are categories of documents the transaction uploads
+func checkRequiredDocuments(stub shim.ChaincodeStubInterface, transition string, contractID string, uploaded ...string) error {
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		return errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
+	}
+
+	missing, err := findMissingDocuments(stub, config, transition, contractID, uploaded)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) != 0 {
+		return errors.New(fmt.Sprintf("documents of categories %s are required", strings.Join(missing, ", ")))
+	}
+
+	return nil
+}
+
+// latestDocuments drops the versions superseded by another document of the list
+func latestDocuments(documents []Document) []Document {
+	superseded := make(map[string]bool)
+	for _, document := range documents {
+		if document.Value.PreviousID != "" {
+			superseded[document.Value.PreviousID] = true
+		}
+	}
+
+	result := []Document{}
+	for _, document := range documents {
+		if !superseded[document.Key.ID] {
+			result = append(result, document)
+		}
+	}
+
+	return result
 }
 
 func findReportByProofID(stub shim.ChaincodeStubInterface, proofID string) ([]Report, error) {
@@ -2213,30 +4905,16 @@ func findReportByProofID(stub shim.ChaincodeStubInterface, proofID string) ([]Re
 }
 
 func findEventByActionAndEntity(stub shim.ChaincodeStubInterface, action string, entityID string) ([]Event, error) {
-
-	filterByActionAndEntityID := func(data LedgerData) bool {
-		entity, ok := data.(*Event)
-		if ok && entity.Value.Action == action && entity.Value.EntityID == entityID {
-			return true
-		}
-		return false
+	events, err := FindEvents(stub, EventFilter{Action: action, EntityID: entityID})
+	if err == errEventsNotStored {
+		// the timeline stays empty without the events in state
+		return events, nil
 	}
-
-	events := []Event{}
-	eventsBytes, err := Query(stub, eventIndex, []string{}, CreateEvent, filterByActionAndEntityID)
 	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
-		Logger.Error(message)
-		return events, errors.New(message)
-	}
-
-	if err := json.Unmarshal(eventsBytes, &events); err != nil {
-		message := fmt.Sprintf("unable to unmarshal events query result: %s", err.Error())
-		Logger.Error(message)
-		return events, errors.New(message)
+		Logger.Error(err.Error())
 	}
 
-	return events, nil
+	return events, err
 }
 
 func findProofsByShipment(stub shim.ChaincodeStubInterface, shipmentID string) ([]Proof, error) {
@@ -2444,6 +5122,7 @@ func joinByShipmentsAndContractsAndDocumentsAndEvents(stub shim.ChaincodeStubInt
 			entry.Value.Contract.Value.Timestamp = contractValue.Timestamp
 			entry.Value.Contract.Value.UpdatedDate = contractValue.UpdatedDate
 			entry.Value.Contract.Value.Guarantor = contractValue.Guarantor
+			entry.Value.Contract.Value.Predicates = contractValue.Predicates
 			// find document
 			for _, documentID := range contractValue.Documents {
 				if documentValue, ok := documentMap[DocumentKey{ID: documentID}]; ok {
@@ -2618,6 +5297,8 @@ func joinByContractsAndDocuments(stub shim.ChaincodeStubInterface, arrayContract
 				ProductName:   contract.Value.ProductName,
 				ConsignorName: contract.Value.ConsignorName,
 				ConsigneeName: contract.Value.ConsigneeName,
+				ConsignorMSP:  contract.Value.ConsignorMSP,
+				ConsigneeMSP:  contract.Value.ConsigneeMSP,
 				TotalDue:      contract.Value.TotalDue,
 				Quantity:      contract.Value.Quantity,
 				Destination:   contract.Value.Destination,
@@ -2627,6 +5308,7 @@ func joinByContractsAndDocuments(stub shim.ChaincodeStubInterface, arrayContract
 				Timestamp:     contract.Value.Timestamp,
 				UpdatedDate:   contract.Value.UpdatedDate,
 				Guarantor:     contract.Value.Guarantor,
+				Predicates:    contract.Value.Predicates,
 			},
 		}
 
@@ -2743,41 +5425,13 @@ func joinByReportsAndDocuments(stub shim.ChaincodeStubInterface, reports []Repor
 	return resultBytes, nil
 }
 
-func encode(publicKey *ecdsa.PublicKey) string {
-	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
-	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
-
-	return string(pemEncodedPub)
-}
-
-func decode(pemEncodedPub string) *ecdsa.PublicKey {
-	blockPub, _ := pem.Decode([]byte(pemEncodedPub))
-	x509EncodedPub := blockPub.Bytes
-	genericPublicKey, _ := x509.ParsePKIXPublicKey(x509EncodedPub)
-	publicKey := genericPublicKey.(*ecdsa.PublicKey)
-
-	return publicKey
-}
-
-func checkAccessForUnit(allowedUnits [][]string, stub shim.ChaincodeStubInterface) (error, bool) {
-
-	orgUnit, err := GetCreatorOrganizationalUnit(stub)
+func checkAccessForRole(allowedRoles []string, stub shim.ChaincodeStubInterface) (error, bool) {
+	result, err := HasRole(stub, allowedRoles...)
 	if err != nil {
-		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		message := fmt.Sprintf("cannot obtain creator's roles: %s", err.Error())
 		Logger.Error(message)
 		return errors.New(message), false
 	}
-	Logger.Debug("OrganizationalUnit: " + orgUnit)
-
-	result := false
-
-	for _, value := range allowedUnits {
-		for _, role := range value {
-			if role == orgUnit {
-				result = true
-			}
-		}
-	}
 
 	return nil, result
 }
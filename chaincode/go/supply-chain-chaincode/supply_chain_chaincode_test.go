@@ -0,0 +1,2186 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/idemix"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"supply-chain-chaincode/proofbuilder"
+	"supply-chain-chaincode/rangeproof"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuerID   = "6c1a7c4e-93a5-4fa1-8f0a-1bd2d0b6a9e1"
+	testShipmentID = "0f3f4a63-2e36-4f5e-9b38-1a4c0c5b7d21"
+	testProofID    = "9a2b6f0e-7d0c-4c48-8a8f-5b1e4f7c3d10"
+	testContractID = "2d7e5b1c-4a8f-4e3b-b6d2-9c0f1a7e5b34"
+	testQuantity   = 150
+	testLEI        = "5493001KJTIIGC8Y1R12"
+)
+
+// creatorStub adds the creator certificate missing in shim.MockStub
+type creatorStub struct {
+	*shim.MockStub
+	creator []byte
+	key     *ecdsa.PrivateKey
+}
+
+func (stub *creatorStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages the keys the way the peer does, shim.MockStub
+// doesn't implement it
+func (stub *creatorStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+
+	it, err := stub.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+
+	page := &pageIterator{}
+	metadata := &pb.QueryResponseMetadata{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if kv.Key < bookmark {
+			continue
+		}
+
+		if metadata.FetchedRecordsCount == pageSize {
+			metadata.Bookmark = kv.Key
+			break
+		}
+
+		page.kvs = append(page.kvs, kv)
+		metadata.FetchedRecordsCount++
+	}
+
+	return page, metadata, nil
+}
+
+type pageIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *pageIterator) HasNext() bool {
+	return len(it.kvs) != 0
+}
+
+func (it *pageIterator) Next() (*queryresult.KV, error) {
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *pageIterator) Close() error {
+	return nil
+}
+
+func newCreatorStub(t *testing.T, stub *shim.MockStub, mspID string, organizationalUnit string) *creatorStub {
+	creator, key := newCreator(t, mspID, organizationalUnit)
+
+	return &creatorStub{stub, creator, key}
+}
+
+func newCreator(t *testing.T, mspID string, organizationalUnit string) ([]byte, *ecdsa.PrivateKey) {
+	return newCreatorWithAttributes(t, mspID, organizationalUnit, nil)
+}
+
+// newCreatorWithAttributes issues the certificate with the attributes the way the Fabric CA does
+func newCreatorWithAttributes(t *testing.T, mspID string, organizationalUnit string, attributes map[string]string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := pkix.Name{CommonName: organizationalUnit, Organization: []string{mspID}, OrganizationalUnit: []string{organizationalUnit}}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      name,
+		Issuer:       name,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	if attributes != nil {
+		value, err := json.Marshal(map[string]map[string]string{"attrs": attributes})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: value}}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return creator, key
+}
+
+type chaincodeFixture struct {
+	cc       *SupplyChainChaincode
+	stub     *shim.MockStub
+	supplier *creatorStub
+	buyer    *creatorStub
+	auditor  *creatorStub
+	tx       int
+}
+
+func (fixture *chaincodeFixture) invoke(stub *creatorStub, function func(shim.ChaincodeStubInterface, []string) pb.Response, args ...string) pb.Response {
+	fixture.tx++
+	fixture.stub.MockTransactionStart(fmt.Sprintf("tx%d", fixture.tx))
+	defer fixture.stub.MockTransactionEnd(fmt.Sprintf("tx%d", fixture.tx))
+
+	return function(stub, args)
+}
+
+// transientStub adds the transient map missing in shim.MockStub
+type transientStub struct {
+	*creatorStub
+	transient map[string][]byte
+}
+
+func (stub *transientStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (fixture *chaincodeFixture) invokeWithTransient(stub *creatorStub, transient map[string]string, function func(shim.ChaincodeStubInterface, []string) pb.Response, args ...string) pb.Response {
+	fixture.tx++
+	fixture.stub.MockTransactionStart(fmt.Sprintf("tx%d", fixture.tx))
+	defer fixture.stub.MockTransactionEnd(fmt.Sprintf("tx%d", fixture.tx))
+
+	transientMap := make(map[string][]byte)
+	for key, value := range transient {
+		transientMap[key] = []byte(value)
+	}
+
+	return function(&transientStub{stub, transientMap}, args)
+}
+
+// put stores the entity the way the handlers would have left it
+func (fixture *chaincodeFixture) put(t *testing.T, entity LedgerData, index string) {
+	fixture.tx++
+	fixture.stub.MockTransactionStart(fmt.Sprintf("tx%d", fixture.tx))
+	defer fixture.stub.MockTransactionEnd(fmt.Sprintf("tx%d", fixture.tx))
+
+	if err := UpdateOrInsertIn(fixture.supplier, entity, index, []string{""}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putTestContract stores the contract of testQuantity the supplier and the buyer signed
+func (fixture *chaincodeFixture) putTestContract(t *testing.T) {
+	contract := Contract{}
+	contract.Key.ID = testContractID
+	contract.Value.ConsignorName = "Supplier"
+	contract.Value.ConsigneeName = "Buyer"
+	contract.Value.Quantity = testQuantity
+	contract.Value.State = stateContractSigned
+	fixture.put(t, &contract, contractIndex)
+}
+
+// putTestShipment stores the confirmed shipment of the test contract
+func (fixture *chaincodeFixture) putTestShipment(t *testing.T) {
+	shipment := Shipment{}
+	shipment.Key.ID = testShipmentID
+	shipment.Value.ContractID = testContractID
+	shipment.Value.Consignor = "Supplier"
+	shipment.Value.State = stateShipmentConfirmed
+	fixture.put(t, &shipment, shipmentIndex)
+}
+
+// newChaincodeFixture initializes the chaincode with the init arguments which follow
+// the collections and the chaincode name
+func newChaincodeFixture(t *testing.T, initArgs ...string) *chaincodeFixture {
+	cc := new(SupplyChainChaincode)
+	stub := shim.NewMockStub("SupplyChainChaincode", cc)
+	args := [][]byte{[]byte("init"), []byte("[]"), []byte("supply-chain-chaincode")}
+	for _, arg := range initArgs {
+		args = append(args, []byte(arg))
+	}
+
+	if response := stub.MockInit("1", args); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	fixture := &chaincodeFixture{
+		cc:       cc,
+		stub:     stub,
+		supplier: newCreatorStub(t, stub, "ORG2MSP", "Supplier"),
+		buyer:    newCreatorStub(t, stub, "ORG1MSP", "Buyer"),
+		auditor:  newCreatorStub(t, stub, "ORG4MSP", "Auditor-1"),
+	}
+
+	return fixture
+}
+
+// proofFixture adds an Idemix issuer and the credential it issued to the supplier
+type proofFixture struct {
+	*chaincodeFixture
+	issuer          *creatorStub
+	issuerKey       *idemix.IssuerKey
+	revocationKey   *ecdsa.PrivateKey
+	credential      *proofbuilder.Credential
+	attributeValues []string
+	blinding        []byte
+}
+
+// submitProof passes the proof to generateProof or updateProof in the transient map
+func (fixture *proofFixture) submitProof(function string, proof string, args ...string) pb.Response {
+	functions := map[string]func(shim.ChaincodeStubInterface, []string) pb.Response{
+		"generateProof": fixture.cc.generateProof,
+		"updateProof":   fixture.cc.updateProof,
+	}
+
+	return fixture.invokeWithTransient(fixture.supplier, map[string]string{function: fmt.Sprintf(`{"proof":%s}`, proof)}, functions[function], args...)
+}
+
+func (fixture *proofFixture) cri(t *testing.T, epoch int) string {
+	rng, err := idemix.GetRand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cri, err := idemix.CreateCRI(fixture.revocationKey, nil, epoch, idemix.ALG_NO_REVOCATION, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	criBytes, err := json.Marshal(cri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(criBytes)
+}
+
+func (fixture *proofFixture) buildProof(t *testing.T, proofID string, epoch int, attributes []proofbuilder.Attribute, predicates ...rangeproof.Predicate) string {
+	cri := &idemix.CredentialRevocationInformation{}
+	if err := json.Unmarshal([]byte(fixture.cri(t, epoch)), cri); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := proofbuilder.BuildProof(fixture.issuerKey.Ipk, fixture.credential, attributes, cri, []byte(proofID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, predicate := range predicates {
+		if err := proof.AddPredicate(fixture.issuerKey.Ipk, predicate, testQuantity, fixture.blinding); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proofBytes, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(proofBytes)
+}
+
+func newProofFixture(t *testing.T) *proofFixture {
+	// the quantity is certified as a commitment, so that only predicates over it are revealed
+	_, quantity, blinding, err := rangeproof.Commit(testQuantity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := &proofFixture{
+		chaincodeFixture: newChaincodeFixture(t),
+		attributeValues:  []string{"Ethiopia", "FairTrade-2019-0042", quantity},
+		blinding:         blinding,
+	}
+	cc := fixture.cc
+
+	// the certifying auditor issues the credential, not the supplier it certifies
+	fixture.issuer = newCreatorStub(t, fixture.stub, "ORG4MSP", "Auditor-2")
+	issuerKey, err := proofbuilder.NewIssuerKey([]string{"origin", "certificate", "quantity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.issuerKey = issuerKey
+
+	ipkBytes, err := json.Marshal(issuerKey.Ipk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := fixture.invoke(fixture.issuer, cc.registerIssuerKey, testIssuerID, "Auditor-2", string(ipkBytes)); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	revocationKey, err := idemix.GenerateLongTermRevocationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.revocationKey = revocationKey
+
+	revocationPublicKey, err := x509.MarshalPKIXPublicKey(&revocationKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := fixture.invoke(fixture.issuer, cc.registerRevocationAuthority, testIssuerID,
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: revocationPublicKey})), fixture.cri(t, 0)); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	// credential issuance happens off the ledger
+	sk, request, err := proofbuilder.NewCredentialRequest(issuerKey.Ipk, []byte("nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := proofbuilder.IssueCredential(issuerKey, request, fixture.attributeValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.credential = &proofbuilder.Credential{Cred: cred, Sk: sk}
+
+	// the contract and the shipment the proof is generated for
+	fixture.putTestContract(t)
+	fixture.putTestShipment(t)
+
+	return fixture
+}
+
+func (fixture *proofFixture) attributes(disclosed bool) []proofbuilder.Attribute {
+	return []proofbuilder.Attribute{
+		{Name: "origin", Value: fixture.attributeValues[0], Disclosed: disclosed},
+		{Name: "certificate", Value: fixture.attributeValues[1], Disclosed: false},
+		{Name: "quantity", Value: fixture.attributeValues[2], Disclosed: true},
+	}
+}
+
+func TestProofRoundTrip(t *testing.T) {
+	fixture := newProofFixture(t)
+	cc := fixture.cc
+
+	proof := fixture.buildProof(t, testProofID, 0, fixture.attributes(true))
+	if response := fixture.submitProof("generateProof", proof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status != shim.OK {
+		t.Fatalf("generateProof failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.auditor, cc.verifyProof, testProofID, fmt.Sprint(stateReportAccepted), "", ""); response.Status != shim.OK {
+		t.Fatalf("verifyProof failed: %s", response.Message)
+	}
+
+	stored := Proof{Key: ProofKey{ID: testProofID}}
+	if err := LoadFrom(fixture.auditor, &stored, proofIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Value.State != stateProofValidated {
+		t.Errorf("expected proof state %d, got %d", stateProofValidated, stored.Value.State)
+	}
+
+	if stored.Value.DataForVerification.AttributeValues[0] != fixture.attributeValues[0] || stored.Value.DataForVerification.AttributeValues[1] != "" {
+		t.Errorf("only the disclosed attribute must be stored, got %v", stored.Value.DataForVerification.AttributeValues)
+	}
+}
+
+func TestSupplierCannotIssueItsOwnCredentials(t *testing.T) {
+	fixture := newProofFixture(t)
+
+	issuerKey, err := proofbuilder.NewIssuerKey([]string{"origin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ipkBytes, err := json.Marshal(issuerKey.Ipk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := fixture.invoke(fixture.supplier, fixture.cc.registerIssuerKey, "3c8e1f4a-7b2d-4e9c-a5f0-6d1b8e2c4a97", "Supplier", string(ipkBytes)); response.Status == shim.OK {
+		t.Fatal("registerIssuerKey succeeded for the supplier")
+	}
+}
+
+func TestProofWithForgedAttributeIsRejected(t *testing.T) {
+	fixture := newProofFixture(t)
+
+	proofBytes := fixture.buildProof(t, testProofID, 0, fixture.attributes(true))
+
+	proof := proofbuilder.Proof{}
+	if err := json.Unmarshal([]byte(proofBytes), &proof); err != nil {
+		t.Fatal(err)
+	}
+	proof.DataForVerification.AttributeValues[0] = "Kenya"
+	forged, _ := json.Marshal(proof)
+
+	if response := fixture.submitProof("generateProof", string(forged), testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status == shim.OK {
+		t.Fatal("generateProof accepted a forged attribute")
+	}
+}
+
+func TestProofForAnotherIDIsRejected(t *testing.T) {
+	fixture := newProofFixture(t)
+
+	proof := fixture.buildProof(t, "3e0c8d5a-1b7f-4a2e-9c61-7d4b2f8e0a35", 0, fixture.attributes(true))
+	if response := fixture.submitProof("generateProof", proof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status == shim.OK {
+		t.Fatal("generateProof accepted a proof signed for another ID")
+	}
+}
+
+func TestProofOfRevokedCredentialIsRejected(t *testing.T) {
+	fixture := newProofFixture(t)
+	cc := fixture.cc
+
+	proof := fixture.buildProof(t, testProofID, 0, fixture.attributes(false))
+	if response := fixture.submitProof("generateProof", proof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status != shim.OK {
+		t.Fatalf("generateProof failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.revokeCredential, testProofID); response.Status == shim.OK {
+		t.Fatal("revokeCredential succeeded for the supplier")
+	}
+
+	if response := fixture.invoke(fixture.issuer, cc.revokeCredential, testProofID); response.Status != shim.OK {
+		t.Fatalf("revokeCredential failed: %s", response.Message)
+	}
+
+	// the event carries the proof it names
+	var event *pb.ChaincodeEvent
+	for len(fixture.stub.ChaincodeEventsChannel) > 0 {
+		event = <-fixture.stub.ChaincodeEventsChannel
+	}
+
+	payload := EventPayload{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil || len(payload.Events) != 1 {
+		t.Fatalf("unexpected chaincode event %v", event)
+	}
+
+	snapshot, ok := payload.Events[0].Value.Other.(map[string]interface{})
+	if !ok || payload.Events[0].Value.EntityType != proofIndex || snapshot["issuerID"] != testIssuerID {
+		t.Errorf("revokeCredential event doesn't carry the proof: %+v", payload.Events[0])
+	}
+
+	if response := fixture.invoke(fixture.issuer, cc.revokeCredential, testProofID); response.Status == shim.OK {
+		t.Fatal("revokeCredential revoked a credential twice")
+	}
+
+	if response := fixture.invoke(fixture.auditor, cc.verifyProof, testProofID, fmt.Sprint(stateReportAccepted), "", ""); response.Status == shim.OK {
+		t.Fatal("verifyProof accepted a proof of a revoked credential")
+	}
+
+	// the next CRI lists the revoked handle
+	if response := fixture.invoke(fixture.issuer, cc.publishCRI, testIssuerID, fixture.cri(t, 1)); response.Status != shim.OK {
+		t.Fatalf("publishCRI failed: %s", response.Message)
+	}
+
+	stored := Proof{Key: ProofKey{ID: testProofID}}
+	if err := LoadFrom(fixture.auditor, &stored, proofIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	revocationAuthority := RevocationAuthority{Key: RevocationAuthorityKey{IssuerID: testIssuerID}}
+	if err := LoadFrom(fixture.auditor, &revocationAuthority, revocationAuthorityIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	if handles := revocationAuthority.Value.RevokedHandles; len(handles) != 1 || handles[0] != stored.Value.RevocationHandle {
+		t.Errorf("expected the CRI to list %s, got %v", stored.Value.RevocationHandle, handles)
+	}
+
+	// a proof of the same credential signed for the new epoch is still revoked
+	proof = fixture.buildProof(t, testProofID, 1, fixture.attributes(false))
+	if response := fixture.submitProof("updateProof", proof, testProofID); response.Status == shim.OK {
+		t.Fatal("updateProof accepted a revoked credential")
+	}
+}
+
+func TestPredicateProofSatisfiesContract(t *testing.T) {
+	fixture := newProofFixture(t)
+	cc := fixture.cc
+
+	if response := fixture.invoke(fixture.buyer, cc.setContractPredicates, testContractID, `[{"attribute":"quantity","operator":">=","bound":100}]`); response.Status != shim.OK {
+		t.Fatalf("setContractPredicates failed: %s", response.Message)
+	}
+
+	// a stronger predicate implies the required one
+	proof := fixture.buildProof(t, testProofID, 0, fixture.attributes(false), rangeproof.Predicate{Attribute: "quantity", Operator: ">=", Bound: 120})
+	if response := fixture.submitProof("generateProof", proof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status != shim.OK {
+		t.Fatalf("generateProof failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.auditor, cc.verifyProof, testProofID, fmt.Sprint(stateReportAccepted), "", ""); response.Status != shim.OK {
+		t.Fatalf("verifyProof failed: %s", response.Message)
+	}
+
+	stored := Proof{Key: ProofKey{ID: testProofID}}
+	if err := LoadFrom(fixture.auditor, &stored, proofIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Value.Type != proofTypePredicate {
+		t.Errorf("expected proof type %d, got %d", proofTypePredicate, stored.Value.Type)
+	}
+}
+
+func TestProofMissingRequiredPredicateIsRejected(t *testing.T) {
+	fixture := newProofFixture(t)
+	cc := fixture.cc
+
+	if response := fixture.invoke(fixture.buyer, cc.setContractPredicates, testContractID, `[{"attribute":"quantity","operator":">=","bound":100}]`); response.Status != shim.OK {
+		t.Fatalf("setContractPredicates failed: %s", response.Message)
+	}
+
+	proof := fixture.buildProof(t, testProofID, 0, fixture.attributes(false), rangeproof.Predicate{Attribute: "quantity", Operator: ">=", Bound: 50})
+	if response := fixture.submitProof("generateProof", proof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status != shim.OK {
+		t.Fatalf("generateProof failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.auditor, cc.verifyProof, testProofID, fmt.Sprint(stateReportAccepted), "", ""); response.Status == shim.OK {
+		t.Fatal("verifyProof accepted a proof missing the predicate required by the contract")
+	}
+}
+
+func TestPredicateProofWithAlteredBoundIsRejected(t *testing.T) {
+	fixture := newProofFixture(t)
+
+	proofBytes := fixture.buildProof(t, testProofID, 0, fixture.attributes(false), rangeproof.Predicate{Attribute: "quantity", Operator: ">=", Bound: 100})
+
+	proof := proofbuilder.Proof{}
+	if err := json.Unmarshal([]byte(proofBytes), &proof); err != nil {
+		t.Fatal(err)
+	}
+	proof.PredicateProofs[0].Predicate.Bound = 200
+	forged, _ := json.Marshal(proof)
+
+	if response := fixture.submitProof("generateProof", string(forged), testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status == shim.OK {
+		t.Fatal("generateProof accepted a predicate proof with an altered bound")
+	}
+
+	// the holder can't prove a predicate the committed value doesn't satisfy
+	if _, err := rangeproof.Prove(rangeproof.Predicate{Attribute: "quantity", Operator: ">=", Bound: testQuantity + 1}, testQuantity, fixture.blinding, []byte(testProofID)); err == nil {
+		t.Fatal("Prove accepted a false predicate")
+	}
+}
+
+func TestDocumentVersionChain(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.putTestContract(t)
+	cc := fixture.cc
+
+	const (
+		firstID  = "5b0d3c7e-8f1a-4b2c-9d3e-4f5a6b7c8d90"
+		secondID = "7c1e4d8f-9a2b-4c3d-8e4f-5a6b7c8d9e01"
+	)
+
+	if response := fixture.invoke(fixture.supplier, cc.uploadDocument, firstID, fmt.Sprint(TypeContract), testContractID, "hash-1", "meta", fmt.Sprint(DocTypePDF), testContractID); response.Status != shim.OK {
+		t.Fatalf("uploadDocument failed: %s", response.Message)
+	}
+
+	// only the owner can supersede a document
+	if response := fixture.invoke(fixture.buyer, cc.updateDocument, secondID, firstID, "hash-2", "meta", fmt.Sprint(DocTypePDF)); response.Status == shim.OK {
+		t.Fatal("updateDocument accepted a version from another party")
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.updateDocument, secondID, firstID, "hash-2", "meta", fmt.Sprint(DocTypePDF)); response.Status != shim.OK {
+		t.Fatalf("updateDocument failed: %s", response.Message)
+	}
+
+	// the chain can't fork from a superseded version
+	if response := fixture.invoke(fixture.supplier, cc.updateDocument, "8d2f5e9a-0b3c-4d4e-9f5a-6b7c8d9e0f12", firstID, "hash-3", "meta", fmt.Sprint(DocTypePDF)); response.Status == shim.OK {
+		t.Fatal("updateDocument superseded a document twice")
+	}
+
+	verify := func(hash string) DocumentVerification {
+		response := fixture.invoke(fixture.auditor, cc.verifyDocument, hash)
+		if response.Status != shim.OK {
+			t.Fatalf("verifyDocument failed: %s", response.Message)
+		}
+
+		verification := DocumentVerification{}
+		if err := json.Unmarshal(response.Payload, &verification); err != nil {
+			t.Fatal(err)
+		}
+
+		return verification
+	}
+
+	if first := verify("hash-1"); !first.Registered || !first.Superseded || first.SupersededBy != secondID || first.Document.Value.Owner != "Supplier" {
+		t.Errorf("unexpected verification of the first version: %+v", first)
+	}
+
+	if second := verify("hash-2"); !second.Registered || second.Superseded || second.Document.Value.Version != 2 || second.Document.Value.PreviousID != firstID {
+		t.Errorf("unexpected verification of the second version: %+v", second)
+	}
+
+	if unknown := verify("hash-4"); unknown.Registered {
+		t.Errorf("unknown hash is reported as registered")
+	}
+}
+
+func signHash(t *testing.T, key *ecdsa.PrivateKey, documentHash string) string {
+	digest := sha256.Sum256([]byte(documentHash))
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+// newSignatureFixture requires the signatures of the supplier and the buyer on PDF documents
+func newSignatureFixture(t *testing.T) *chaincodeFixture {
+	signatureRules := fmt.Sprintf(`[{"documentType":%d,"signers":["Supplier","Buyer"]}]`, DocTypePDF)
+
+	return newChaincodeFixture(t, signatureRules)
+}
+
+func TestDocumentSignaturesComplete(t *testing.T) {
+	fixture := newSignatureFixture(t)
+	fixture.putTestContract(t)
+	cc := fixture.cc
+
+	const documentID = "5b0d3c7e-8f1a-4b2c-9d3e-4f5a6b7c8d90"
+
+	if response := fixture.invoke(fixture.supplier, cc.uploadDocument, documentID, fmt.Sprint(TypeContract), testContractID, "hash-1", "meta", fmt.Sprint(DocTypePDF), testContractID); response.Status != shim.OK {
+		t.Fatalf("uploadDocument failed: %s", response.Message)
+	}
+
+	signatures := func() DocumentSignatures {
+		response := fixture.invoke(fixture.auditor, cc.getDocumentSignatures, documentID)
+		if response.Status != shim.OK {
+			t.Fatalf("getDocumentSignatures failed: %s", response.Message)
+		}
+
+		result := DocumentSignatures{}
+		if err := json.Unmarshal(response.Payload, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.signDocument, documentID, signHash(t, fixture.supplier.key, "hash-1")); response.Status != shim.OK {
+		t.Fatalf("signDocument failed: %s", response.Message)
+	}
+
+	if result := signatures(); result.Complete || len(result.Missing) != 1 || result.Missing[0] != "Buyer" {
+		t.Errorf("expected the buyer signature to be missing, got %+v", result.Missing)
+	}
+
+	// a signature made with another key or over another hash is rejected
+	if response := fixture.invoke(fixture.buyer, cc.signDocument, documentID, signHash(t, fixture.supplier.key, "hash-1")); response.Status == shim.OK {
+		t.Fatal("signDocument accepted a signature made with another key")
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.signDocument, documentID, signHash(t, fixture.buyer.key, "hash-2")); response.Status == shim.OK {
+		t.Fatal("signDocument accepted a signature over another hash")
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.signDocument, documentID, signHash(t, fixture.buyer.key, "hash-1")); response.Status != shim.OK {
+		t.Fatalf("signDocument failed: %s", response.Message)
+	}
+
+	if result := signatures(); !result.Complete || len(result.Signatures) != 2 {
+		t.Errorf("expected complete signatures, got %+v", result)
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.signDocument, documentID, signHash(t, fixture.buyer.key, "hash-1")); response.Status == shim.OK {
+		t.Fatal("signDocument accepted a second signature of the same party")
+	}
+}
+
+// newChecklistFixture requires a PDF bill of lading to confirm a shipment
+func newChecklistFixture(t *testing.T) *chaincodeFixture {
+	documentCategories := fmt.Sprintf(`[{"code":"billOfLading","name":"Bill of lading","formats":[%d]}]`, DocTypePDF)
+	checklists := `[{"transition":"confirmShipment","categories":["billOfLading"]}]`
+
+	return newChaincodeFixture(t, "[]", documentCategories, checklists)
+}
+
+func TestConfirmShipmentRequiresChecklistDocuments(t *testing.T) {
+	fixture := newChecklistFixture(t)
+	fixture.putTestContract(t)
+	cc := fixture.cc
+	transporter := newCreatorStub(t, fixture.stub, "ORG3MSP", "Transporter")
+
+	const shipmentID = "3f6a9c2e-1d4b-4e7a-8c5f-0b2d4e6f8a13"
+
+	shipment := Shipment{}
+	shipment.Key.ID = shipmentID
+	shipment.Value.ContractID = testContractID
+	shipment.Value.Consignor = "Supplier"
+	shipment.Value.State = stateShipmentRequested
+
+	fixture.put(t, &shipment, shipmentIndex)
+
+	missing := func() []MissingDocuments {
+		response := fixture.invoke(fixture.buyer, cc.listMissingDocuments, testContractID, "confirmShipment")
+		if response.Status != shim.OK {
+			t.Fatalf("listMissingDocuments failed: %s", response.Message)
+		}
+
+		result := []MissingDocuments{}
+		if err := json.Unmarshal(response.Payload, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	if result := missing(); len(result) != 1 || len(result[0].Categories) != 1 || result[0].Categories[0] != "billOfLading" {
+		t.Fatalf("expected a missing bill of lading, got %+v", result)
+	}
+
+	if response := fixture.invoke(transporter, cc.confirmShipment, shipmentID, "0", "0", "0", "0", "", "", "", ""); response.Status == shim.OK {
+		t.Fatal("confirmShipment succeeded without a bill of lading")
+	}
+
+	// the category restricts the formats of its documents
+	if response := fixture.invoke(fixture.supplier, cc.uploadDocument, "5b0d3c7e-8f1a-4b2c-9d3e-4f5a6b7c8d90", fmt.Sprint(TypeShipment), shipmentID, "hash-0", "", fmt.Sprint(DocTypeJPG), testContractID, "billOfLading"); response.Status == shim.OK {
+		t.Fatal("uploadDocument accepted a bill of lading of a wrong format")
+	}
+
+	if response := fixture.invoke(transporter, cc.confirmShipment, shipmentID, "0", "0", "0", "0", "", "hash-1", fmt.Sprint(DocTypePDF), "", "billOfLading"); response.Status != shim.OK {
+		t.Fatalf("confirmShipment failed: %s", response.Message)
+	}
+
+	if result := missing(); len(result) != 1 || len(result[0].Categories) != 0 {
+		t.Errorf("expected no missing documents, got %+v", result)
+	}
+}
+
+// invoiceChaincode stands in for the trade-finance chaincode invoked through the bridge,
+// it records the requests, answers them with reject if set and serves invoices for getInvoice
+type invoiceChaincode struct {
+	requests []BridgeRequest
+	reject   *BridgeError
+	invoices map[string]Invoice
+}
+
+func (cc *invoiceChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *invoiceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != bridgeFunction {
+		return shim.Error(fmt.Sprintf("unexpected function %s", function))
+	}
+
+	request, bridgeError := ParseBridgeRequest(args)
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+	cc.requests = append(cc.requests, request)
+
+	if cc.reject != nil {
+		return BridgeFailure(400, cc.reject)
+	}
+
+	if request.Function == bridgeGetInvoice {
+		args, _ := request.Arguments()
+		invoice, ok := cc.invoices[args[0]]
+		if !ok {
+			return BridgeReply(pb.Response{Status: 404, Message: fmt.Sprintf("invoice %s doesn't exist", args[0])})
+		}
+
+		invoiceBytes, _ := json.Marshal(invoice)
+		return BridgeReply(shim.Success(invoiceBytes))
+	}
+
+	return BridgeReply(shim.Success(nil))
+}
+
+func TestBillOfLadingHolderChain(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	fixture.putTestContract(t)
+	fixture.putTestShipment(t)
+	cc := fixture.cc
+	transporter := newCreatorStub(t, fixture.stub, "ORG3MSP", "Transporter")
+	bank := newCreatorStub(t, fixture.stub, "ORG5MSP", "Bank")
+	fixture.stub.MockPeerChaincode("trade-finance-chaincode/common", shim.NewMockStub("trade-finance-chaincode", new(invoiceChaincode)))
+
+	const billOfLadingID = "7c2e9a41-5b3d-4f86-a1c7-3e8d2b6f9a05"
+
+	// delivery can be confirmed only for a shipment with validated proofs
+	proof := Proof{}
+	proof.Key.ID = testProofID
+	proof.Value.ShipmentID = testShipmentID
+	proof.Value.State = stateProofValidated
+
+	fixture.put(t, &proof, proofIndex)
+
+	if response := fixture.invoke(fixture.supplier, cc.issueBillOfLading, billOfLadingID, testShipmentID); response.Status == shim.OK {
+		t.Fatal("issueBillOfLading succeeded for the supplier")
+	}
+
+	if response := fixture.invoke(transporter, cc.issueBillOfLading, billOfLadingID, testShipmentID); response.Status != shim.OK {
+		t.Fatalf("issueBillOfLading failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(transporter, cc.issueBillOfLading, "1e4b7d2a-6c9f-4a3e-b8d1-5f2c7a9e0b64", testShipmentID); response.Status == shim.OK {
+		t.Fatal("a second bill of lading was issued for the shipment")
+	}
+
+	// trade-finance pledges the bill of lading through the bridge
+	pledge := func(securedParty string) pb.Response {
+		payload, err := json.Marshal(PledgeBillOfLadingRequest{BillOfLadingID: billOfLadingID, InvoiceID: testContractID, SecuredParty: securedParty})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requestBytes, err := json.Marshal(BridgeRequest{Version: bridgeVersion, Function: bridgePledgeBillOfLading, Payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fixture.invoke(fixture.supplier, cc.bridge, string(requestBytes))
+	}
+
+	if response := pledge("Buyer"); response.Status == shim.OK {
+		t.Fatal("bill of lading was pledged to the buyer")
+	}
+
+	if response := pledge("Bank"); response.Status == shim.OK {
+		t.Fatal("bill of lading was pledged to an unregistered bank")
+	}
+
+	fixture.registerParticipant(t, "Bank", "ORG5MSP", participantActive, time.Now().AddDate(1, 0, 0).Unix())
+
+	if response := pledge("Bank"); response.Status != shim.OK {
+		t.Fatalf("pledging the bill of lading failed: %s", response.Message)
+	}
+
+	endorse := []struct {
+		stub     *creatorStub
+		endorsee string
+		ok       bool
+	}{
+		{fixture.buyer, "Buyer", false},
+		{fixture.supplier, "Transporter", false},
+		{fixture.supplier, "Factor-1", false},
+		{fixture.supplier, "Buyer", false},
+		{fixture.supplier, "Bank", true},
+	}
+
+	for _, step := range endorse {
+		if response := fixture.invoke(step.stub, cc.endorseBillOfLading, billOfLadingID, step.endorsee); (response.Status == shim.OK) != step.ok {
+			t.Fatalf("endorsing to %s: expected ok=%t, got %d %s", step.endorsee, step.ok, response.Status, response.Message)
+		}
+	}
+
+	confirmDelivery := func() pb.Response {
+		return fixture.invoke(fixture.buyer, cc.confirmDelivery, testShipmentID, "0", "0", "0", "0", "", "", "", "")
+	}
+
+	if response := confirmDelivery(); response.Status == shim.OK {
+		t.Fatal("confirmDelivery succeeded while the bank holds the bill of lading")
+	}
+
+	if response := fixture.invoke(bank, cc.endorseBillOfLading, billOfLadingID, "Buyer"); response.Status != shim.OK {
+		t.Fatalf("endorseBillOfLading failed: %s", response.Message)
+	}
+
+	if response := confirmDelivery(); response.Status != shim.OK {
+		t.Fatalf("confirmDelivery failed: %s", response.Message)
+	}
+
+	response := fixture.invoke(fixture.buyer, cc.getBillOfLading, billOfLadingID)
+	if response.Status != shim.OK {
+		t.Fatalf("getBillOfLading failed: %s", response.Message)
+	}
+
+	billOfLading := BillOfLading{}
+	if err := json.Unmarshal(response.Payload, &billOfLading); err != nil {
+		t.Fatal(err)
+	}
+
+	if billOfLading.Value.State != stateBillOfLadingSurrendered {
+		t.Errorf("expected a surrendered bill of lading, got state %d", billOfLading.Value.State)
+	}
+
+	holders := []string{}
+	for _, holder := range billOfLading.Value.Holders {
+		holders = append(holders, holder.Holder)
+	}
+
+	if fmt.Sprint(holders) != "[Supplier Bank Buyer]" {
+		t.Errorf("unexpected holder chain %v", holders)
+	}
+
+	if billOfLading.Value.SecuredParty != "" {
+		t.Errorf("pledge to %s isn't discharged by its endorsement", billOfLading.Value.SecuredParty)
+	}
+
+	// only the secured party takes the goods of a pledged bill of lading
+	pledged := BillOfLading{Key: BillOfLadingKey{ID: billOfLadingID}}
+	pledged.Value.Holder = "Supplier"
+	pledged.Value.SecuredParty = "Bank"
+	if err := pledged.Surrender("Supplier", time.Now().Unix()); err == nil {
+		t.Error("a pledged bill of lading was surrendered to its pledgor")
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.endorseBillOfLading, billOfLadingID, "Bank"); response.Status == shim.OK {
+		t.Error("a surrendered bill of lading was endorsed")
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+
+	getConfig := func() ConfigValue {
+		response := fixture.invoke(admin, cc.getConfig)
+		if response.Status != shim.OK {
+			t.Fatalf("getConfig failed: %s", response.Message)
+		}
+
+		config := ConfigValue{}
+		if err := json.Unmarshal(response.Payload, &config); err != nil {
+			t.Fatal(err)
+		}
+
+		return config
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.getConfig); response.Status == shim.OK {
+		t.Fatal("getConfig succeeded for the buyer")
+	}
+
+	config := getConfig()
+	if config.Version != 1 {
+		t.Fatalf("expected config version 1, got %d", config.Version)
+	}
+
+	// an upgrade doesn't overwrite the stored config
+	if response := fixture.stub.MockInit("upgrade", [][]byte{[]byte("init"), []byte("[]"), []byte("another-chaincode")}); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	if config := getConfig(); config.ChaincodeName != "supply-chain-chaincode" || config.Version != 1 {
+		t.Fatalf("config was overwritten by Init: %+v", config)
+	}
+
+	// the collections must be the ones deployed with the chaincode
+	template, err := ioutil.ReadFile("collections_config_template.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(template, &config.Collections); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(config ConfigValue, version int) pb.Response {
+		configBytes, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fixture.invoke(admin, cc.updateConfig, string(configBytes), fmt.Sprint(version))
+	}
+
+	if response := update(config, 0); response.Status == shim.OK {
+		t.Fatal("updateConfig succeeded for a stale version")
+	}
+
+	unknown := config
+	unknown.Collections = append([]Collection{{Name: "ORG1-ORG2-Unknown", Policy: "OR('ORG1MSP.member')", Entities: []string{"Unknown"}, Members: []string{"ORG1MSP"}}}, config.Collections...)
+	if response := update(unknown, 1); response.Status == shim.OK {
+		t.Fatal("updateConfig accepted a collection for an unknown entity")
+	}
+
+	if response := update(config, 1); response.Status != shim.OK {
+		t.Fatalf("updateConfig failed: %s", response.Message)
+	}
+
+	if config := getConfig(); config.Version != 2 || config.UpdatedBy != "Admin" || len(config.Collections) != 1 {
+		t.Errorf("unexpected config after update: %+v", config)
+	}
+
+	response := fixture.invoke(admin, cc.getConfigHistory)
+	if response.Status != shim.OK {
+		t.Fatalf("getConfigHistory failed: %s", response.Message)
+	}
+
+	history := []ConfigValue{}
+	if err := json.Unmarshal(response.Payload, &history); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || history[0].Version != 1 || history[1].Version != 2 {
+		t.Errorf("unexpected config history: %+v", history)
+	}
+}
+
+func TestRoleRegistry(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+	operator := newCreatorStub(t, fixture.stub, "ORG8MSP", "Operator")
+
+	if response := fixture.invoke(fixture.buyer, cc.grantRole, roleAdmin, memberKindMSPID, "ORG8MSP"); response.Status == shim.OK {
+		t.Fatal("grantRole succeeded for the buyer")
+	}
+
+	if response := fixture.invoke(operator, cc.listRoleMembers, roleAdmin); response.Status == shim.OK {
+		t.Fatal("listRoleMembers succeeded before the role was granted")
+	}
+
+	if response := fixture.invoke(admin, cc.grantRole, roleAdmin, "department", "operations"); response.Status == shim.OK {
+		t.Fatal("grantRole accepted an unknown kind of member")
+	}
+
+	if response := fixture.invoke(admin, cc.grantRole, roleAdmin, memberKindMSPID, "ORG8MSP"); response.Status != shim.OK {
+		t.Fatalf("grantRole failed: %s", response.Message)
+	}
+
+	response := fixture.invoke(operator, cc.listRoleMembers, roleAdmin)
+	if response.Status != shim.OK {
+		t.Fatalf("listRoleMembers failed: %s", response.Message)
+	}
+
+	members := []RoleMember{}
+	if err := json.Unmarshal(response.Payload, &members); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("expected 2 admins, got %+v", members)
+	}
+
+	if response := fixture.invoke(operator, cc.revokeRole, roleAdmin, memberKindOrganizationalUnit, "Admin"); response.Status != shim.OK {
+		t.Fatalf("revokeRole failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(admin, cc.listRoleMembers); response.Status == shim.OK {
+		t.Fatal("listRoleMembers succeeded after the role was revoked")
+	}
+
+	if response := fixture.invoke(operator, cc.revokeRole, roleAdmin, memberKindMSPID, "ORG8MSP"); response.Status == shim.OK {
+		t.Fatal("the last admin was revoked")
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	attributes := map[string]string{"role": "factor", "approvalLimit": "5000", "department": "Trade Finance", "canTrade": "true"}
+	source := func(name string) (string, bool, error) {
+		value, found := attributes[name]
+		return value, found, nil
+	}
+
+	cases := []struct {
+		expression string
+		variables  map[string]string
+		expected   bool
+	}{
+		{"role==factor && approvalLimit>=amount", map[string]string{"amount": "4999.5"}, true},
+		{"role==factor && approvalLimit>=amount", map[string]string{"amount": "5000.01"}, false},
+		{"role==Factor", nil, true},
+		{"role!=factor || canTrade", nil, true},
+		{"!canTrade", nil, false},
+		{"department=='trade finance' && (role==bank || role==factor)", nil, true},
+		{"approvalLimit>price", nil, false},
+		{"region==eu", nil, false},
+		{"!(region==eu)", nil, true},
+	}
+
+	for _, c := range cases {
+		policy, err := ParsePolicy(c.expression)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %s", c.expression, err.Error())
+		}
+
+		if result, err := policy.Evaluate(source, c.variables); err != nil || result != c.expected {
+			t.Errorf("%s with %v: expected %t, got %t (%v)", c.expression, c.variables, c.expected, result, err)
+		}
+	}
+
+	for _, expression := range []string{"", "role==", "(role==factor", "role==factor &&", "role=factor", "role==factor approvalLimit"} {
+		if _, err := ParsePolicy(expression); err == nil {
+			t.Errorf("%q was parsed", expression)
+		}
+	}
+}
+
+func TestPolicyRestrictsFunction(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+
+	response := fixture.invoke(admin, cc.getConfig)
+	if response.Status != shim.OK {
+		t.Fatalf("getConfig failed: %s", response.Message)
+	}
+
+	config := ConfigValue{}
+	if err := json.Unmarshal(response.Payload, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(policies []AccessPolicy) pb.Response {
+		config.Policies = policies
+		configBytes, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fixture.invoke(admin, cc.updateConfig, string(configBytes), fmt.Sprint(config.Version))
+	}
+
+	if response := update([]AccessPolicy{{Function: "getConfig", Expression: "role==admin"}}); response.Status == shim.OK {
+		t.Fatal("updateConfig accepted a policy for a query")
+	}
+
+	if response := update([]AccessPolicy{{Function: "placeOrder", Expression: "role=="}}); response.Status == shim.OK {
+		t.Fatal("updateConfig accepted an invalid policy")
+	}
+
+	if response := update([]AccessPolicy{{Function: "placeOrder", Expression: "role==buyer && approvalLimit>=price"}}); response.Status != shim.OK {
+		t.Fatalf("updateConfig failed: %s", response.Message)
+	}
+
+	buyer := func(attributes map[string]string) *creatorStub {
+		creator, key := newCreatorWithAttributes(t, "ORG2MSP", "Buyer-1", attributes)
+		return &creatorStub{fixture.stub, creator, key}
+	}
+
+	check := func(stub *creatorStub, args ...string) bool {
+		fixture.tx++
+		fixture.stub.MockTransactionStart(fmt.Sprintf("tx%d", fixture.tx))
+		defer fixture.stub.MockTransactionEnd(fmt.Sprintf("tx%d", fixture.tx))
+
+		err, result := checkAccessForPolicy(stub, "placeOrder", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	order := []string{"7b3f2a10-5c6d-4e8f-9a1b-2c3d4e5f6a7b", "steel", "10", "900"}
+	if !check(buyer(map[string]string{"role": "buyer", "approvalLimit": "1000"}), order...) {
+		t.Error("policy denied a buyer within the approval limit")
+	}
+
+	if check(buyer(map[string]string{"role": "buyer", "approvalLimit": "500"}), order...) {
+		t.Error("policy allowed a buyer over the approval limit")
+	}
+
+	if check(buyer(nil), order...) {
+		t.Error("policy allowed a buyer without attributes")
+	}
+
+	// functions without a policy stay open to their roles
+	fixture.tx++
+	fixture.stub.MockTransactionStart(fmt.Sprintf("tx%d", fixture.tx))
+	if err, result := checkAccessForPolicy(buyer(nil), "acceptOrder", []string{order[0]}); err != nil || !result {
+		t.Errorf("function without a policy was denied: %v", err)
+	}
+	fixture.stub.MockTransactionEnd(fmt.Sprintf("tx%d", fixture.tx))
+}
+
+func TestCollectionsForOverlappingNames(t *testing.T) {
+	config := Config{}
+	config.Value.Collections = []Collection{
+		{Name: "ORG1-ORG10-Order", Policy: "OR('ORG1MSP.member','ORG10MSP.member')", Entities: []string{orderIndex}, Members: []string{"ORG1MSP", "ORG10MSP"}},
+		{Name: "ORG10-ORG3-OrderContract", Policy: "OR('ORG10MSP.member','ORG3MSP.member')", Entities: []string{contractIndex}, Members: []string{"ORG10MSP", "ORG3MSP"}},
+		{Name: "ORG1-ORG2-Contract", Policy: "OR('ORG1MSP.member','ORG2MSP.member')", Entities: []string{contractIndex}, Members: []string{"ORG1MSP", "ORG2MSP"}},
+	}
+
+	cases := []struct {
+		index        string
+		participants []string
+		expected     []string
+	}{
+		{orderIndex, []string{"ORG1MSP"}, []string{"ORG1-ORG10-Order"}},
+		{orderIndex, []string{"ORG10MSP"}, []string{"ORG1-ORG10-Order"}},
+		{contractIndex, []string{"ORG1MSP", "ORG2MSP"}, []string{"ORG1-ORG2-Contract"}},
+		{contractIndex, []string{"ORG3MSP"}, []string{"ORG10-ORG3-OrderContract"}},
+		{shipmentIndex, []string{"ORG1MSP"}, []string{}},
+	}
+
+	for _, c := range cases {
+		names, err := config.CollectionsFor(c.index, c.participants)
+		if err != nil {
+			t.Errorf("%s for %v: %s", c.index, c.participants, err.Error())
+			continue
+		}
+
+		if fmt.Sprint(names) != fmt.Sprint(c.expected) {
+			t.Errorf("%s for %v: expected %v, got %v", c.index, c.participants, c.expected, names)
+		}
+	}
+
+	// ORG1MSP is a prefix of ORG10MSP but not a member of its collection
+	if names, err := config.CollectionsFor(contractIndex, []string{"ORG1MSP", "ORG10MSP"}); err == nil {
+		t.Errorf("contract of ORG1MSP and ORG10MSP was routed to %v", names)
+	}
+
+	if names, err := config.CollectionsFor(orderIndex, []string{"ORG3MSP"}); err == nil {
+		t.Errorf("order of ORG3MSP was routed to %v", names)
+	}
+
+	// ORG2MSP alone is shared by both contract collections of an overlapping config
+	overlapping := config
+	overlapping.Value.Collections = append([]Collection{
+		{Name: "ORG2-ORG5-Contract", Policy: "OR('ORG2MSP.member','ORG5MSP.member')", Entities: []string{contractIndex}, Members: []string{"ORG2MSP", "ORG5MSP"}},
+	}, config.Value.Collections...)
+	if names, err := overlapping.CollectionsFor(contractIndex, []string{"ORG2MSP"}); err == nil {
+		t.Errorf("contract of ORG2MSP was routed to %v of several collections", names)
+	}
+
+	config.Value.ChaincodeName = "supply-chain-chaincode"
+	if err := config.Validate(); err != nil {
+		t.Fatalf("valid config was rejected: %s", err.Error())
+	}
+
+	invalid := []Collection{
+		{Name: "ORG1-Order", Policy: "OR('ORG10MSP.member')", Entities: []string{orderIndex}, Members: []string{"ORG1MSP"}},
+		{Name: "ORG1-Order", Policy: "OR('ORG1MSP.member')", Members: []string{"ORG1MSP"}},
+		{Name: "ORG1-Order", Policy: "OR('ORG1MSP.member')", Entities: []string{"Orders"}, Members: []string{"ORG1MSP"}},
+		{Name: "ORG10-ORG1-Order", Policy: "OR('ORG10MSP.member','ORG1MSP.member')", Entities: []string{orderIndex}, Members: []string{"ORG10MSP", "ORG1MSP"}},
+		{Name: "ORG1-ORG2-ORG3-Contract", Policy: "OR('ORG1MSP.member','ORG2MSP.member','ORG3MSP.member')", Entities: []string{contractIndex}, Members: []string{"ORG1MSP", "ORG2MSP", "ORG3MSP"}},
+		{Name: "ORG2-ORG5-Contract", Policy: "OR('ORG2MSP.member','ORG5MSP.member')", Entities: []string{contractIndex}, Members: []string{"ORG2MSP", "ORG5MSP"}},
+	}
+
+	for _, collection := range invalid {
+		broken := config
+		broken.Value.Collections = append([]Collection{collection}, config.Value.Collections...)
+		if err := broken.Validate(); err == nil {
+			t.Errorf("invalid collection was accepted: %+v", collection)
+		}
+	}
+}
+
+// initStub refuses private data like the peer does in Init
+type initStub struct {
+	*shim.MockStub
+}
+
+func (stub *initStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return nil, errors.New("private data is not available in Init")
+}
+
+func TestConfigFromShippedCollectionsInInit(t *testing.T) {
+	collections, err := ioutil.ReadFile("collections_config_template.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &initStub{shim.NewMockStub("config", nil)}
+	stub.MockTransactionStart("init")
+	defer stub.MockTransactionEnd("init")
+
+	config := Config{}
+	if err := config.FillFromArguments(stub, []string{string(collections), "supply-chain-chaincode"}); err != nil {
+		t.Fatalf("config of the shipped collections was rejected in Init: %s", err.Error())
+	}
+
+	if len(config.Value.Collections) != 1 {
+		t.Errorf("expected the shipped collection, got %+v", config.Value.Collections)
+	}
+
+	if err := config.CheckCollectionsDefined(stub); err == nil {
+		t.Error("collections were probed without private data")
+	}
+}
+
+func TestContractEndorsementPolicy(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+	fixture.stub.MockPeerChaincode("trade-finance-chaincode/common", shim.NewMockStub("trade-finance-chaincode", new(invoiceChaincode)))
+
+	const orderID = "3e9d1b7a-2f4c-4a6e-8b5d-7c1f0e2a9b43"
+
+	if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.acceptOrder, orderID); response.Status != shim.OK {
+		t.Fatalf("acceptOrder failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.getEndorsementPolicy, orderIndex, orderID); response.Status == shim.OK {
+		t.Error("getEndorsementPolicy succeeded for an entity without a policy")
+	}
+
+	response := fixture.invoke(fixture.buyer, cc.getEndorsementPolicy, contractIndex, orderID)
+	if response.Status != shim.OK {
+		t.Fatalf("getEndorsementPolicy failed: %s", response.Message)
+	}
+
+	policy := struct {
+		Organizations []string `json:"organizations"`
+	}{}
+	if err := json.Unmarshal(response.Payload, &policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(policy.Organizations) != "[ORG1MSP ORG2MSP]" {
+		t.Errorf("expected the buyer's and the supplier's organizations, got %v", policy.Organizations)
+	}
+}
+
+func TestConfidentialInputsStayOutOfArgs(t *testing.T) {
+	fixture := newProofFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+	fixture.stub.MockPeerChaincode("trade-finance-chaincode/common", shim.NewMockStub("trade-finance-chaincode", new(invoiceChaincode)))
+
+	// omitsSecrets fails the test if a confidential value is in the args of the proposal
+	omitsSecrets := func(args []string, secrets ...string) []string {
+		for _, arg := range args {
+			for _, secret := range secrets {
+				if strings.Contains(arg, secret) {
+					t.Fatalf("confidential value %q is in the args %v", secret, args)
+				}
+			}
+		}
+
+		return args
+	}
+
+	// emitted drains the chaincode events of the stub and fails the test if a confidential value is in their payloads
+	emitted := func(secrets ...string) []EventPayload {
+		payloads := []EventPayload{}
+		for {
+			select {
+			case event := <-fixture.stub.ChaincodeEventsChannel:
+				for _, secret := range secrets {
+					if strings.Contains(string(event.Payload), secret) {
+						t.Fatalf("confidential value %q is in the event %s", secret, event.Payload)
+					}
+				}
+
+				payload := EventPayload{}
+				if err := json.Unmarshal(event.Payload, &payload); err != nil {
+					t.Fatal(err)
+				}
+				payloads = append(payloads, payload)
+			default:
+				return payloads
+			}
+		}
+	}
+
+	const orderID = "5a8c2e1f-9b7d-4c3a-8e6f-1d2b3c4a5e69"
+
+	if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	// acceptOrder has no confidential input, the contract is signed on the terms of the order
+	if response := fixture.invokeWithTransient(fixture.supplier, map[string]string{"acceptOrder": `{"price":11.75}`}, cc.acceptOrder, orderID); response.Status != shim.OK {
+		t.Fatalf("acceptOrder failed: %s", response.Message)
+	}
+
+	contract := Contract{Key: ContractKey{ID: orderID}}
+	fixture.stub.MockTransactionStart("load")
+	if err := LoadFrom(fixture.supplier, &contract, contractIndex); err != nil {
+		t.Fatal(err)
+	}
+	fixture.stub.MockTransactionEnd("load")
+
+	if contract.Value.Price != 12.5 || contract.Value.TotalDue != 12.5*150 {
+		t.Errorf("contract isn't signed on the terms of the order: %+v", contract.Value)
+	}
+
+	proof := fixture.buildProof(t, testProofID, 0, fixture.attributes(true))
+	if response := fixture.invoke(fixture.supplier, cc.generateProof, testProofID, "Auditor-1", testShipmentID, testIssuerID); response.Status == shim.OK {
+		t.Fatal("generateProof succeeded without the proof")
+	}
+
+	args := omitsSecrets([]string{testProofID, "Auditor-1", testShipmentID, testIssuerID}, proof, fixture.attributeValues[0])
+	if response := fixture.submitProof("generateProof", proof, args...); response.Status != shim.OK {
+		t.Fatalf("generateProof failed: %s", response.Message)
+	}
+
+	const description = "moisture 11.2% within tolerance"
+	transient := map[string]string{"verifyProof": fmt.Sprintf(`{"description":%q,"grade":"AA"}`, description)}
+	if response := fixture.invokeWithTransient(fixture.auditor, transient, cc.verifyProof, testProofID, fmt.Sprint(stateReportAccepted), "", ""); response.Status == shim.OK {
+		t.Fatal("verifyProof accepted an unknown transient field")
+	}
+
+	const documentMeta = "lab sheet of the moisture test"
+	emitted()
+	transient = map[string]string{"verifyProof": fmt.Sprintf(`{"description":%q,"documentMeta":%q}`, description, documentMeta)}
+	args = omitsSecrets([]string{testProofID, fmt.Sprint(stateReportAccepted), "8f2b6c1d9e4a", fmt.Sprint(DocTypePDF)}, description, documentMeta)
+	if response := fixture.invokeWithTransient(fixture.auditor, transient, cc.verifyProof, args...); response.Status != shim.OK {
+		t.Fatalf("verifyProof failed: %s", response.Message)
+	}
+
+	if payloads := emitted(description, documentMeta); len(payloads) != 1 || len(payloads[0].Events) < 2 {
+		t.Errorf("verifyProof doesn't emit the report and the document: %+v", payloads)
+	}
+
+	fixture.stub.MockTransactionStart("reports")
+	reports, err := findReportByProofID(fixture.auditor, testProofID)
+	fixture.stub.MockTransactionEnd("reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) != 1 || reports[0].Value.Description != description {
+		t.Errorf("report doesn't keep the confidential description: %+v", reports)
+	}
+
+	// events carry nothing but the hash of the entities kept in private collections
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+	response := fixture.invoke(admin, cc.getConfig)
+	if response.Status != shim.OK {
+		t.Fatalf("getConfig failed: %s", response.Message)
+	}
+
+	config := ConfigValue{}
+	if err := json.Unmarshal(response.Payload, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Collections = []Collection{{
+		Name:     "ORG1-ORG2-Contract",
+		Policy:   "OR('ORG1MSP.member','ORG2MSP.member')",
+		Entities: []string{contractIndex},
+		Members:  []string{"ORG1MSP", "ORG2MSP"},
+	}}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := fixture.invoke(admin, cc.updateConfig, string(configBytes), fmt.Sprint(config.Version)); response.Status != shim.OK {
+		t.Fatalf("updateConfig failed: %s", response.Message)
+	}
+
+	const privateOrderID = "7e3a9c5b-2d1f-4b8e-a4c6-0f9d8e7c6b53"
+
+	if response := fixture.invoke(fixture.buyer, cc.placeOrder, privateOrderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.acceptOrder, privateOrderID); response.Status != shim.OK {
+		t.Fatalf("acceptOrder failed: %s", response.Message)
+	}
+
+	emitted()
+	if response := fixture.invoke(fixture.buyer, cc.setContractPredicates, privateOrderID, `[{"attribute":"quantity","operator":">=","bound":100}]`); response.Status != shim.OK {
+		t.Fatalf("setContractPredicates failed: %s", response.Message)
+	}
+
+	payloads := emitted("12.5", "1875")
+	if len(payloads) != 1 || len(payloads[0].Events) != 1 {
+		t.Fatalf("setContractPredicates doesn't emit the contract: %+v", payloads)
+	}
+
+	contract = Contract{Key: ContractKey{ID: privateOrderID}}
+	compositeKey, err := contract.ToCompositeKey(fixture.stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256(fixture.stub.PvtState["ORG1-ORG2-Contract"][compositeKey])
+	digest, ok := payloads[0].Events[0].Value.Other.(map[string]interface{})
+	if !ok || digest["hash"] != fmt.Sprintf("%x", hash) {
+		t.Errorf("contract event doesn't carry the hash of the private contract: %+v", payloads[0].Events[0])
+	}
+}
+
+func TestBridgeTargetAndErrors(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+
+	response := fixture.invoke(admin, cc.getConfig)
+	if response.Status != shim.OK {
+		t.Fatalf("getConfig failed: %s", response.Message)
+	}
+
+	config := ConfigValue{}
+	if err := json.Unmarshal(response.Payload, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(target BridgeTarget) pb.Response {
+		config.Bridge = target
+		configBytes, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fixture.invoke(admin, cc.updateConfig, string(configBytes), fmt.Sprint(config.Version))
+	}
+
+	if response := update(BridgeTarget{Chaincode: "invoices"}); response.Status == shim.OK {
+		t.Fatal("updateConfig accepted a bridge target without a channel")
+	}
+
+	if response := update(BridgeTarget{Chaincode: "invoices", Channel: "trade"}); response.Status != shim.OK {
+		t.Fatalf("updateConfig failed: %s", response.Message)
+	}
+
+	invoices := &invoiceChaincode{reject: &BridgeError{Code: bridgeErrorRejected, Message: "invoice already exists"}}
+	fixture.stub.MockPeerChaincode("invoices/trade", shim.NewMockStub("invoices", invoices))
+
+	const orderID = "8d4f1c2b-7a3e-4b9d-a6c5-2e1f0b9d8c74"
+
+	if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	response = fixture.invoke(fixture.supplier, cc.acceptOrder, orderID)
+	if response.Status == shim.OK {
+		t.Fatal("acceptOrder succeeded though the invoice was rejected")
+	}
+
+	if !strings.Contains(response.Message, bridgeErrorRejected) {
+		t.Errorf("code of the bridge error is lost: %s", response.Message)
+	}
+
+	if len(invoices.requests) != 1 || invoices.requests[0].Function != bridgeRegisterInvoice {
+		t.Fatalf("expected one registerInvoice request on the configured target, got %+v", invoices.requests)
+	}
+
+	invoice := RegisterInvoiceRequest{}
+	if err := json.Unmarshal(invoices.requests[0].Payload, &invoice); err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice.InvoiceID != orderID || invoice.TotalDue != 12.5*150 {
+		t.Errorf("unexpected invoice request: %+v", invoice)
+	}
+
+	// requests of the other chaincode are refused with a typed error
+	serve := func(request BridgeRequest) BridgeResponse {
+		requestBytes, err := json.Marshal(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := fixture.invoke(fixture.buyer, cc.bridge, string(requestBytes))
+		if response.Status == shim.OK {
+			t.Fatalf("bridge served %+v", request)
+		}
+
+		bridgeResponse := BridgeResponse{}
+		if err := json.Unmarshal(response.Payload, &bridgeResponse); err != nil || bridgeResponse.Error == nil {
+			t.Fatalf("bridge failed without a bridge error: %s", response.Message)
+		}
+
+		return bridgeResponse
+	}
+
+	payload := json.RawMessage(`{"billOfLadingID":"missing"}`)
+	if code := serve(BridgeRequest{Version: bridgeVersion + 1, Function: bridgeGetBillOfLading, Payload: payload}).Error.Code; code != bridgeErrorVersion {
+		t.Errorf("expected %s for another version, got %s", bridgeErrorVersion, code)
+	}
+
+	if code := serve(BridgeRequest{Version: bridgeVersion, Function: bridgeAcceptInvoice, Payload: json.RawMessage(`{"invoiceID":"x"}`)}).Error.Code; code != bridgeErrorFunction {
+		t.Errorf("expected %s for a function of the other chaincode, got %s", bridgeErrorFunction, code)
+	}
+
+	if code := serve(BridgeRequest{Version: bridgeVersion, Function: bridgeGetBillOfLading, Payload: payload}).Error.Code; code != bridgeErrorNotFound {
+		t.Errorf("expected %s for a missing bill of lading, got %s", bridgeErrorNotFound, code)
+	}
+}
+
+func TestReconcileContracts(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	fixture.putTestContract(t)
+	cc := fixture.cc
+	invoices := &invoiceChaincode{invoices: make(map[string]Invoice)}
+	fixture.stub.MockPeerChaincode("trade-finance-chaincode/common", shim.NewMockStub("trade-finance-chaincode", invoices))
+
+	const (
+		reconciledID = "1f6b3d8a-4c2e-4a9b-8d7f-0e5c1a2b3d41"
+		driftedID    = "2a7c4e9b-5d3f-4b0c-9e8a-1f6d2b3c4e52"
+		missingID    = "3b8d5f0c-6e4a-4c1d-af9b-2a7e3c4d5f63"
+	)
+
+	for _, orderID := range []string{reconciledID, driftedID, missingID} {
+		if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+			t.Fatalf("placeOrder failed: %s", response.Message)
+		}
+
+		if response := fixture.invoke(fixture.supplier, cc.acceptOrder, orderID); response.Status != shim.OK {
+			t.Fatalf("acceptOrder failed: %s", response.Message)
+		}
+	}
+
+	// the invoices as registered on acceptOrder, one of them changed since then
+	for _, contractID := range []string{testContractID, reconciledID, driftedID} {
+		contract := Contract{Key: ContractKey{ID: contractID}}
+		fixture.stub.MockTransactionStart("load")
+		if err := LoadFrom(fixture.supplier, &contract, contractIndex); err != nil {
+			t.Fatal(err)
+		}
+		fixture.stub.MockTransactionEnd("load")
+
+		invoice := Invoice{Key: InvoiceKey{ID: contractID}}
+		invoice.Value.Debtor = contract.Value.ConsigneeName
+		invoice.Value.Beneficiary = contract.Value.ConsignorName
+		invoice.Value.TotalDue = contract.Value.TotalDue
+		invoice.Value.PaymentDate = contract.Value.PaymentDate
+		invoice.Value.Guarantor = contract.Value.Guarantor
+		invoice.Value.State = stateInvoiceIssued
+		invoices.invoices[contractID] = invoice
+	}
+
+	drifted := invoices.invoices[driftedID]
+	drifted.Value.TotalDue += 10
+	drifted.Value.State = stateInvoiceSold
+	invoices.invoices[driftedID] = drifted
+
+	if response := fixture.invoke(fixture.buyer, cc.reconcileContracts); response.Status == shim.OK {
+		t.Fatal("reconcileContracts succeeded for the buyer")
+	}
+
+	response := fixture.invoke(fixture.auditor, cc.reconcileContracts)
+	if response.Status != shim.OK {
+		t.Fatalf("reconcileContracts failed: %s", response.Message)
+	}
+
+	report := ReconciliationReport{}
+	if err := json.Unmarshal(response.Payload, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Contracts != 4 || report.Reconciled != 2 {
+		t.Errorf("expected 2 of 4 contracts to reconcile, got %d of %d", report.Reconciled, report.Contracts)
+	}
+
+	kinds := []string{}
+	for _, mismatch := range report.Mismatches {
+		kinds = append(kinds, mismatch.ContractID[:8]+":"+mismatch.Kind)
+	}
+
+	expected := "[2a7c4e9b:AMOUNT_DRIFT 2a7c4e9b:STATE_DIVERGENCE 3b8d5f0c:MISSING_INVOICE]"
+	if fmt.Sprint(kinds) != expected {
+		t.Errorf("expected mismatches %s, got %v", expected, kinds)
+	}
+
+	if report.Totals[mismatchAmountDrift] != 1 || report.Mismatches[0].InvoiceValue != "1885.00" {
+		t.Errorf("amount drift isn't reported: %+v", report.Mismatches[0])
+	}
+}
+
+func TestEventPayloadIsSelfContained(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+
+	// lastEvent drains the chaincode events of the stub and returns the last one
+	lastEvent := func() *pb.ChaincodeEvent {
+		var last *pb.ChaincodeEvent
+		for {
+			select {
+			case event := <-fixture.stub.ChaincodeEventsChannel:
+				last = event
+			default:
+				return last
+			}
+		}
+	}
+	lastEvent()
+
+	const orderID = "4c9e2a7d-8b1f-4d3e-9a6c-5e0f1b2d3c84"
+
+	if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	event := lastEvent()
+	if event == nil || event.EventName != EventName("supply-chain-chaincode", eventPlaceOrder) {
+		t.Fatalf("unexpected chaincode event %v", event)
+	}
+
+	payload := EventPayload{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Version != eventPayloadVersion || payload.TxID != fmt.Sprintf("tx%d", fixture.tx) || payload.Actor.MSPID != "ORG1MSP" || len(payload.Events) != 1 {
+		t.Fatalf("unexpected event payload %+v", payload)
+	}
+
+	snapshot, ok := payload.Events[0].Value.Other.(map[string]interface{})
+	if !ok || payload.Events[0].Value.EntityID != orderID || snapshot["productName"] != "coffee" {
+		t.Errorf("event doesn't carry the order: %+v", payload.Events[0])
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.getEventPayload, payload.Events[0].Key.ID); response.Status != shim.OK {
+		t.Errorf("stored event isn't found: %s", response.Message)
+	}
+
+	// listeners working from the blocks alone don't need the events in state
+	response := fixture.invoke(admin, cc.getConfig)
+	if response.Status != shim.OK {
+		t.Fatalf("getConfig failed: %s", response.Message)
+	}
+
+	config := ConfigValue{}
+	if err := json.Unmarshal(response.Payload, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(storage string) pb.Response {
+		config.EventStorage = storage
+		configBytes, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fixture.invoke(admin, cc.updateConfig, string(configBytes), fmt.Sprint(config.Version))
+	}
+
+	if response := update("ledger"); response.Status == shim.OK {
+		t.Fatal("updateConfig accepted an unknown event storage")
+	}
+
+	if response := update(eventStorageNone); response.Status != shim.OK {
+		t.Fatalf("updateConfig failed: %s", response.Message)
+	}
+	lastEvent()
+
+	if response := fixture.invoke(fixture.buyer, cc.cancelOrder, orderID); response.Status != shim.OK {
+		t.Fatalf("cancelOrder failed: %s", response.Message)
+	}
+
+	event = lastEvent()
+	if err := json.Unmarshal(event.Payload, &payload); err != nil || len(payload.Events) != 1 {
+		t.Fatalf("unexpected chaincode event %v", event)
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.getEventPayload, payload.Events[0].Key.ID); response.Status == shim.OK {
+		t.Error("event is stored though the config turned the storage off")
+	}
+
+	if response := fixture.invoke(fixture.auditor, cc.listEvents); response.Status == shim.OK || !strings.Contains(response.Message, "eventStorage") {
+		t.Errorf("listEvents doesn't tell the events aren't stored: %+v", response)
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+
+	orderIDs := []string{
+		"5d0f3b8e-9c2a-4e7f-8b1d-6a3c4e5f7a95",
+		"6e1a4c9f-0d3b-4f8a-9c2e-7b4d5f6a8b06",
+		"7f2b5d0a-1e4c-4a9b-8d3f-8c5e6a7b9c17",
+	}
+
+	for _, orderID := range orderIDs {
+		if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "150", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+			t.Fatalf("placeOrder failed: %s", response.Message)
+		}
+	}
+
+	list := func(args ...string) EventPage {
+		response := fixture.invoke(fixture.auditor, cc.listEvents, args...)
+		if response.Status != shim.OK {
+			t.Fatalf("listEvents failed: %s", response.Message)
+		}
+
+		page := EventPage{}
+		if err := json.Unmarshal(response.Payload, &page); err != nil {
+			t.Fatal(err)
+		}
+
+		return page
+	}
+
+	if page := list(orderIndex, orderIDs[1]); len(page.Events) != 1 || page.Events[0].Value.EntityID != orderIDs[1] || page.Bookmark != "" {
+		t.Errorf("expected the event of one order, got %+v", page)
+	}
+
+	if page := list("", "", eventPlaceOrder, "Supplier"); len(page.Events) != 0 {
+		t.Errorf("events of the buyer are listed for the supplier: %+v", page.Events)
+	}
+
+	if page := list("", "", eventPlaceOrder, "", "4102444800"); len(page.Events) != 0 {
+		t.Errorf("events before the time window are listed: %+v", page.Events)
+	}
+
+	if page := list("", "", "", "", "", "1"); len(page.Events) != 0 || page.Bookmark != "" {
+		t.Errorf("events after the time window are listed: %+v", page)
+	}
+
+	// the pages follow each other in time without gaps or repetitions
+	listed := []string{}
+	bookmark := ""
+	last := Event{}
+	for pages := 0; pages == 0 || bookmark != ""; pages++ {
+		if pages > 100 {
+			t.Fatal("listEvents doesn't reach the last page")
+		}
+
+		page := list("", "", "", "", "", "", "2", bookmark)
+		if page.Bookmark != "" && len(page.Events) != 2 {
+			t.Errorf("expected a full page before the last one, got %+v", page)
+		}
+
+		for _, event := range page.Events {
+			if event.Value.Timestamp < last.Value.Timestamp || event.Value.Timestamp == last.Value.Timestamp && event.Key.ID <= last.Key.ID {
+				t.Errorf("event %+v is listed after %+v", event, last)
+			}
+			last = event
+
+			if event.Value.Action == eventPlaceOrder {
+				listed = append(listed, event.Value.EntityID)
+			}
+		}
+		bookmark = page.Bookmark
+	}
+
+	sort.Strings(listed)
+	if fmt.Sprint(listed) != fmt.Sprint(orderIDs) {
+		t.Errorf("expected the events of %v, got %v", orderIDs, listed)
+	}
+
+	for _, args := range [][]string{
+		{"", "", "", "", "", "", "0"},
+		{"", "", "", "", "20", "10"},
+	} {
+		if response := fixture.invoke(fixture.auditor, cc.listEvents, args...); response.Status == shim.OK {
+			t.Errorf("listEvents accepted %q", args)
+		}
+	}
+}
+
+func TestUpgradeIndexesStoredEvents(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+
+	// an event stored before the events were indexed by time has no index entries
+	event := Event{}
+	event.Key.ID = "8a3c6e1b-2f5d-4b0c-9e4a-9d6f7b8c0d28"
+	event.Value.Timestamp = 1600000000
+	event.Value.Creator = "Buyer"
+	event.Value.EntityType = orderIndex
+	event.Value.EntityID = "9b4d7f2c-3a6e-4c1d-8f5b-0e7a8c9d1e39"
+	event.Value.Action = eventPlaceOrder
+	fixture.put(t, &event, eventIndex)
+
+	list := func() EventPage {
+		response := fixture.invoke(fixture.auditor, fixture.cc.listEvents, orderIndex, event.Value.EntityID)
+		if response.Status != shim.OK {
+			t.Fatalf("listEvents failed: %s", response.Message)
+		}
+
+		page := EventPage{}
+		if err := json.Unmarshal(response.Payload, &page); err != nil {
+			t.Fatal(err)
+		}
+
+		return page
+	}
+
+	if page := list(); len(page.Events) != 0 {
+		t.Fatalf("an event without index entries is listed: %+v", page.Events)
+	}
+
+	if response := fixture.stub.MockInit("upgrade", [][]byte{[]byte("init"), []byte("[]"), []byte("supply-chain-chaincode")}); response.Status != shim.OK {
+		t.Fatalf("upgrade failed: %s", response.Message)
+	}
+
+	if page := list(); len(page.Events) != 1 || page.Events[0].Key.ID != event.Key.ID {
+		t.Errorf("the stored event isn't listed after the upgrade: %+v", page.Events)
+	}
+}
+
+func TestSupplierPerformanceAndTradeVolumes(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	cc := fixture.cc
+
+	const (
+		day  = int64(24 * 60 * 60)
+		base = int64(1700000000)
+	)
+
+	type trade struct {
+		id, supplier, product, destination string
+		quantity                           int
+		totalDue                           float32
+		ordered, signed, due, delivered    int64
+		reports                            []int
+	}
+
+	// the second delivery is a day late, the third trade is outside the time window
+	trades := []trade{
+		{"8b4d6f1c-3a5e-4c0d-9f5b-0e7a8c9d1e39", "Supplier", "coffee", "Hamburg", 100, 1000, base, base + day, base + 10*day, base + 8*day, []int{stateReportAccepted}},
+		{"9c5e7a2d-4b6f-4d1e-8a6c-1f8b9d0e2f40", "Supplier", "cocoa", "Hamburg", 50, 500, base + day, base + 2*day, base + 5*day, base + 7*day, []int{stateReportDeclined, stateReportAccepted}},
+		{"0d6f8b3e-5c7a-4e2f-9b7d-2a9c0e1f3a51", "Supplier-2", "coffee", "Rotterdam", 10, 100, base + 39*day, base + 40*day, base + 45*day, base + 44*day, []int{stateReportDeclined}},
+	}
+
+	fixture.stub.MockTransactionStart("load")
+	for _, trade := range trades {
+		order := Order{Key: OrderKey{ID: trade.id}}
+		order.Value.Timestamp = trade.ordered
+
+		contract := Contract{Key: ContractKey{ID: trade.id}}
+		contract.Value.ConsignorName = trade.supplier
+		contract.Value.ProductName = trade.product
+		contract.Value.Destination = trade.destination
+		contract.Value.Quantity = trade.quantity
+		contract.Value.TotalDue = trade.totalDue
+		contract.Value.DueDate = trade.due
+		contract.Value.Timestamp = trade.signed
+
+		shipment := Shipment{Key: ShipmentKey{ID: trade.id[:24] + "000000000000"}}
+		shipment.Value.ContractID = trade.id
+		shipment.Value.Consignor = trade.supplier
+		shipment.Value.State = stateShipmentDelivered
+		shipment.Value.DeliveryDate = trade.delivered
+
+		for _, entry := range []struct {
+			data  LedgerData
+			index string
+		}{{&order, orderIndex}, {&contract, contractIndex}, {&shipment, shipmentIndex}} {
+			if err := UpdateOrInsertIn(fixture.supplier, entry.data, entry.index, []string{""}, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for j, state := range trade.reports {
+			report := Report{Key: ReportKey{ID: fmt.Sprintf("%s%012d", trade.id[:24], j+1)}}
+			report.Value.ConsignorName = trade.supplier
+			report.Value.State = state
+			report.Value.Timestamp = trade.delivered
+			if err := UpdateOrInsertIn(fixture.supplier, &report, reportIndex, []string{""}, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fixture.stub.MockTransactionEnd("load")
+
+	window := []string{strconv.FormatInt(base, 10), strconv.FormatInt(base+20*day, 10)}
+
+	if response := fixture.invoke(fixture.supplier, cc.getSupplierPerformance, window...); response.Status == shim.OK {
+		t.Fatal("getSupplierPerformance succeeded for the supplier")
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.getSupplierPerformance, window[1], window[0]); response.Status == shim.OK {
+		t.Fatal("getSupplierPerformance accepted a window ending before it starts")
+	}
+
+	response := fixture.invoke(fixture.buyer, cc.getSupplierPerformance, window...)
+	if response.Status != shim.OK {
+		t.Fatalf("getSupplierPerformance failed: %s", response.Message)
+	}
+
+	performances := []SupplierPerformance{}
+	if err := json.Unmarshal(response.Payload, &performances); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := SupplierPerformance{Supplier: "Supplier", Deliveries: 2, OnTime: 1, OnTimeRate: 0.5, AverageOrderToDelivery: 7,
+		ReportsAccepted: 2, ReportsDeclined: 1, PassRatio: 2.0 / 3}
+	if len(performances) != 1 || performances[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, performances)
+	}
+
+	response = fixture.invoke(fixture.supplier, cc.getTradeVolumes, window...)
+	if response.Status != shim.OK {
+		t.Fatalf("getTradeVolumes failed: %s", response.Message)
+	}
+
+	volumes := TradeVolumes{}
+	if err := json.Unmarshal(response.Payload, &volumes); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := fmt.Sprint(volumes.ByProduct); actual != "[{cocoa 1 50 500} {coffee 1 100 1000}]" {
+		t.Errorf("unexpected volumes by product %s", actual)
+	}
+
+	if actual := fmt.Sprint(volumes.ByDestination); actual != "[{Hamburg 2 150 1500}]" {
+		t.Errorf("unexpected volumes by destination %s", actual)
+	}
+}
+
+func TestGuaranteeExposureLimits(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	fixture.registerTraders(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG4MSP", "Admin")
+	bank := newCreatorStub(t, fixture.stub, "ORG3MSP", "Bank")
+
+	orderIDs := []string{
+		"1e7a9c4f-6d8b-4f3a-9c5e-3b0d1f2a4b62",
+		"2f8b0d5a-7e9c-4a4b-8d6f-4c1e2a3b5c73",
+		"3a9c1e6b-8f0d-4b5c-9e7a-5d2f3b4c6d84",
+	}
+
+	// every order amounts to 500
+	for _, orderID := range orderIDs {
+		if response := fixture.invoke(fixture.buyer, cc.placeOrder, orderID, "coffee", "40", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status != shim.OK {
+			t.Fatalf("placeOrder failed: %s", response.Message)
+		}
+	}
+
+	if response := fixture.invoke(bank, cc.setExposureLimit, "Bank", "", "1200"); response.Status == shim.OK {
+		t.Fatal("setExposureLimit succeeded for the bank")
+	}
+
+	if response := fixture.invoke(admin, cc.setExposureLimit, "", "", "1200"); response.Status == shim.OK {
+		t.Fatal("setExposureLimit accepted a limit of no bank and no buyer")
+	}
+
+	if response := fixture.invoke(admin, cc.setExposureLimit, "Bank", "", "1200"); response.Status != shim.OK {
+		t.Fatalf("setExposureLimit failed: %s", response.Message)
+	}
+
+	for i, orderID := range orderIDs {
+		response := fixture.invoke(bank, cc.guaranteeOrder, orderID)
+		if i < 2 && response.Status != shim.OK {
+			t.Fatalf("guaranteeOrder failed: %s", response.Message)
+		} else if i == 2 && response.Status == shim.OK {
+			t.Fatal("guaranteeOrder exceeded the exposure limit")
+		}
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.cancelOrder, orderIDs[0]); response.Status != shim.OK {
+		t.Fatalf("cancelOrder failed: %s", response.Message)
+	}
+
+	if response := fixture.invoke(bank, cc.guaranteeOrder, orderIDs[2]); response.Status != shim.OK {
+		t.Fatalf("guaranteeOrder failed after the exposure was released: %s", response.Message)
+	}
+
+	if response := fixture.invoke(fixture.buyer, cc.updateOrder, orderIDs[1], "coffee", "80", "12.5", "Hamburg", "1700000000", "1710000000"); response.Status == shim.OK {
+		t.Fatal("updateOrder raised a guaranteed amount over the exposure limit")
+	}
+
+	response := fixture.invoke(bank, cc.getExposureReport)
+	if response.Status != shim.OK {
+		t.Fatalf("getExposureReport failed: %s", response.Message)
+	}
+
+	report := ExposureReport{}
+	if err := json.Unmarshal(response.Payload, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := fmt.Sprint(report.Exposures); actual != "[{Bank Buyer 2 1000}]" {
+		t.Errorf("unexpected exposures %s", actual)
+	}
+
+	if actual := fmt.Sprint(report.Limits); actual != "[{Bank  1200 1000 200}]" {
+		t.Errorf("unexpected limits %s", actual)
+	}
+}
+
+// registerParticipant registers the organizational unit of the MSP as a verified participant
+func (fixture *chaincodeFixture) registerParticipant(t *testing.T, organizationalUnit string, mspID string, status string, kycExpiry int64) {
+	admin := newCreatorStub(t, fixture.stub, "ORG1MSP", "Admin")
+	if response := fixture.invoke(admin, fixture.cc.registerParticipant, organizationalUnit, mspID, organizationalUnit+" Ltd", testLEI, "GB",
+		status, kycVerified, strconv.FormatInt(kycExpiry, 10), `[{"bank":"Bank","reference":"GB29NWBK60161331926819","currency":"GBP"}]`); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+}
+
+// registerTraders registers the buyer and the supplier, only registered parties can trade
+func (fixture *chaincodeFixture) registerTraders(t *testing.T) {
+	kycExpiry := time.Now().AddDate(1, 0, 0).Unix()
+	fixture.registerParticipant(t, "Buyer", "ORG1MSP", participantActive, kycExpiry)
+	fixture.registerParticipant(t, "Supplier", "ORG2MSP", participantActive, kycExpiry)
+}
+
+func TestParticipantRegistry(t *testing.T) {
+	fixture := newChaincodeFixture(t)
+	cc := fixture.cc
+	admin := newCreatorStub(t, fixture.stub, "ORG4MSP", "Admin")
+	placeOrder := func(stub *creatorStub, orderID string) pb.Response {
+		return fixture.invoke(stub, cc.placeOrder, orderID, "coffee", "40", "12.5", "Hamburg", "1700000000", "1710000000")
+	}
+
+	if response := fixture.invoke(fixture.supplier, cc.registerParticipant, "Supplier", "ORG2MSP", "Supplier Ltd", testLEI, "GB",
+		participantSuspended, kycVerified, "1900000000", ""); response.Status == shim.OK {
+		t.Fatal("registerParticipant succeeded for the supplier")
+	}
+
+	if response := fixture.invoke(admin, cc.registerParticipant, "Buyer", "ORG1MSP", "Buyer Ltd", "5493001KJTIIGC8Y1R13", "GB",
+		participantActive, kycVerified, "1900000000", ""); response.Status == shim.OK {
+		t.Fatal("registerParticipant accepted a LEI with wrong check digits")
+	}
+
+	// the same organizational unit under an unregistered MSP
+	if response := placeOrder(newCreatorStub(t, fixture.stub, "ORG5MSP", "Buyer"), "4b0d2f7c-9a1e-4c6d-8f8b-6e3a4c5d7e95"); response.Status == shim.OK {
+		t.Fatal("placeOrder succeeded for an unregistered party")
+	}
+
+	fixture.registerParticipant(t, "Buyer", "ORG1MSP", participantSuspended, time.Now().AddDate(1, 0, 0).Unix())
+	if response := placeOrder(fixture.buyer, "5c1e3a8d-0b2f-4d7e-9a9c-7f4b5d6e8fa6"); response.Status == shim.OK {
+		t.Fatal("placeOrder succeeded for a suspended party")
+	}
+
+	fixture.registerParticipant(t, "Buyer", "ORG1MSP", participantActive, time.Now().Add(-time.Hour).Unix())
+	if response := placeOrder(fixture.buyer, "5c1e3a8d-0b2f-4d7e-9a9c-7f4b5d6e8fa6"); response.Status == shim.OK {
+		t.Fatal("placeOrder succeeded for a party with expired KYC")
+	}
+
+	fixture.registerParticipant(t, "Buyer", "ORG1MSP", participantActive, time.Now().AddDate(1, 0, 0).Unix())
+	if response := placeOrder(fixture.buyer, "5c1e3a8d-0b2f-4d7e-9a9c-7f4b5d6e8fa6"); response.Status != shim.OK {
+		t.Fatalf("placeOrder failed: %s", response.Message)
+	}
+
+	response := fixture.invoke(admin, cc.listParticipants, "Buyer")
+	if response.Status != shim.OK {
+		t.Fatalf("listParticipants failed: %s", response.Message)
+	}
+
+	participants := []Participant{}
+	if err := json.Unmarshal(response.Payload, &participants); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(participants) != 1 || participants[0].Key.MSPID != "ORG1MSP" || participants[0].Value.LEI != testLEI ||
+		participants[0].Value.Timestamp > participants[0].Value.UpdatedDate || len(participants[0].Value.BankAccounts) != 1 {
+		t.Errorf("expected the registered buyer, got %s", string(response.Payload))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Types of the fields of a transient input
+const (
+	transientString = "string"
+	transientNumber = "number"
+	transientObject = "object"
+)
+
+// TransientField is a confidential field of a function input
+type TransientField struct {
+	Name     string
+	Type     string
+	Required bool
+}
+
+// Schemas of the confidential inputs. The input of a function is a JSON object passed in
+// the transient map under the name of the function: the transient map is left out of the
+// block, the args are not.
+var transientSchemas = map[string][]TransientField{
+	"generateProof": {
+		{Name: "proof", Type: transientObject, Required: true},
+	},
+	"updateProof": {
+		{Name: "proof", Type: transientObject, Required: true},
+	},
+	"verifyProof": {
+		{Name: "description", Type: transientString},
+		{Name: "documentMeta", Type: transientString},
+	},
+}
+
+// ProofSubmission is the proof built on the client side, see Proof.FillFromSubmission
+type ProofSubmission struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+// ReportDetails are the confidential fields of the report of verifyProof
+type ReportDetails struct {
+	Description  string `json:"description"`
+	DocumentMeta string `json:"documentMeta"`
+}
+
+// GetTransientInput checks the transient input of the function against its schema
+// and unmarshals it into input; a missing input is an empty one
+func GetTransientInput(stub shim.ChaincodeStubInterface, function string, input interface{}) error {
+	schema, ok := transientSchemas[function]
+	if !ok {
+		return errors.New(fmt.Sprintf("function %s has no transient input", function))
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transient map: %s", err.Error()))
+	}
+
+	data, ok := transient[function]
+	if !ok || len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.New(fmt.Sprintf("transient input of %s must be a JSON object: %s", function, err.Error()))
+	}
+
+	known := make(map[string]bool)
+	for _, field := range schema {
+		known[field.Name] = true
+
+		value, ok := fields[field.Name]
+		if !ok || string(value) == "null" {
+			if field.Required {
+				return errors.New(fmt.Sprintf("transient field %s of %s is required", field.Name, function))
+			}
+			continue
+		}
+
+		if !transientTypeMatches(field.Type, value) {
+			return errors.New(fmt.Sprintf("transient field %s of %s must be a %s", field.Name, function, field.Type))
+		}
+	}
+
+	for name := range fields {
+		if !known[name] {
+			return errors.New(fmt.Sprintf("unknown transient field %s of %s", name, function))
+		}
+	}
+
+	return json.Unmarshal(data, input)
+}
+
+func transientTypeMatches(fieldType string, value json.RawMessage) bool {
+	switch fieldType {
+	case transientString:
+		var text string
+		return json.Unmarshal(value, &text) == nil
+	case transientNumber:
+		var number float64
+		return json.Unmarshal(value, &number) == nil
+	case transientObject:
+		var object map[string]json.RawMessage
+		return json.Unmarshal(value, &object) == nil
+	}
+
+	return false
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// AnalyticsWindow is the time window of a metric in unix seconds, a zero bound leaves it open
+type AnalyticsWindow struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+//argument order
+//0		1
+//From	To
+func ParseAnalyticsWindow(args []string) (AnalyticsWindow, error) {
+	window := AnalyticsWindow{}
+
+	for i, bound := range []*int64{&window.From, &window.To} {
+		if i < len(args) && args[i] != "" {
+			time, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || time < 0 {
+				return window, errors.New(fmt.Sprintf("time must be a non-negative integer, got %s", args[i]))
+			}
+			*bound = time
+		}
+	}
+
+	if window.To != 0 && window.To < window.From {
+		return window, errors.New(fmt.Sprintf("time window ends at %d before it starts at %d", window.To, window.From))
+	}
+
+	return window, nil
+}
+
+// Contains tells whether the time falls into the window
+func (window AnalyticsWindow) Contains(time int64) bool {
+	return (window.From == 0 || time >= window.From) && (window.To == 0 || time <= window.To)
+}
+
+// ratio is part of total, zero when there is nothing to divide
+func ratio(part float64, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total
+}
+
+// BuyerPayables is what a buyer owes on its invoices in a time window, the times are in days.
+// Days payable outstanding is the payables at the end of the window over the purchases
+// in the window times its length.
+type BuyerPayables struct {
+	Debtor                 string  `json:"debtor"`
+	Invoices               int     `json:"invoices"`
+	Purchases              float64 `json:"purchases"`
+	Payables               float64 `json:"payables"`
+	DaysPayableOutstanding float64 `json:"daysPayableOutstanding"`
+	AveragePaymentTerm     float64 `json:"averagePaymentTerm"`
+}
+
+// BuyerPayablesOf sums up the invoices of every debtor; an open window ends at now and starts
+// at the first invoice of the debtor. The ledger records no payments, so an invoice is payable
+// until its payment date. Removed and rejected invoices are left out.
+func BuyerPayablesOf(window AnalyticsWindow, now int64, invoices []Invoice) []BuyerPayables {
+	end := window.To
+	if end == 0 {
+		end = now
+	}
+
+	payables := make(map[string]*BuyerPayables)
+	starts := make(map[string]int64)
+	paymentTerms := make(map[string]int64)
+	for _, invoice := range invoices {
+		if invoice.Value.State == stateInvoiceRemoved || invoice.Value.State == stateInvoiceRejected || invoice.Value.Timestamp > end {
+			continue
+		}
+
+		debtor := invoice.Value.Debtor
+		if _, ok := payables[debtor]; !ok {
+			payables[debtor] = &BuyerPayables{Debtor: debtor}
+			starts[debtor] = invoice.Value.Timestamp
+		}
+		entry := payables[debtor]
+
+		if invoice.Value.Timestamp < starts[debtor] {
+			starts[debtor] = invoice.Value.Timestamp
+		}
+
+		if invoice.Value.PaymentDate > end {
+			entry.Payables += float64(invoice.Value.Outstanding)
+		}
+
+		if window.Contains(invoice.Value.Timestamp) {
+			entry.Invoices++
+			entry.Purchases += float64(invoice.Value.TotalDue)
+			paymentTerms[debtor] += invoice.Value.PaymentDate - invoice.Value.Timestamp
+		}
+	}
+
+	result := []BuyerPayables{}
+	for debtor, entry := range payables {
+		start := window.From
+		if start == 0 {
+			start = starts[debtor]
+		}
+
+		days := float64(end-start) / secondsPerDay
+		entry.DaysPayableOutstanding = ratio(entry.Payables, entry.Purchases) * days
+		entry.AveragePaymentTerm = ratio(float64(paymentTerms[debtor]), float64(entry.Invoices*secondsPerDay))
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Debtor < result[j].Debtor
+	})
+
+	return result
+}
+
+// FactorPortfolio is what a factor bought in a time window, the average rate is weighted
+// by the face value of the invoices
+type FactorPortfolio struct {
+	Factor      string  `json:"factor"`
+	Invoices    int     `json:"invoices"`
+	FaceValue   float64 `json:"faceValue"`
+	Outstanding float64 `json:"outstanding"`
+	AverageRate float64 `json:"averageRate"`
+}
+
+// FactorPortfoliosOf sums up the invoices of the bids accepted in the window by factor,
+// the outstanding amount is of the invoices the factor still owns
+func FactorPortfoliosOf(window AnalyticsWindow, bids []Bid, invoices []Invoice) []FactorPortfolio {
+	invoiceMap := make(map[string]InvoiceValue)
+	for _, invoice := range invoices {
+		invoiceMap[invoice.Key.ID] = invoice.Value
+	}
+
+	portfolios := make(map[string]*FactorPortfolio)
+	weightedRates := make(map[string]float64)
+	for _, bid := range bids {
+		if bid.Value.State != stateBidAccepted || !window.Contains(bid.Value.UpdatedDate) {
+			continue
+		}
+
+		invoice, ok := invoiceMap[bid.Value.InvoiceID]
+		if !ok {
+			continue
+		}
+
+		factor := bid.Value.FactorID
+		if _, ok := portfolios[factor]; !ok {
+			portfolios[factor] = &FactorPortfolio{Factor: factor}
+		}
+		entry := portfolios[factor]
+
+		entry.Invoices++
+		entry.FaceValue += float64(invoice.TotalDue)
+		weightedRates[factor] += float64(bid.Value.Rate) * float64(invoice.TotalDue)
+		if invoice.State == stateInvoiceSold && invoice.Owner == factor {
+			entry.Outstanding += float64(invoice.Outstanding)
+		}
+	}
+
+	result := []FactorPortfolio{}
+	for factor, entry := range portfolios {
+		entry.AverageRate = ratio(weightedRates[factor], entry.FaceValue)
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Factor < result[j].Factor
+	})
+
+	return result
+}
@@ -50,6 +50,7 @@ type BidKey struct {
 type BidValue struct {
 	Rate        float32 `json:"rate"`
 	FactorID    string  `json:"factorID"`
+	FactorMSP   string  `json:"factorMSP"`
 	InvoiceID   string  `json:"invoiceID"`
 	State       int     `json:"state"`
 	Timestamp   int64   `json:"timestamp"`
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// bill of lading state constants, as kept by the supply-chain chaincode
+const (
+	stateBillOfLadingUnknown = iota
+	stateBillOfLadingIssued
+	stateBillOfLadingEndorsed
+	stateBillOfLadingSurrendered
+)
+
+// BillOfLading is the view of the title document issued in the supply-chain chaincode
+type BillOfLading struct {
+	Key   BillOfLadingKey   `json:"key"`
+	Value BillOfLadingValue `json:"value"`
+}
+
+type BillOfLadingKey struct {
+	ID string `json:"id"`
+}
+
+type BillOfLadingValue struct {
+	ShipmentID string `json:"shipmentID"`
+	ContractID string `json:"contractID"`
+	Issuer     string `json:"issuer"`
+	Holder     string `json:"holder"`
+	State      int    `json:"state"`
+}
+
+// loadBillOfLading queries the supply-chain chaincode for the bill of lading
+func loadBillOfLading(stub shim.ChaincodeStubInterface, billOfLadingID string) (BillOfLading, error) {
+	billOfLading := BillOfLading{}
+
+	request := GetBillOfLadingRequest{BillOfLadingID: billOfLadingID}
+
+	if err := InvokeBridge(stub, bridgeGetBillOfLading, request, &billOfLading); err != nil {
+		return billOfLading, errors.New(fmt.Sprintf("unable to invoke \"%s\": %s", bridgeGetBillOfLading, err.Error()))
+	}
+
+	return billOfLading, nil
+}
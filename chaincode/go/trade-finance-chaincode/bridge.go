@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strconv"
+)
+
+// Version of the schema of the requests and the responses between the chaincodes,
+// a chaincode refuses requests of another version
+const bridgeVersion = 1
+
+// Function of a chaincode serving the requests of the other one
+const bridgeFunction = "bridge"
+
+// Functions callable through the bridge
+const (
+	bridgeRegisterInvoice    = "registerInvoice"
+	bridgeAcceptInvoice      = "acceptInvoice"
+	bridgeGetBillOfLading    = "getBillOfLading"
+	bridgeGetInvoice         = "getInvoice"
+	bridgePledgeBillOfLading = "pledgeBillOfLading"
+)
+
+// Codes of the errors returned through the bridge
+const (
+	bridgeErrorVersion     = "UNSUPPORTED_VERSION"
+	bridgeErrorRequest     = "INVALID_REQUEST"
+	bridgeErrorFunction    = "UNKNOWN_FUNCTION"
+	bridgeErrorDenied      = "ACCESS_DENIED"
+	bridgeErrorNotFound    = "NOT_FOUND"
+	bridgeErrorRejected    = "REJECTED"
+	bridgeErrorUnavailable = "UNAVAILABLE"
+)
+
+// BridgeTarget is the chaincode and the channel the other chaincode is invoked on
+type BridgeTarget struct {
+	Chaincode string `json:"chaincode"`
+	Channel   string `json:"channel"`
+}
+
+// BridgeRequest is the only argument of the bridge function
+type BridgeRequest struct {
+	Version  int             `json:"version"`
+	Function string          `json:"function"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// BridgeResponse is the payload of the response of the bridge function, successful or not
+type BridgeResponse struct {
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *BridgeError    `json:"error,omitempty"`
+}
+
+type BridgeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *BridgeError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Code, err.Message)
+}
+
+type RegisterInvoiceRequest struct {
+	InvoiceID   string  `json:"invoiceID"`
+	Debtor      string  `json:"debtor"`
+	Beneficiary string  `json:"beneficiary"`
+	TotalDue    float32 `json:"totalDue"`
+	PaymentDate int64   `json:"paymentDate"`
+	Guarantor   string  `json:"guarantor"`
+}
+
+type AcceptInvoiceRequest struct {
+	InvoiceID string `json:"invoiceID"`
+}
+
+type GetBillOfLadingRequest struct {
+	BillOfLadingID string `json:"billOfLadingID"`
+}
+
+type GetInvoiceRequest struct {
+	InvoiceID string `json:"invoiceID"`
+}
+
+type PledgeBillOfLadingRequest struct {
+	BillOfLadingID string `json:"billOfLadingID"`
+	InvoiceID      string `json:"invoiceID"`
+	SecuredParty   string `json:"securedParty"`
+}
+
+// ParseBridgeRequest reads the request of the bridge function and checks its version
+func ParseBridgeRequest(args []string) (BridgeRequest, *BridgeError) {
+	request := BridgeRequest{}
+
+	if len(args) < 1 {
+		return request, &BridgeError{Code: bridgeErrorRequest, Message: "arguments array must contain the request"}
+	}
+
+	if err := json.Unmarshal([]byte(args[0]), &request); err != nil {
+		return request, &BridgeError{Code: bridgeErrorRequest, Message: fmt.Sprintf("cannot unmarshal the request: %s", err.Error())}
+	}
+
+	if request.Version != bridgeVersion {
+		return request, &BridgeError{Code: bridgeErrorVersion, Message: fmt.Sprintf("expected version %d, got %d", bridgeVersion, request.Version)}
+	}
+
+	return request, nil
+}
+
+// Arguments returns the arguments of the function in the order the function reads them
+func (request *BridgeRequest) Arguments() ([]string, *BridgeError) {
+	invalid := func(err error) *BridgeError {
+		return &BridgeError{Code: bridgeErrorRequest, Message: fmt.Sprintf("cannot unmarshal the payload of %s: %s", request.Function, err.Error())}
+	}
+
+	switch request.Function {
+	case bridgeRegisterInvoice:
+		payload := RegisterInvoiceRequest{}
+		if err := json.Unmarshal(request.Payload, &payload); err != nil {
+			return nil, invalid(err)
+		}
+		return []string{payload.InvoiceID, payload.Debtor, payload.Beneficiary,
+			fmt.Sprintf("%f", payload.TotalDue), strconv.FormatInt(payload.PaymentDate, 10), payload.Guarantor}, nil
+	case bridgeAcceptInvoice:
+		payload := AcceptInvoiceRequest{}
+		if err := json.Unmarshal(request.Payload, &payload); err != nil {
+			return nil, invalid(err)
+		}
+		return []string{payload.InvoiceID}, nil
+	case bridgeGetBillOfLading:
+		payload := GetBillOfLadingRequest{}
+		if err := json.Unmarshal(request.Payload, &payload); err != nil {
+			return nil, invalid(err)
+		}
+		return []string{payload.BillOfLadingID}, nil
+	case bridgeGetInvoice:
+		payload := GetInvoiceRequest{}
+		if err := json.Unmarshal(request.Payload, &payload); err != nil {
+			return nil, invalid(err)
+		}
+		return []string{payload.InvoiceID}, nil
+	case bridgePledgeBillOfLading:
+		payload := PledgeBillOfLadingRequest{}
+		if err := json.Unmarshal(request.Payload, &payload); err != nil {
+			return nil, invalid(err)
+		}
+		return []string{payload.BillOfLadingID, payload.InvoiceID, payload.SecuredParty}, nil
+	}
+
+	return nil, &BridgeError{Code: bridgeErrorFunction, Message: fmt.Sprintf("function %s isn't served through the bridge", request.Function)}
+}
+
+// BridgeReply wraps the response of the served function into a bridge response,
+// a 404 of the function is told apart from the other failures
+func BridgeReply(response pb.Response) pb.Response {
+	if response.Status == 404 {
+		return BridgeFailure(response.Status, &BridgeError{Code: bridgeErrorNotFound, Message: response.Message})
+	}
+
+	if response.Status >= 400 {
+		return BridgeFailure(response.Status, &BridgeError{Code: bridgeErrorRejected, Message: response.Message})
+	}
+
+	bridgeResponse := BridgeResponse{Version: bridgeVersion}
+	if len(response.Payload) != 0 {
+		bridgeResponse.Payload = response.Payload
+	}
+
+	payload, err := json.Marshal(bridgeResponse)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(payload)
+}
+
+func BridgeFailure(status int32, bridgeError *BridgeError) pb.Response {
+	Logger.Error(bridgeError.Error())
+
+	payload, _ := json.Marshal(BridgeResponse{Version: bridgeVersion, Error: bridgeError})
+	return pb.Response{Status: status, Message: bridgeError.Error(), Payload: payload}
+}
+
+// InvokeBridge calls the function of the chaincode the config targets and unmarshals
+// the payload of its response into result; errors of the other side are *BridgeError
+func InvokeBridge(stub shim.ChaincodeStubInterface, function string, request interface{}, result interface{}) error {
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		return errors.New(fmt.Sprintf("persistence error: %s", err.Error()))
+	}
+	target := config.BridgeTarget()
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	requestBytes, err := json.Marshal(BridgeRequest{Version: bridgeVersion, Function: function, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	response := stub.InvokeChaincode(target.Chaincode, [][]byte{[]byte(bridgeFunction), requestBytes}, target.Channel)
+
+	bridgeResponse := BridgeResponse{}
+	if err := json.Unmarshal(response.Payload, &bridgeResponse); err != nil || bridgeResponse.Version == 0 {
+		// the peer answers without a bridge response if the chaincode isn't reachable
+		if response.Status >= 400 {
+			return &BridgeError{Code: bridgeErrorUnavailable, Message: fmt.Sprintf("%s on %s: %s", target.Chaincode, target.Channel, response.Message)}
+		}
+		return &BridgeError{Code: bridgeErrorRequest, Message: fmt.Sprintf("%s on %s answered without a bridge response", target.Chaincode, target.Channel)}
+	}
+
+	if bridgeResponse.Error != nil {
+		return bridgeResponse.Error
+	}
+
+	if bridgeResponse.Version != bridgeVersion {
+		return &BridgeError{Code: bridgeErrorVersion, Message: fmt.Sprintf("expected version %d, got %d", bridgeVersion, bridgeResponse.Version)}
+	}
+
+	if result != nil && len(bridgeResponse.Payload) != 0 {
+		if err := json.Unmarshal(bridgeResponse.Payload, result); err != nil {
+			return errors.New(fmt.Sprintf("cannot unmarshal the response of %s: %s", function, err.Error()))
+		}
+	}
+
+	return nil
+}
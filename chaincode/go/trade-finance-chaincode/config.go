@@ -5,25 +5,84 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 const chaincodeName = "TradeFinanceChaincode"
 
 // Namespaces constants
 const (
-	configIndex = "ConfigTF"
+	configIndex         = "ConfigTF"
+	configRevisionIndex = "ConfigTFRevision"
 )
 
-// OrganizationalUnit constants
-var (
-	Buyer           = []string{"Buyer"}
-	Supplier        = []string{"Supplier"}
-	Auditor         = []string{"Auditor-1", "Auditor-2"}
-	Factor          = []string{"Factor-1", "Factor-2"}
-	Bank            = []string{"Bank"}
-	TransportAgency = []string{"Transporter"}
+// Entity indexes a collection can be configured for
+var entityIndexes = []string{
+	invoiceIndex,
+	bidIndex,
+	creditNoteIndex,
+	eventIndex,
+}
+
+// Key-level endorsement policies: a change of the entity must be endorsed by the
+// peers of the organizations it names, see EndorsedData
+var endorsementPolicies = map[string]EndorsementPolicy{
+	invoiceIndex: {RoleType: statebased.RoleTypePeer, Create: CreateInvoice},
+}
+
+// Chaincode invoked through the bridge unless the config sets another one
+var defaultBridgeTarget = BridgeTarget{Chaincode: "supply-chain-chaincode", Channel: "common"}
+
+// Principal of a collection policy, e.g. 'ORG1MSP.member'
+var collectionPrincipal = regexp.MustCompile(`'([^'.]+)\.[a-z]+'`)
+
+// Roles of the role registry
+const (
+	roleBuyer       = "Buyer"
+	roleSupplier    = "Supplier"
+	roleAuditor     = "Auditor"
+	roleFactor      = "Factor"
+	roleBank        = "Bank"
+	roleTransporter = "Transporter"
+	roleAdmin       = "Admin"
 )
 
+// Organizational units the roles are granted to when the chaincode is instantiated
+var defaultRoleUnits = map[string][]string{
+	roleBuyer:       {"Buyer"},
+	roleSupplier:    {"Supplier"},
+	roleAuditor:     {"Auditor-1", "Auditor-2"},
+	roleFactor:      {"Factor-1", "Factor-2"},
+	roleBank:        {"Bank"},
+	roleTransporter: {"Transporter"},
+	roleAdmin:       {"Admin"},
+}
+
+// Functions an attribute policy can be set for, with the names of the arguments
+// their policies can refer to
+var policyArguments = map[string][]string{
+	"registerInvoice":       {"invoiceID", "debtor", "beneficiary", "amount", "dueDate", "guarantor"},
+	"acceptInvoice":         {"invoiceID"},
+	"rejectInvoice":         {"invoiceID"},
+	"placeInvoice":          {"invoiceID"},
+	"removeInvoice":         {"invoiceID"},
+	"placeBid":              {"bidID", "rate", "factorID", "invoiceID"},
+	"updateBid":             {"bidID", "rate", "factorID", "invoiceID"},
+	"cancelBid":             {"bidID"},
+	"acceptBid":             {"bidID"},
+	"setFactorLimits":       {"factorID", "maxPurchased", "maxPerDebtor", "maxPerGuarantor"},
+	"pledgeCollateral":      {"invoiceID", "billOfLadingID", "securedParty"},
+	"issueCreditNote":       {"creditNoteID", "invoiceID", "amount", "reason", "origin"},
+	"acknowledgeCreditNote": {"creditNoteID"},
+	"updateConfig":          {"config", "version"},
+	"grantRole":             {"role", "kind", "value"},
+	"revokeRole":            {"role", "kind", "value"},
+	"registerParticipant":   {"organizationalUnit", "mspID", "legalName", "lei", "country", "status", "kycStatus", "kycExpiry", "bankAccounts"},
+}
+
 // Numerical constants
 const (
 	configKeyFieldsNumber      = 0
@@ -32,16 +91,24 @@ const (
 
 // Type of events
 const (
-	eventRegisterInvoice = "registerInvoice"
-	eventAcceptInvoice   = "acceptInvoice"
-	eventRejectInvoice   = "rejectInvoice"
-	eventPlaceInvoice    = "placeInvoice"
-	eventRemoveInvoice   = "removeInvoice"
-	eventPlaceBid        = "placeBid"
-	eventUpdateBid       = "updateBid"
-	eventCancelBid       = "cancelBid"
-	eventAcceptBid       = "acceptBid"
-	eventInvoiceSold     = ""
+	eventRegisterInvoice     = "registerInvoice"
+	eventAcceptInvoice       = "acceptInvoice"
+	eventRejectInvoice       = "rejectInvoice"
+	eventPlaceInvoice        = "placeInvoice"
+	eventRemoveInvoice       = "removeInvoice"
+	eventPlaceBid            = "placeBid"
+	eventUpdateBid           = "updateBid"
+	eventCancelBid           = "cancelBid"
+	eventAcceptBid           = "acceptBid"
+	eventInvoiceSold         = ""
+	eventIssueCreditNote     = "issueCreditNote"
+	eventAckCreditNote       = "acknowledgeCreditNote"
+	eventPledgeCollateral    = "pledgeCollateral"
+	eventUpdateConfig        = "updateConfig"
+	eventGrantRole           = "grantRole"
+	eventRevokeRole          = "revokeRole"
+	eventSetFactorLimits     = "setFactorLimits"
+	eventRegisterParticipant = "registerParticipant"
 )
 
 var Logger = shim.NewLogger(chaincodeName)
@@ -55,13 +122,35 @@ type ConfigKey struct {
 }
 
 type ConfigValue struct {
-	Collections   []Collection `json:"collections"`
-	ChaincodeName string       `json:"chaincodeName"`
+	Collections   []Collection   `json:"collections"`
+	ChaincodeName string         `json:"chaincodeName"`
+	Policies      []AccessPolicy `json:"policies"`
+	Bridge        BridgeTarget   `json:"bridge"`
+	EventStorage  string         `json:"eventStorage"`
+	Version       int            `json:"version"`
+	UpdatedBy     string         `json:"updatedBy"`
+	UpdatedDate   int64          `json:"updatedDate"`
 }
 
+// Collection maps the entities to a private data collection shared by the members,
+// the MSP IDs of the organizations in its policy
 type Collection struct {
-	Name   string `json:"name"`
-	Policy string `json:"policy"`
+	Name     string   `json:"name"`
+	Policy   string   `json:"policy"`
+	Entities []string `json:"entities"`
+	Members  []string `json:"members"`
+}
+
+// AccessPolicy is the attribute policy an invoke function is restricted by, see Policy
+type AccessPolicy struct {
+	Function   string `json:"function"`
+	Expression string `json:"expression"`
+}
+
+// EndorsementPolicy is the key-level endorsement policy of an entity type
+type EndorsementPolicy struct {
+	RoleType statebased.RoleType
+	Create   FactoryMethod
 }
 
 func CreateConfig() LedgerData {
@@ -94,9 +183,205 @@ func (data *Config) FillFromArguments(stub shim.ChaincodeStubInterface, args []s
 	data.Value.Collections = collections
 	data.Value.ChaincodeName = chaincodeName
 
+	return data.Validate()
+}
+
+// Validate checks the config before it is stored by Init or updateConfig, it reads nothing
+// from the ledger as the peer refuses private data to Init
+func (data *Config) Validate() error {
+	if data.Value.ChaincodeName == "" {
+		return errors.New(fmt.Sprintf("chaincode name must be not empty"))
+	}
+
+	names := make(map[string]bool)
+	for _, collection := range data.Value.Collections {
+		if collection.Name == "" || names[collection.Name] {
+			return errors.New(fmt.Sprintf("collection name \"%s\" must be not empty and unique", collection.Name))
+		}
+		names[collection.Name] = true
+
+		if collection.Policy == "" {
+			return errors.New(fmt.Sprintf("collection %s must have a policy", collection.Name))
+		}
+
+		if len(collection.Entities) == 0 {
+			return errors.New(fmt.Sprintf("collection %s must be mapped to entities", collection.Name))
+		}
+
+		for _, entity := range collection.Entities {
+			known := false
+			for _, index := range entityIndexes {
+				if entity == index {
+					known = true
+				}
+			}
+
+			if !known {
+				return errors.New(fmt.Sprintf("collection %s is mapped to unknown entity %s", collection.Name, entity))
+			}
+		}
+
+		if len(collection.Members) == 0 {
+			return errors.New(fmt.Sprintf("collection %s must have members", collection.Name))
+		}
+
+		policyMembers := collectionPolicyMembers(collection.Policy)
+		for _, member := range collection.Members {
+			if !containsString(policyMembers, member) {
+				return errors.New(fmt.Sprintf("member %s of collection %s isn't in its policy", member, collection.Name))
+			}
+		}
+	}
+
+	// a member of two collections of the same entity would make its reads and writes ambiguous
+	for i, collection := range data.Value.Collections {
+		for _, other := range data.Value.Collections[i+1:] {
+			for _, entity := range collection.Entities {
+				if !containsString(other.Entities, entity) {
+					continue
+				}
+
+				for _, member := range collection.Members {
+					if containsString(other.Members, member) {
+						return errors.New(fmt.Sprintf("collections %s and %s both map %s of %s", collection.Name, other.Name, entity, member))
+					}
+				}
+			}
+		}
+	}
+
+	if bridge := data.Value.Bridge; (bridge.Chaincode == "") != (bridge.Channel == "") {
+		return errors.New(fmt.Sprintf("bridge must set both the chaincode and the channel"))
+	}
+
+	if storage := data.Value.EventStorage; storage != "" && storage != eventStorageState && storage != eventStorageNone {
+		return errors.New(fmt.Sprintf("unknown event storage %s: expected %s or %s", storage, eventStorageState, eventStorageNone))
+	}
+
+	policyFunctions := make(map[string]bool)
+	for _, policy := range data.Value.Policies {
+		if _, ok := policyArguments[policy.Function]; !ok {
+			return errors.New(fmt.Sprintf("policy for unknown function %s", policy.Function))
+		}
+
+		if policyFunctions[policy.Function] {
+			return errors.New(fmt.Sprintf("function %s has more than one policy", policy.Function))
+		}
+		policyFunctions[policy.Function] = true
+
+		if _, err := ParsePolicy(policy.Expression); err != nil {
+			return errors.New(fmt.Sprintf("policy of %s is invalid: %s", policy.Function, err.Error()))
+		}
+	}
+
 	return nil
 }
 
+// CheckCollectionsDefined reads from every collection of the config, the peer fails to read
+// from a collection missing in the collections config of the chaincode
+func (data *Config) CheckCollectionsDefined(stub shim.ChaincodeStubInterface) error {
+	for _, collection := range data.Value.Collections {
+		if _, err := stub.GetPrivateData(collection.Name, configIndex); err != nil {
+			return errors.New(fmt.Sprintf("collection %s isn't defined for the chaincode: %s", collection.Name, err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// CollectionsFor returns the collection the entity is mapped to whose members include every
+// participant. An entity mapped to no collection is kept in the public state and gets none,
+// no collection or several collections matching is an error.
+func (data *Config) CollectionsFor(index string, participants []string) ([]string, error) {
+	names := []string{}
+	mapped := false
+
+	for _, collection := range data.Value.Collections {
+		if !containsString(collection.Entities, index) {
+			continue
+		}
+		mapped = true
+
+		shared := true
+		for _, participant := range participants {
+			if !containsString(collection.Members, participant) {
+				shared = false
+			}
+		}
+
+		if shared {
+			names = append(names, collection.Name)
+		}
+	}
+
+	if mapped && len(names) == 0 {
+		return names, errors.New(fmt.Sprintf("no collection of %s is shared by %s", index, strings.Join(participants, ", ")))
+	}
+
+	if len(names) > 1 {
+		sort.Strings(names)
+		return names, errors.New(fmt.Sprintf("several collections of %s are shared by %s: %s", index, strings.Join(participants, ", "), strings.Join(names, ", ")))
+	}
+
+	return names, nil
+}
+
+// collectionPolicyMembers returns the MSP IDs of the principals of the policy, e.g. ORG1MSP of 'ORG1MSP.member'
+func collectionPolicyMembers(policy string) []string {
+	members := []string{}
+	for _, principal := range collectionPrincipal.FindAllStringSubmatch(policy, -1) {
+		members = append(members, principal[1])
+	}
+
+	return members
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BridgeTarget returns the chaincode and the channel the other chaincode is invoked on
+func (data *Config) BridgeTarget() BridgeTarget {
+	if data.Value.Bridge.Chaincode == "" && data.Value.Bridge.Channel == "" {
+		return defaultBridgeTarget
+	}
+
+	return data.Value.Bridge
+}
+
+// KeepsPrivate tells whether the entities of the index are kept in private collections
+func (data *Config) KeepsPrivate(index string) bool {
+	for _, collection := range data.Value.Collections {
+		if containsString(collection.Entities, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StoresEvents tells whether the events are kept in state besides the chaincode event of the transaction
+func (data *Config) StoresEvents() bool {
+	return data.Value.EventStorage != eventStorageNone
+}
+
+// Policy returns the attribute policy expression of the function, empty if it has none
+func (data *Config) Policy(function string) string {
+	for _, policy := range data.Value.Policies {
+		if policy.Function == function {
+			return policy.Expression
+		}
+	}
+
+	return ""
+}
+
 func (data *Config) FillFromCompositeKeyParts(compositeKeyParts []string) error {
 	return nil
 }
@@ -131,3 +416,62 @@ func (data *Config) ExistsIn(stub shim.ChaincodeStubInterface, collection string
 
 	return true
 }
+
+// Save stores the config as the given version and keeps the version in the change history
+func (data *Config) Save(stub shim.ChaincodeStubInterface, version int, updatedBy string) error {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	data.Value.Version = version
+	data.Value.UpdatedBy = updatedBy
+	data.Value.UpdatedDate = timestamp.Seconds
+
+	compositeKey, err := data.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+
+	value, err := data.ToLedgerValue()
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(compositeKey, value); err != nil {
+		return err
+	}
+
+	revisionKey, err := stub.CreateCompositeKey(configRevisionIndex, []string{fmt.Sprintf("%010d", version)})
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(revisionKey, value)
+}
+
+// ConfigHistory returns the stored versions of the config, the oldest first
+func ConfigHistory(stub shim.ChaincodeStubInterface) ([]ConfigValue, error) {
+	history := []ConfigValue{}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(configRevisionIndex, []string{})
+	if err != nil {
+		return history, err
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return history, err
+		}
+
+		revision := ConfigValue{}
+		if err := json.Unmarshal(response.Value, &revision); err != nil {
+			return history, err
+		}
+		history = append(history, revision)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/satori/go.uuid"
+	"strconv"
+)
+
+const (
+	creditNoteIndex = "CreditNote"
+)
+
+const (
+	creditNoteKeyFieldsNumber      = 1
+	creditNoteBasicArgumentsNumber = 5
+)
+
+//credit note state constants (from 0 to 2)
+const (
+	stateCreditNoteUnknown = iota
+	stateCreditNoteIssued
+	stateCreditNoteApplied
+)
+
+var creditNoteStateLegal = map[int][]int{
+	stateCreditNoteUnknown: {},
+	stateCreditNoteIssued:  {},
+	stateCreditNoteApplied: {},
+}
+
+var creditNoteStateMachine = map[int][]int{
+	stateCreditNoteUnknown: {stateCreditNoteUnknown},
+	stateCreditNoteIssued:  {stateCreditNoteApplied},
+	stateCreditNoteApplied: {stateCreditNoteApplied},
+}
+
+//credit note origin constants (from 0 to 3)
+const (
+	originCreditNoteUnknown = iota
+	originCreditNoteAdjustment
+	originCreditNoteDispute
+	originCreditNoteReturn
+)
+
+var allowedCreditNoteOrigins = map[int]bool{
+	originCreditNoteAdjustment: true,
+	originCreditNoteDispute:    true,
+	originCreditNoteReturn:     true,
+}
+
+type CreditNoteKey struct {
+	ID string `json:"id"`
+}
+
+type CreditNoteValue struct {
+	InvoiceID      string  `json:"invoiceID"`
+	Amount         float32 `json:"amount"`
+	Reason         string  `json:"reason"`
+	Origin         int     `json:"origin"`
+	Issuer         string  `json:"issuer"`
+	AcknowledgedBy string  `json:"acknowledgedBy"`
+	State          int     `json:"state"`
+	Timestamp      int64   `json:"timestamp"`
+	UpdatedDate    int64   `json:"updatedDate"`
+}
+
+type CreditNote struct {
+	Key   CreditNoteKey   `json:"key"`
+	Value CreditNoteValue `json:"value"`
+}
+
+func CreateCreditNote() LedgerData {
+	return new(CreditNote)
+}
+
+//argument order
+//0		1			2		3		4
+//ID	InvoiceID	Amount	Reason	Origin
+func (entity *CreditNote) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < creditNoteBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", creditNoteBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:creditNoteKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	// checking invoice
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts([]string{args[1]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	if !ExistsIn(stub, &invoice, invoiceIndex) {
+		compositeKey, _ := invoice.ToCompositeKey(stub)
+		return errors.New(fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey))
+	}
+	entity.Value.InvoiceID = invoice.Key.ID
+
+	// checking amount
+	amount, err := strconv.ParseFloat(args[2], 32)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to parse the amount: %s", err.Error()))
+	}
+	if amount <= 0 {
+		return errors.New("amount must be larger than zero")
+	}
+	entity.Value.Amount = float32(amount)
+
+	//checking reason
+	reason := args[3]
+	if reason == "" {
+		return errors.New(fmt.Sprintf("reason must be not empty"))
+	}
+	entity.Value.Reason = reason
+
+	//checking origin
+	origin, err := strconv.Atoi(args[4])
+	if err != nil {
+		return errors.New(fmt.Sprintf("origin is invalid: %s (must be int)", args[4]))
+	}
+	if !allowedCreditNoteOrigins[origin] {
+		return errors.New(fmt.Sprintf("unacceptable origin of credit note"))
+	}
+	entity.Value.Origin = origin
+
+	return nil
+}
+
+func (entity *CreditNote) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < creditNoteKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", creditNoteKeyFieldsNumber))
+	}
+
+	if id, err := uuid.FromString(compositeKeyParts[0]); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse an ID from \"%s\"", compositeKeyParts[0]))
+	} else if id.Version() != uuid.V4 {
+		return errors.New("wrong ID format; expected UUID version 4")
+	}
+
+	entity.Key.ID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *CreditNote) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *CreditNote) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.ID,
+	}
+
+	return stub.CreateCompositeKey(creditNoteIndex, compositeKeyParts)
+}
+
+func (entity *CreditNote) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"sort"
+	"strconv"
+)
+
+const (
+	factorLimitIndex = "FactorLimit"
+)
+
+const (
+	factorLimitKeyFieldsNumber      = 1
+	factorLimitBasicArgumentsNumber = 4
+)
+
+// Maturity buckets of the invoices of a portfolio, by the days left to the payment date
+const (
+	maturityOverdue = "overdue"
+	maturity30      = "0-30"
+	maturity60      = "31-60"
+	maturity90      = "61-90"
+	maturityOver90  = "over 90"
+)
+
+var maturityBuckets = []string{maturityOverdue, maturity30, maturity60, maturity90, maturityOver90}
+
+type FactorLimitKey struct {
+	FactorID string `json:"factorID"`
+}
+
+type FactorLimitValue struct {
+	MaxPurchased    float32 `json:"maxPurchased"`
+	MaxPerDebtor    float32 `json:"maxPerDebtor"`
+	MaxPerGuarantor float32 `json:"maxPerGuarantor"`
+	SetBy           string  `json:"setBy"`
+	Timestamp       int64   `json:"timestamp"`
+	UpdatedDate     int64   `json:"updatedDate"`
+}
+
+// FactorLimit caps the outstanding amount of the invoices a factor owns: in total, for a single
+// debtor and for a single guarantor; a zero cap leaves the amount uncapped
+type FactorLimit struct {
+	Key   FactorLimitKey   `json:"key"`
+	Value FactorLimitValue `json:"value"`
+}
+
+func CreateFactorLimit() LedgerData {
+	return new(FactorLimit)
+}
+
+//argument order
+//0			1				2				3
+//FactorID	MaxPurchased	MaxPerDebtor	MaxPerGuarantor
+func (entity *FactorLimit) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < factorLimitBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", factorLimitBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:factorLimitKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking caps
+	for i, limit := range []*float32{&entity.Value.MaxPurchased, &entity.Value.MaxPerDebtor, &entity.Value.MaxPerGuarantor} {
+		value, err := strconv.ParseFloat(args[1+i], 32)
+		if err != nil || value < 0 {
+			return errors.New(fmt.Sprintf("limit must be a non-negative number, got %s", args[1+i]))
+		}
+		*limit = float32(value)
+	}
+
+	return nil
+}
+
+func (entity *FactorLimit) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < factorLimitKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", factorLimitKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" {
+		return errors.New("factor must be not empty")
+	}
+
+	entity.Key.FactorID = compositeKeyParts[0]
+
+	return nil
+}
+
+func (entity *FactorLimit) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *FactorLimit) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.FactorID,
+	}
+
+	return stub.CreateCompositeKey(factorLimitIndex, compositeKeyParts)
+}
+
+func (entity *FactorLimit) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// findInvoicesOwnedBy returns the sold invoices the factor owns
+func findInvoicesOwnedBy(stub shim.ChaincodeStubInterface, factor string) ([]Invoice, error) {
+	filterByOwner := func(data LedgerData) bool {
+		invoice, ok := data.(*Invoice)
+		return ok && invoice.Value.State == stateInvoiceSold && invoice.Value.Owner == factor
+	}
+
+	invoices := []Invoice{}
+	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, filterByOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// CheckFactorLimits tells whether the factor stays within its limits owning the invoice
+// in addition to the invoices it owns; a factor with no limits isn't capped
+func CheckFactorLimits(stub shim.ChaincodeStubInterface, factor string, invoice Invoice) error {
+	limit := FactorLimit{Key: FactorLimitKey{FactorID: factor}}
+	if !ExistsIn(stub, &limit, factorLimitIndex) {
+		return nil
+	}
+
+	if err := LoadFrom(stub, &limit, factorLimitIndex); err != nil {
+		return err
+	}
+
+	owned, err := findInvoicesOwnedBy(stub, factor)
+	if err != nil {
+		return err
+	}
+
+	purchased := float64(invoice.Value.Outstanding)
+	debtor := purchased
+	guarantor := purchased
+	for _, entry := range owned {
+		if entry.Key.ID == invoice.Key.ID {
+			continue
+		}
+
+		purchased += float64(entry.Value.Outstanding)
+		if entry.Value.Debtor == invoice.Value.Debtor {
+			debtor += float64(entry.Value.Outstanding)
+		}
+		if entry.Value.Guarantor == invoice.Value.Guarantor {
+			guarantor += float64(entry.Value.Outstanding)
+		}
+	}
+
+	if limit.Value.MaxPurchased > 0 && purchased > float64(limit.Value.MaxPurchased) {
+		return errors.New(fmt.Sprintf("purchased amount %.2f exceeds the limit %.2f of %s", purchased, limit.Value.MaxPurchased, factor))
+	}
+
+	if limit.Value.MaxPerDebtor > 0 && debtor > float64(limit.Value.MaxPerDebtor) {
+		return errors.New(fmt.Sprintf("exposure %.2f to debtor %s exceeds the limit %.2f of %s", debtor, invoice.Value.Debtor, limit.Value.MaxPerDebtor, factor))
+	}
+
+	if limit.Value.MaxPerGuarantor > 0 && invoice.Value.Guarantor != "" && guarantor > float64(limit.Value.MaxPerGuarantor) {
+		return errors.New(fmt.Sprintf("exposure %.2f to guarantor %s exceeds the limit %.2f of %s", guarantor, invoice.Value.Guarantor, limit.Value.MaxPerGuarantor, factor))
+	}
+
+	return nil
+}
+
+// CheckBidLimits tells whether the factor stays within its limits if its bid for the invoice wins
+func CheckBidLimits(stub shim.ChaincodeStubInterface, factor string, invoiceID string) error {
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts([]string{invoiceID}); err != nil {
+		return err
+	}
+
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
+		return err
+	}
+
+	return CheckFactorLimits(stub, factor, invoice)
+}
+
+// PortfolioShare is the part of a portfolio with the same debtor, guarantor or maturity
+type PortfolioShare struct {
+	Key         string  `json:"key"`
+	Invoices    int     `json:"invoices"`
+	Outstanding float64 `json:"outstanding"`
+	Share       float64 `json:"share"`
+}
+
+// PortfolioBreakdown is the result of getFactorPortfolio; the debtors and guarantors are ordered
+// by outstanding amount, the maturity buckets from overdue to the latest
+type PortfolioBreakdown struct {
+	Factor      string            `json:"factor"`
+	Limits      *FactorLimitValue `json:"limits"`
+	Invoices    int               `json:"invoices"`
+	Outstanding float64           `json:"outstanding"`
+	ByDebtor    []PortfolioShare  `json:"byDebtor"`
+	ByGuarantor []PortfolioShare  `json:"byGuarantor"`
+	ByMaturity  []PortfolioShare  `json:"byMaturity"`
+}
+
+// maturityBucket is the bucket of an invoice paid at the payment date, seen at now
+func maturityBucket(paymentDate int64, now int64) string {
+	days := (paymentDate - now) / secondsPerDay
+	switch {
+	case paymentDate < now:
+		return maturityOverdue
+	case days <= 30:
+		return maturity30
+	case days <= 60:
+		return maturity60
+	case days <= 90:
+		return maturity90
+	default:
+		return maturityOver90
+	}
+}
+
+// PortfolioBreakdownOf breaks the invoices the factor owns down by debtor, guarantor
+// and maturity at now; invoices with no guarantor share the empty key
+func PortfolioBreakdownOf(factor string, owned []Invoice, now int64) PortfolioBreakdown {
+	breakdown := PortfolioBreakdown{Factor: factor}
+
+	byDebtor := make(map[string]*PortfolioShare)
+	byGuarantor := make(map[string]*PortfolioShare)
+	byMaturity := make(map[string]*PortfolioShare)
+	for _, bucket := range maturityBuckets {
+		byMaturity[bucket] = &PortfolioShare{Key: bucket}
+	}
+
+	add := func(shares map[string]*PortfolioShare, key string, outstanding float64) {
+		if _, ok := shares[key]; !ok {
+			shares[key] = &PortfolioShare{Key: key}
+		}
+		shares[key].Invoices++
+		shares[key].Outstanding += outstanding
+	}
+
+	for _, invoice := range owned {
+		outstanding := float64(invoice.Value.Outstanding)
+		breakdown.Invoices++
+		breakdown.Outstanding += outstanding
+
+		add(byDebtor, invoice.Value.Debtor, outstanding)
+		add(byGuarantor, invoice.Value.Guarantor, outstanding)
+		add(byMaturity, maturityBucket(invoice.Value.PaymentDate, now), outstanding)
+	}
+
+	shares := func(shares map[string]*PortfolioShare) []PortfolioShare {
+		result := []PortfolioShare{}
+		for _, share := range shares {
+			share.Share = ratio(share.Outstanding, breakdown.Outstanding)
+			result = append(result, *share)
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Outstanding != result[j].Outstanding {
+				return result[i].Outstanding > result[j].Outstanding
+			}
+			return result[i].Key < result[j].Key
+		})
+
+		return result
+	}
+
+	breakdown.ByDebtor = shares(byDebtor)
+	breakdown.ByGuarantor = shares(byGuarantor)
+
+	breakdown.ByMaturity = []PortfolioShare{}
+	for _, bucket := range maturityBuckets {
+		byMaturity[bucket].Share = ratio(byMaturity[bucket].Outstanding, breakdown.Outstanding)
+		breakdown.ByMaturity = append(breakdown.ByMaturity, *byMaturity[bucket])
+	}
+
+	return breakdown
+}
@@ -54,11 +54,15 @@ type InvoiceKey struct {
 type InvoiceValue struct {
 	Debtor      string  `json:"debtor"`
 	Beneficiary string  `json:"beneficiary"`
+	Seller      string  `json:"seller"`
 	TotalDue    float32 `json:"totalDue"`
+	Outstanding float32 `json:"outstanding"`
 	PaymentDate int64   `json:"paymentDate"`
 	State       int     `json:"state"`
 	Guarantor   string  `json:"guarantor"`
+	Collateral  string  `json:"collateral"`
 	Owner       string  `json:"owner"`
+	OwnerMSP    string  `json:"ownerMSP"`
 	Timestamp   int64   `json:"timestamp"`
 	UpdatedDate int64   `json:"updatedDate"`
 }
@@ -149,9 +153,21 @@ func (entity *Invoice) FillFromCompositeKeyParts(compositeKeyParts []string) err
 func (entity *Invoice) FillFromLedgerValue(ledgerValue []byte) error {
 	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
 		return err
-	} else {
-		return nil
 	}
+
+	//invoices registered before credit notes have no outstanding amount, nothing is credited against them
+	stored := struct {
+		Outstanding *float32 `json:"outstanding"`
+	}{}
+	if err := json.Unmarshal(ledgerValue, &stored); err != nil {
+		return err
+	}
+
+	if stored.Outstanding == nil {
+		entity.Value.Outstanding = entity.Value.TotalDue
+	}
+
+	return nil
 }
 
 func (entity *Invoice) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
@@ -165,3 +181,8 @@ func (entity *Invoice) ToCompositeKey(stub shim.ChaincodeStubInterface) (string,
 func (entity *Invoice) ToLedgerValue() ([]byte, error) {
 	return json.Marshal(entity.Value)
 }
+
+// EndorsingOrganizations returns the organization of the owner
+func (entity *Invoice) EndorsingOrganizations() []string {
+	return []string{entity.Value.OwnerMSP}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"math/big"
+	"strconv"
+)
+
+const (
+	participantIndex = "Participant"
+)
+
+const (
+	participantKeyFieldsNumber      = 2
+	participantBasicArgumentsNumber = 9
+)
+
+// Statuses of a participant, a suspended one can't trade
+const (
+	participantActive    = "active"
+	participantSuspended = "suspended"
+)
+
+// KYC statuses of a participant, only a verified one can trade until the KYC expires
+const (
+	kycPending  = "pending"
+	kycVerified = "verified"
+	kycRejected = "rejected"
+)
+
+type ParticipantKey struct {
+	OrganizationalUnit string `json:"organizationalUnit"`
+	MSPID              string `json:"mspID"`
+}
+
+// BankAccount is a reference to an account of a participant, the account itself is kept off the ledger
+type BankAccount struct {
+	Bank      string `json:"bank"`
+	Reference string `json:"reference"`
+	Currency  string `json:"currency"`
+}
+
+type ParticipantValue struct {
+	LegalName    string        `json:"legalName"`
+	LEI          string        `json:"lei"`
+	Country      string        `json:"country"`
+	Status       string        `json:"status"`
+	KYCStatus    string        `json:"kycStatus"`
+	KYCExpiry    int64         `json:"kycExpiry"`
+	BankAccounts []BankAccount `json:"bankAccounts"`
+	RegisteredBy string        `json:"registeredBy"`
+	Timestamp    int64         `json:"timestamp"`
+	UpdatedDate  int64         `json:"updatedDate"`
+}
+
+// Participant is the legal identity behind the organizational unit of an MSP, the parties
+// of orders, contracts, invoices and bids are identified by the organizational unit
+type Participant struct {
+	Key   ParticipantKey   `json:"key"`
+	Value ParticipantValue `json:"value"`
+}
+
+func CreateParticipant() LedgerData {
+	return new(Participant)
+}
+
+//argument order
+//0						1		2			3	4		5		6			7			8
+//OrganizationalUnit	MSPID	LegalName	LEI	Country	Status	KYCStatus	KYCExpiry	BankAccounts
+func (entity *Participant) FillFromArguments(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) < participantBasicArgumentsNumber {
+		return errors.New(fmt.Sprintf("arguments array must contain at least %d items", participantBasicArgumentsNumber))
+	}
+
+	if err := entity.FillFromCompositeKeyParts(args[:participantKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message)
+	}
+
+	//checking legal name
+	if args[2] == "" {
+		return errors.New("legal name must be not empty")
+	}
+	entity.Value.LegalName = args[2]
+
+	//checking LEI
+	if !validLEI(args[3]) {
+		return errors.New(fmt.Sprintf("LEI must be 20 letters and digits with valid check digits, got \"%s\"", args[3]))
+	}
+	entity.Value.LEI = args[3]
+
+	//checking country
+	if len(args[4]) != 2 || !isLetters(args[4]) {
+		return errors.New(fmt.Sprintf("country must be an ISO 3166 alpha-2 code, got \"%s\"", args[4]))
+	}
+	entity.Value.Country = args[4]
+
+	//checking status
+	if args[5] != participantActive && args[5] != participantSuspended {
+		return errors.New(fmt.Sprintf("status must be %s or %s, got \"%s\"", participantActive, participantSuspended, args[5]))
+	}
+	entity.Value.Status = args[5]
+
+	//checking KYC
+	if args[6] != kycPending && args[6] != kycVerified && args[6] != kycRejected {
+		return errors.New(fmt.Sprintf("KYC status must be %s, %s or %s, got \"%s\"", kycPending, kycVerified, kycRejected, args[6]))
+	}
+	entity.Value.KYCStatus = args[6]
+
+	expiry, err := strconv.ParseInt(args[7], 10, 64)
+	if err != nil || expiry < 0 {
+		return errors.New(fmt.Sprintf("KYC expiry must be a non-negative integer, got %s", args[7]))
+	}
+	if entity.Value.KYCStatus == kycVerified && expiry == 0 {
+		return errors.New("verified KYC must expire")
+	}
+	entity.Value.KYCExpiry = expiry
+
+	//checking bank accounts
+	entity.Value.BankAccounts = []BankAccount{}
+	if args[8] != "" {
+		if err := json.Unmarshal([]byte(args[8]), &entity.Value.BankAccounts); err != nil {
+			return errors.New(fmt.Sprintf("bank accounts are invalid: %s", err.Error()))
+		}
+	}
+
+	for _, account := range entity.Value.BankAccounts {
+		if account.Bank == "" || account.Reference == "" {
+			return errors.New("bank account must have a bank and a reference")
+		}
+	}
+
+	return nil
+}
+
+func (entity *Participant) FillFromCompositeKeyParts(compositeKeyParts []string) error {
+	if len(compositeKeyParts) < participantKeyFieldsNumber {
+		return errors.New(fmt.Sprintf("composite key parts array must contain at least %d items", participantKeyFieldsNumber))
+	}
+
+	if compositeKeyParts[0] == "" || compositeKeyParts[1] == "" {
+		return errors.New("organizational unit and MSPID must be not empty")
+	}
+
+	entity.Key.OrganizationalUnit = compositeKeyParts[0]
+	entity.Key.MSPID = compositeKeyParts[1]
+
+	return nil
+}
+
+func (entity *Participant) FillFromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, &entity.Value); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (entity *Participant) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	compositeKeyParts := []string{
+		entity.Key.OrganizationalUnit,
+		entity.Key.MSPID,
+	}
+
+	return stub.CreateCompositeKey(participantIndex, compositeKeyParts)
+}
+
+func (entity *Participant) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(entity.Value)
+}
+
+// CanTrade tells why the participant can't trade at the time, nil if it can
+func (entity *Participant) CanTrade(timestamp int64) error {
+	if entity.Value.Status != participantActive {
+		return errors.New(fmt.Sprintf("participant %s of %s is %s", entity.Key.OrganizationalUnit, entity.Key.MSPID, entity.Value.Status))
+	}
+
+	if entity.Value.KYCStatus != kycVerified {
+		return errors.New(fmt.Sprintf("KYC of participant %s of %s is %s", entity.Key.OrganizationalUnit, entity.Key.MSPID, entity.Value.KYCStatus))
+	}
+
+	if entity.Value.KYCExpiry <= timestamp {
+		return errors.New(fmt.Sprintf("KYC of participant %s of %s expired at %d", entity.Key.OrganizationalUnit, entity.Key.MSPID, entity.Value.KYCExpiry))
+	}
+
+	return nil
+}
+
+// FindParticipants returns the participants with the organizational unit, or every participant if it's empty
+func FindParticipants(stub shim.ChaincodeStubInterface, organizationalUnit string) ([]Participant, error) {
+	participants := []Participant{}
+
+	keyParts := []string{}
+	if organizationalUnit != "" {
+		keyParts = append(keyParts, organizationalUnit)
+	}
+
+	participantsBytes, err := Query(stub, participantIndex, keyParts, CreateParticipant, EmptyFilter)
+	if err != nil {
+		return participants, err
+	}
+
+	if err := json.Unmarshal(participantsBytes, &participants); err != nil {
+		return participants, err
+	}
+
+	return participants, nil
+}
+
+// CheckParticipant tells why the party can't trade, nil if it can; a party known only by its
+// organizational unit, e.g. the debtor of an invoice, must be able to trade under every MSP
+// it is registered with
+func CheckParticipant(stub shim.ChaincodeStubInterface, organizationalUnit string, mspID string) error {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to get transaction timestamp: %s", err.Error()))
+	}
+
+	participants := []Participant{}
+	if mspID != "" {
+		participant := Participant{Key: ParticipantKey{OrganizationalUnit: organizationalUnit, MSPID: mspID}}
+		if ExistsIn(stub, &participant, participantIndex) {
+			if err := LoadFrom(stub, &participant, participantIndex); err != nil {
+				return err
+			}
+			participants = append(participants, participant)
+		}
+	} else if organizationalUnit != "" {
+		if participants, err = FindParticipants(stub, organizationalUnit); err != nil {
+			return err
+		}
+	}
+
+	if len(participants) == 0 && mspID != "" {
+		return errors.New(fmt.Sprintf("participant %s of %s is not registered", organizationalUnit, mspID))
+	} else if len(participants) == 0 {
+		return errors.New(fmt.Sprintf("participant %s is not registered", organizationalUnit))
+	}
+
+	for _, participant := range participants {
+		if err := participant.CanTrade(timestamp.Seconds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckCreatorParticipant tells why the creator of the transaction can't trade, nil if it can
+func CheckCreatorParticipant(stub shim.ChaincodeStubInterface) error {
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error()))
+	}
+
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error()))
+	}
+
+	return CheckParticipant(stub, creator, mspID)
+}
+
+// validLEI checks the ISO 17442 check digits of the LEI: with the letters turned
+// into numbers from 10 to 35, the LEI is 1 modulo 97
+func validLEI(lei string) bool {
+	if len(lei) != 20 {
+		return false
+	}
+
+	digits := ""
+	for _, char := range lei {
+		switch {
+		case char >= '0' && char <= '9':
+			digits += string(char)
+		case char >= 'A' && char <= 'Z':
+			digits += strconv.Itoa(int(char-'A') + 10)
+		default:
+			return false
+		}
+	}
+
+	number, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return false
+	}
+
+	return new(big.Int).Mod(number, big.NewInt(97)).Int64() == 1
+}
+
+func isLetters(value string) bool {
+	for _, char := range value {
+		if char < 'A' || char > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
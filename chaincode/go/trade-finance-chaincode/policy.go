@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Policy is an attribute-based access rule, e.g. "role==factor && approvalLimit>=amount".
+//
+// The left side of a comparison names a certificate attribute issued by the Fabric CA,
+// the right side is a number, a quoted string, an argument of the invoked function or
+// a bare word taken literally. A lone attribute name requires the attribute to be "true".
+// Comparisons with a missing attribute are false.
+type Policy struct {
+	Expression string
+	root       policyNode
+}
+
+// AttributeSource returns the value of a certificate attribute and whether it is set
+type AttributeSource func(name string) (string, bool, error)
+
+type policyNode interface {
+	evaluate(attributes AttributeSource, variables map[string]string) (bool, error)
+}
+
+type policyOr struct {
+	left, right policyNode
+}
+
+type policyAnd struct {
+	left, right policyNode
+}
+
+type policyNot struct {
+	operand policyNode
+}
+
+type policyComparison struct {
+	attribute string
+	operator  string
+	operand   policyToken
+}
+
+const (
+	policyTokenIdentifier = iota
+	policyTokenNumber
+	policyTokenString
+	policyTokenOperator
+)
+
+type policyToken struct {
+	kind  int
+	value string
+}
+
+// ParsePolicy parses the expression of a policy
+func ParsePolicy(expression string) (*Policy, error) {
+	tokens, err := tokenizePolicy(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &policyParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.position != len(tokens) {
+		return nil, errors.New(fmt.Sprintf("unexpected \"%s\" in policy", tokens[parser.position].value))
+	}
+
+	return &Policy{Expression: expression, root: root}, nil
+}
+
+// Evaluate checks the policy against the attributes of the creator and the
+// arguments of the invoked function
+func (policy *Policy) Evaluate(attributes AttributeSource, variables map[string]string) (bool, error) {
+	return policy.root.evaluate(attributes, variables)
+}
+
+func (node *policyOr) evaluate(attributes AttributeSource, variables map[string]string) (bool, error) {
+	if result, err := node.left.evaluate(attributes, variables); err != nil || result {
+		return result, err
+	}
+
+	return node.right.evaluate(attributes, variables)
+}
+
+func (node *policyAnd) evaluate(attributes AttributeSource, variables map[string]string) (bool, error) {
+	if result, err := node.left.evaluate(attributes, variables); err != nil || !result {
+		return result, err
+	}
+
+	return node.right.evaluate(attributes, variables)
+}
+
+func (node *policyNot) evaluate(attributes AttributeSource, variables map[string]string) (bool, error) {
+	result, err := node.operand.evaluate(attributes, variables)
+	return !result, err
+}
+
+func (node *policyComparison) evaluate(attributes AttributeSource, variables map[string]string) (bool, error) {
+	value, found, err := attributes(node.attribute)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("cannot obtain attribute %s: %s", node.attribute, err.Error()))
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	if node.operator == "" {
+		return strings.EqualFold(value, "true"), nil
+	}
+
+	operand := node.operand.value
+	if variable, ok := variables[operand]; ok && node.operand.kind == policyTokenIdentifier {
+		operand = variable
+	}
+
+	left, leftErr := strconv.ParseFloat(value, 64)
+	right, rightErr := strconv.ParseFloat(operand, 64)
+	numeric := leftErr == nil && rightErr == nil
+
+	switch node.operator {
+	case "==":
+		if numeric {
+			return left == right, nil
+		}
+		return strings.EqualFold(value, operand), nil
+	case "!=":
+		if numeric {
+			return left != right, nil
+		}
+		return !strings.EqualFold(value, operand), nil
+	}
+
+	// ordering is defined for numbers only
+	if !numeric {
+		return false, nil
+	}
+
+	switch node.operator {
+	case ">=":
+		return left >= right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case "<":
+		return left < right, nil
+	}
+
+	return false, errors.New(fmt.Sprintf("unknown operator %s", node.operator))
+}
+
+type policyParser struct {
+	tokens   []policyToken
+	position int
+}
+
+func (parser *policyParser) peek() (policyToken, bool) {
+	if parser.position < len(parser.tokens) {
+		return parser.tokens[parser.position], true
+	}
+
+	return policyToken{}, false
+}
+
+func (parser *policyParser) accept(operator string) bool {
+	if token, ok := parser.peek(); ok && token.kind == policyTokenOperator && token.value == operator {
+		parser.position++
+		return true
+	}
+
+	return false
+}
+
+func (parser *policyParser) parseOr() (policyNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.accept("||") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &policyOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (parser *policyParser) parseAnd() (policyNode, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.accept("&&") {
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &policyAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (parser *policyParser) parseUnary() (policyNode, error) {
+	if parser.accept("!") {
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &policyNot{operand}, nil
+	}
+
+	if parser.accept("(") {
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !parser.accept(")") {
+			return nil, errors.New("missing \")\" in policy")
+		}
+		return node, nil
+	}
+
+	token, ok := parser.peek()
+	if !ok || token.kind != policyTokenIdentifier {
+		return nil, errors.New(fmt.Sprintf("policy expects an attribute name, got \"%s\"", token.value))
+	}
+	parser.position++
+
+	comparison := &policyComparison{attribute: token.value}
+	for _, operator := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if parser.accept(operator) {
+			operand, ok := parser.peek()
+			if !ok || operand.kind == policyTokenOperator {
+				return nil, errors.New(fmt.Sprintf("policy expects a value after %s %s", token.value, operator))
+			}
+			parser.position++
+
+			comparison.operator = operator
+			comparison.operand = operand
+			break
+		}
+	}
+
+	return comparison, nil
+}
+
+func tokenizePolicy(expression string) ([]policyToken, error) {
+	tokens := []policyToken{}
+	runes := []rune(expression)
+
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.New("unterminated string in policy")
+			}
+			tokens = append(tokens, policyToken{policyTokenString, string(runes[i+1 : end])})
+			i = end + 1
+		case isWord(r):
+			end := i
+			for end < len(runes) && isWord(runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			kind := policyTokenIdentifier
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				kind = policyTokenNumber
+			}
+			tokens = append(tokens, policyToken{kind, word})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, errors.New(fmt.Sprintf("unexpected \"%c\" in policy", r))
+			}
+			tokens = append(tokens, policyToken{policyTokenOperator, operator})
+			i += len([]rune(operator))
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("policy is empty")
+	}
+
+	return tokens, nil
+}
+
+// checkAccessForPolicy evaluates the policy the config sets for the function against
+// the certificate attributes of the creator; functions without a policy are allowed
+func checkAccessForPolicy(stub shim.ChaincodeStubInterface, function string, args []string) (error, bool) {
+	names, ok := policyArguments[function]
+	if !ok {
+		return nil, true
+	}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), false
+	}
+
+	expression := config.Policy(function)
+	if expression == "" {
+		return nil, true
+	}
+
+	policy, err := ParsePolicy(expression)
+	if err != nil {
+		message := fmt.Sprintf("policy of %s is invalid: %s", function, err.Error())
+		Logger.Error(message)
+		return errors.New(message), false
+	}
+
+	// arguments are available to the policy by the names the function declares
+	variables := make(map[string]string)
+	for i, name := range names {
+		if i < len(args) {
+			variables[name] = args[i]
+		}
+	}
+
+	attributes := func(name string) (string, bool, error) {
+		return cid.GetAttributeValue(stub, name)
+	}
+
+	result, err := policy.Evaluate(attributes, variables)
+	if err != nil {
+		message := fmt.Sprintf("cannot evaluate policy of %s: %s", function, err.Error())
+		Logger.Error(message)
+		return errors.New(message), false
+	}
+
+	return nil, result
+}
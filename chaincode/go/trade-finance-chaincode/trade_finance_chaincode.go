@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"strconv"
 )
 
 type TradeFinanceChaincode struct {
@@ -19,29 +21,34 @@ func (cc *TradeFinanceChaincode) Init(stub shim.ChaincodeStubInterface) pb.Respo
 	message := fmt.Sprintf("Received args: %s", []string(args))
 	Logger.Debug(message)
 
+	// the config is changed by updateConfig once it is stored, an upgrade keeps it
 	config := Config{}
-	if err := config.FillFromArguments(stub, args); err != nil {
-		message := fmt.Sprintf("cannot fill a config from arguments: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
-	}
+	if config.ExistsIn(stub, "") {
+		Logger.Debug("Config already exists")
+	} else {
+		if err := config.FillFromArguments(stub, args); err != nil {
+			message := fmt.Sprintf("cannot fill a config from arguments: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
 
-	compositeKey, err := config.ToCompositeKey(stub)
-	if err != nil {
-		message := fmt.Sprintf("persistence error: %s", err.Error())
-		Logger.Error(message)
-		return pb.Response{Status: 500, Message: message}
+		Logger.Debug("PutState")
+		if err := config.Save(stub, 1, ""); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
 	}
 
-	value, err := config.ToLedgerValue()
-	if err != nil {
+	// the default roles are granted once, later the registry is changed by grantRole and revokeRole
+	if err := SeedRoleMembers(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
 	}
 
-	Logger.Debug("PutState")
-	if err = stub.PutState(compositeKey, value); err != nil {
+	// the events stored before they were indexed by time are indexed on upgrade
+	if err := IndexStoredEvents(stub); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
 		return pb.Response{Status: 500, Message: message}
@@ -54,6 +61,17 @@ func (cc *TradeFinanceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 	Logger.Debug("Invoke")
 
 	function, args := stub.GetFunctionAndParameters()
+
+	// the attribute policy of the function, if the config sets one, applies before its own checks
+	if err, result := checkAccessForPolicy(stub, function, args); err != nil || !result {
+		message := fmt.Sprintf("access to %s is denied by its policy", function)
+		if err != nil {
+			message = fmt.Sprintf("%s: %s", message, err.Error())
+		}
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	if function == "registerInvoice" {
 		// Supplier (or Buyer?) adds an invoice to Trade-Finance CC ledger
 		return cc.registerInvoice(stub, args)
@@ -79,6 +97,9 @@ func (cc *TradeFinanceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 	} else if function == "acceptBid" {
 		// Invoice owner accepts the bid; ownership of the invoice is transferred to Factor; Buyer is notified about changes
 		return cc.acceptBid(stub, args)
+	} else if function == "pledgeCollateral" {
+		// Invoice owner secures the invoice with the bill of lading it holds
+		return cc.pledgeCollateral(stub, args)
 	} else if function == "listBids" {
 		// List all bids (for testing purposes
 		return cc.listBids(stub, args)
@@ -90,13 +111,68 @@ func (cc *TradeFinanceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Res
 		return cc.listInvoices(stub, args)
 	} else if function == "listInvoicesByGuarantor" {
 		return cc.listInvoicesByGuarantor(stub, args)
+	} else if function == "getBuyerPayables" {
+		// Purchases, payables and days payable outstanding per buyer in a time window
+		return cc.getBuyerPayables(stub, args)
+	} else if function == "setFactorLimits" {
+		// Admin caps the purchased amount of a factor and its exposure to a single debtor and guarantor
+		return cc.setFactorLimits(stub, args)
+	} else if function == "getFactorPortfolio" {
+		// Invoices a factor owns by debtor, guarantor and maturity
+		return cc.getFactorPortfolio(stub, args)
+	} else if function == "getFactorPortfolios" {
+		// Invoices bought, their face value and the outstanding amount per factor in a time window
+		return cc.getFactorPortfolios(stub, args)
+	} else if function == "issueCreditNote" {
+		// Invoice beneficiary issues a credit note reducing the outstanding amount of the invoice
+		return cc.issueCreditNote(stub, args)
+	} else if function == "acknowledgeCreditNote" {
+		// Owner of a sold invoice acknowledges the credit note
+		return cc.acknowledgeCreditNote(stub, args)
+	} else if function == "listCreditNotes" {
+		// List credit notes visible to the caller
+		return cc.listCreditNotes(stub, args)
+	} else if function == "listCreditNotesForInvoice" {
+		return cc.listCreditNotesForInvoice(stub, args)
+	} else if function == "getInvoice" {
+		// Invoice by its ID, the supply-chain chaincode reconciles its contracts with it
+		return cc.getInvoice(stub, args)
 	} else if function == "getEventPayload" {
 		return cc.getEventPayload(stub, args)
+	} else if function == "listEvents" {
+		// Events filtered by entity, action, creator and time window, page by page
+		return cc.listEvents(stub, args)
+	} else if function == "getEndorsementPolicy" {
+		// Organizations whose peers must endorse a change of the entity
+		return cc.getEndorsementPolicy(stub, args)
+	} else if function == bridgeFunction {
+		// The other chaincode calls a function through the versioned bridge schema
+		return cc.bridge(stub, args)
+	} else if function == "grantRole" {
+		// Admin grants a role to an MSP, an organizational unit or a certificate attribute
+		return cc.grantRole(stub, args)
+	} else if function == "revokeRole" {
+		return cc.revokeRole(stub, args)
+	} else if function == "listRoleMembers" {
+		return cc.listRoleMembers(stub, args)
+	} else if function == "registerParticipant" {
+		// Bank or admin registers the legal identity and KYC status behind an organizational unit
+		return cc.registerParticipant(stub, args)
+	} else if function == "listParticipants" {
+		return cc.listParticipants(stub, args)
+	} else if function == "getConfig" {
+		return cc.getConfig(stub, args)
+	} else if function == "getConfigHistory" {
+		return cc.getConfigHistory(stub, args)
+	} else if function == "updateConfig" {
+		// Admin replaces the config, the previous versions are kept in its history
+		return cc.updateConfig(stub, args)
 	}
 	// (optional) add other query functions
 
 	fnList := "{registerInvoice, placeInvoice, rejectInvoice, placeBid, updateBid, cancelBid, acceptBid, " +
-		"listBids, listBidsForInvoice, listInvoices, listInvoicesByGuarantor, getEventPayload}"
+		"pledgeCollateral, listBids, listBidsForInvoice, listInvoices, listInvoicesByGuarantor, getBuyerPayables, getFactorPortfolios, setFactorLimits, getFactorPortfolio, issueCreditNote, acknowledgeCreditNote, " +
+		"listCreditNotes, listCreditNotesForInvoice, getInvoice, getEventPayload, listEvents, getEndorsementPolicy, bridge, getConfig, getConfigHistory, updateConfig, grantRole, revokeRole, listRoleMembers, registerParticipant, listParticipants}"
 	message := fmt.Sprintf("invalid invoke function name: expected one of %s, got %s", fnList, function)
 	Logger.Debug(message)
 
@@ -114,7 +190,7 @@ func (cc *TradeFinanceChaincode) registerInvoice(stub shim.ChaincodeStubInterfac
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to register an invoice")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -133,6 +209,25 @@ func (cc *TradeFinanceChaincode) registerInvoice(stub shim.ChaincodeStubInterfac
 		return shim.Error(fmt.Sprintf("invoice with the key %s already exists", compositeKey))
 	}
 
+	//checking the parties of the invoice are registered and can trade
+	if err := CheckCreatorParticipant(stub); err != nil {
+		message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	for _, party := range []string{invoice.Value.Debtor, invoice.Value.Beneficiary, invoice.Value.Guarantor} {
+		if party == "" {
+			continue
+		}
+
+		if err := CheckParticipant(stub, party, ""); err != nil {
+			message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
 	//setting automatic values
 	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
@@ -142,6 +237,13 @@ func (cc *TradeFinanceChaincode) registerInvoice(stub shim.ChaincodeStubInterfac
 	}
 	Logger.Debug("OrganizationalUnit: " + creator)
 
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -151,7 +253,10 @@ func (cc *TradeFinanceChaincode) registerInvoice(stub shim.ChaincodeStubInterfac
 	}
 
 	invoice.Value.Owner = creator
+	invoice.Value.OwnerMSP = mspID
+	invoice.Value.Seller = creator
 	invoice.Value.State = stateInvoiceIssued
+	invoice.Value.Outstanding = invoice.Value.TotalDue
 	invoice.Value.Timestamp = timestamp.Seconds
 	invoice.Value.UpdatedDate = invoice.Value.Timestamp
 
@@ -200,7 +305,7 @@ func (cc *TradeFinanceChaincode) placeInvoice(stub shim.ChaincodeStubInterface,
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier, Factor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier, roleFactor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place an invoice")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -308,7 +413,7 @@ func (cc *TradeFinanceChaincode) removeInvoice(stub shim.ChaincodeStubInterface,
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier, Factor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier, roleFactor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to remove an invoice")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -443,7 +548,7 @@ func (cc *TradeFinanceChaincode) acceptInvoice(stub shim.ChaincodeStubInterface,
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to accept an invoice")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -547,7 +652,7 @@ func (cc *TradeFinanceChaincode) rejectInvoice(stub shim.ChaincodeStubInterface,
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Buyer}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleBuyer}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to register an invoice")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -653,12 +758,19 @@ func (cc *TradeFinanceChaincode) placeBid(stub shim.ChaincodeStubInterface, args
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Factor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleFactor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
+	//checking the factor is registered and can trade
+	if err := CheckCreatorParticipant(stub); err != nil {
+		message := fmt.Sprintf("party is not allowed to trade: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//setting automatic values
 	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
@@ -696,6 +808,20 @@ func (cc *TradeFinanceChaincode) placeBid(stub shim.ChaincodeStubInterface, args
 		return shim.Error(message)
 	}
 
+	//checking the limits of the factor as if the bid won
+	if err := CheckBidLimits(stub, creator, bid.Value.InvoiceID); err != nil {
+		message := fmt.Sprintf("bid exceeds the limits of the factor: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	mspID, err := GetMSPID(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's MSPID: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -705,6 +831,7 @@ func (cc *TradeFinanceChaincode) placeBid(stub shim.ChaincodeStubInterface, args
 	}
 
 	bid.Value.FactorID = creator
+	bid.Value.FactorMSP = mspID
 	bid.Value.State = stateBidIssued
 	bid.Value.Timestamp = timestamp.Seconds
 	bid.Value.UpdatedDate = bid.Value.Timestamp
@@ -767,7 +894,7 @@ func (cc *TradeFinanceChaincode) updateBid(stub shim.ChaincodeStubInterface, arg
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Factor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleFactor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -811,6 +938,13 @@ func (cc *TradeFinanceChaincode) updateBid(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(message)
 	}
 
+	//checking the limits of the factor as if the bid won
+	if err := CheckBidLimits(stub, creator, bid.Value.InvoiceID); err != nil {
+		message := fmt.Sprintf("bid exceeds the limits of the factor: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	//getting transaction Timestamp
 	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
@@ -881,7 +1015,7 @@ func (cc *TradeFinanceChaincode) cancelBid(stub shim.ChaincodeStubInterface, arg
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Factor}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleFactor}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -1004,7 +1138,7 @@ func (cc *TradeFinanceChaincode) acceptBid(stub shim.ChaincodeStubInterface, arg
 	Notifier(stub, NoticeRuningType)
 
 	//checking role
-	if err, result := checkAccessForUnit([][]string{Supplier}, stub); err != nil || !result {
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
 		message := fmt.Sprintf("this organizational unit is not allowed to place a bid")
 		Logger.Error(message)
 		return shim.Error(message)
@@ -1065,8 +1199,16 @@ func (cc *TradeFinanceChaincode) acceptBid(stub shim.ChaincodeStubInterface, arg
 		return pb.Response{Status: 500, Message: message}
 	}
 
+	//checking the limits of the factor with the invoice it buys
+	if err := CheckFactorLimits(stub, bidToUpdate.Value.FactorID, invoice); err != nil {
+		message := fmt.Sprintf("bid exceeds the limits of the factor: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
 	invoice.Value.State = stateInvoiceSold
 	invoice.Value.Owner = bidToUpdate.Value.FactorID
+	invoice.Value.OwnerMSP = bidToUpdate.Value.FactorMSP
 	invoice.Value.Beneficiary = bidToUpdate.Value.FactorID
 	invoice.Value.UpdatedDate = timestamp.Seconds
 
@@ -1168,121 +1310,211 @@ func (cc *TradeFinanceChaincode) acceptBid(stub shim.ChaincodeStubInterface, arg
 	return shim.Success(nil)
 }
 
-//0		1	2	3
-//0		0	0	0
-func (cc *TradeFinanceChaincode) listBids(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+//0		1			2		3		4
+//ID	InvoiceID	Amount	Reason	Origin
+func (cc *TradeFinanceChaincode) issueCreditNote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Supplier
+	// check specified invoice existence
+	// check if caller is the seller of the invoice
+	// check invoice state and outstanding amount
+	// apply credit note at once or leave it for acknowledgement by the owner of a sold invoice
+	// save credit note and invoice
 	Notifier(stub, NoticeRuningType)
 
-	bids := []Bid{}
-	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, EmptyFilter)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
-		Logger.Error(message)
-		return shim.Error(message)
-	}
-	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+	//checking role
+	if err, result := checkAccessForRole([]string{roleSupplier}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to issue a credit note")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := joinByBidsAndInvoices(stub, bids)
-	if err != nil {
-		message := fmt.Sprintf("cannot join by bid and invoice: %s", err.Error())
+	//filling from arguments
+	creditNote := CreditNote{}
+	if err := creditNote.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a credit note from arguments: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
-}
-
-//0
-//InvoiceID
-func (cc *TradeFinanceChaincode) listBidsForInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+	if ExistsIn(stub, &creditNote, creditNoteIndex) {
+		compositeKey, _ := creditNote.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("credit note with the key %s already exists", compositeKey))
+	}
 
-	// checking invoice exist
+	//loading invoice from ledger
 	invoice := Invoice{}
-	if err := invoice.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+	invoice.Key.ID = creditNote.Value.InvoiceID
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
 		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//additional checking
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
 		return shim.Error(message)
 	}
+	Logger.Debug("OrganizationalUnit: " + creator)
 
-	if !ExistsIn(stub, &invoice, "") {
-		compositeKey, _ := invoice.ToCompositeKey(stub)
-		return shim.Error(fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey))
+	// after the sale the beneficiary and the owner are the factor, so the seller is kept apart;
+	// invoices registered before it was recorded are owned by the seller until they are sold
+	seller := invoice.Value.Seller
+	if seller == "" && (invoice.Value.State == stateInvoiceIssued || invoice.Value.State == stateInvoiceSigned) {
+		seller = invoice.Value.Owner
 	}
 
-	filterByInvoice := func(data LedgerData) bool {
-		bid, ok := data.(*Bid)
-		if ok && bid.Value.InvoiceID == invoice.Key.ID {
-			return true
-		}
+	if seller == "" || seller != creator {
+		message := fmt.Sprintf("only the seller of the invoice can issue a credit note")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
 
-		return false
+	allowedStates := map[int]bool{
+		stateInvoiceIssued:  true,
+		stateInvoiceSigned:  true,
+		stateInvoiceForSale: true,
+		stateInvoiceSold:    true,
 	}
 
-	bids := []Bid{}
-	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, filterByInvoice)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+	if !allowedStates[invoice.Value.State] {
+		message := fmt.Sprintf("cannot issue credit note for invoice with current state")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if creditNote.Value.Amount > invoice.Value.Outstanding {
+		message := fmt.Sprintf("credit note amount %f exceeds outstanding amount %f of invoice", creditNote.Value.Amount, invoice.Value.Outstanding)
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := joinByBidsAndInvoices(stub, bids)
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		message := fmt.Sprintf("cannot join by bid and invoice: %s", err.Error())
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	//setting automatic values
+	creditNote.Value.Issuer = creator
+	creditNote.Value.Timestamp = timestamp.Seconds
+	creditNote.Value.UpdatedDate = creditNote.Value.Timestamp
+
+	//credit notes for sold invoices wait for the acknowledgement of the owner
+	if invoice.Value.State == stateInvoiceSold {
+		creditNote.Value.State = stateCreditNoteIssued
+	} else {
+		creditNote.Value.State = stateCreditNoteApplied
+		creditNote.Value.AcknowledgedBy = invoice.Value.Owner
+
+		invoice.Value.Outstanding = invoice.Value.Outstanding - creditNote.Value.Amount
+		invoice.Value.UpdatedDate = timestamp.Seconds
+
+		if bytes, err := json.Marshal(invoice); err == nil {
+			Logger.Debug("Invoice: " + string(bytes))
+		}
+
+		if err := UpdateOrInsertIn(stub, &invoice, invoiceIndex, []string{""}, ""); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+	}
+
+	//updating state in ledger
+	if bytes, err := json.Marshal(creditNote); err == nil {
+		Logger.Debug("CreditNote: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &creditNote, creditNoteIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = creditNoteIndex
+	eventValue.EntityID = creditNote.Key.ID
+	eventValue.Other = creditNote.Value
+	eventValue.Action = eventIssueCreditNote
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
 	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
+	return shim.Success(nil)
 }
 
-//0		1	2	3	4	5	6
-//0    0	0	0	0	0	0
-func (cc *TradeFinanceChaincode) listInvoices(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+//0				1	2	3	4
+//CreditNoteID	0	0	0	0
+func (cc *TradeFinanceChaincode) acknowledgeCreditNote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check specified credit note existence
+	// check if caller is owner of the invoice
+	// check credit note state
+	// reduce outstanding amount of the invoice
+	// save credit note and invoice
 	Notifier(stub, NoticeRuningType)
 
-	invoices := []Invoice{}
-	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, EmptyFilter)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+	//checking role
+	if err, result := checkAccessForRole([]string{roleFactor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to acknowledge a credit note")
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	if len(args) < creditNoteKeyFieldsNumber {
+		message := fmt.Sprintf("arguments array must contain at least %d items", creditNoteKeyFieldsNumber)
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := json.Marshal(invoices)
+	//checking credit note exist
+	creditNote := CreditNote{}
+	if err := creditNote.FillFromCompositeKeyParts(args[:creditNoteKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
 
-	Logger.Debug("Result: " + string(resultBytes))
+	if !ExistsIn(stub, &creditNote, creditNoteIndex) {
+		compositeKey, _ := creditNote.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("credit note with the key %s doesn't exist", compositeKey))
+	}
 
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
-}
+	//loading current state from ledger
+	if err := LoadFrom(stub, &creditNote, creditNoteIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
-//0		1	2	3	4	5	6
-//0    0	0	0	0	0	0
-func (cc *TradeFinanceChaincode) listInvoicesByGuarantor(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	Notifier(stub, NoticeRuningType)
+	if creditNote.Value.State != stateCreditNoteIssued {
+		message := fmt.Sprintf("cannot acknowledge credit note with current state")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	invoice := Invoice{}
+	invoice.Key.ID = creditNote.Value.InvoiceID
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
 
+	//additional checking
 	creator, err := GetCreatorOrganizationalUnit(stub)
 	if err != nil {
 		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
@@ -1291,109 +1523,1275 @@ func (cc *TradeFinanceChaincode) listInvoicesByGuarantor(stub shim.ChaincodeStub
 	}
 	Logger.Debug("OrganizationalUnit: " + creator)
 
-	filterByGuarantor := func(data LedgerData) bool {
-		invoice, ok := data.(*Invoice)
-		if ok && invoice.Value.Guarantor == creator {
-			return true
-		}
-
-		return false
+	if invoice.Value.Owner != creator {
+		message := fmt.Sprintf("only invoice owner can acknowledge a credit note")
+		Logger.Error(message)
+		return shim.Error(message)
 	}
 
-	invoices := []Invoice{}
-	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, filterByGuarantor)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+	if creditNote.Value.Amount > invoice.Value.Outstanding {
+		message := fmt.Sprintf("credit note amount %f exceeds outstanding amount %f of invoice", creditNote.Value.Amount, invoice.Value.Outstanding)
 		Logger.Error(message)
 		return shim.Error(message)
 	}
-	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
 		Logger.Error(message)
 		return shim.Error(message)
 	}
 
-	resultBytes, err := json.Marshal(invoices)
-
-	Logger.Debug("Result: " + string(resultBytes))
-
-	Notifier(stub, NoticeSuccessType)
-	return shim.Success(resultBytes)
-}
+	//setting new values
+	creditNote.Value.State = stateCreditNoteApplied
+	creditNote.Value.AcknowledgedBy = creator
+	creditNote.Value.UpdatedDate = timestamp.Seconds
 
-func findBidsByFactorAndInvoice(stub shim.ChaincodeStubInterface, factorID string, invoiceID string) ([]Bid, error) {
+	invoice.Value.Outstanding = invoice.Value.Outstanding - creditNote.Value.Amount
+	invoice.Value.UpdatedDate = timestamp.Seconds
 
-	filterByFactorID := func(data LedgerData) bool {
-		entity, ok := data.(*Bid)
-		if ok && entity.Value.FactorID == factorID && entity.Value.InvoiceID == invoiceID {
-			return true
-		}
-		return false
+	//updating state in ledger
+	if bytes, err := json.Marshal(invoice); err == nil {
+		Logger.Debug("Invoice: " + string(bytes))
 	}
 
-	bids := []Bid{}
-	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, filterByFactorID)
-	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+	if err := UpdateOrInsertIn(stub, &invoice, invoiceIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return bids, errors.New(message)
+		return pb.Response{Status: 500, Message: message}
 	}
 
-	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
-		message := fmt.Sprintf("unable to unmarshal bids query result: %s", err.Error())
-		Logger.Error(message)
-		return bids, errors.New(message)
+	if bytes, err := json.Marshal(creditNote); err == nil {
+		Logger.Debug("CreditNote: " + string(bytes))
 	}
 
-	return bids, nil
-}
+	if err := UpdateOrInsertIn(stub, &creditNote, creditNoteIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = creditNoteIndex
+	eventValue.EntityID = creditNote.Key.ID
+	eventValue.Other = creditNote.Value
+	eventValue.Action = eventAckCreditNote
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0			1				2
+//InvoiceID	BillOfLadingID	SecuredParty
+func (cc *TradeFinanceChaincode) pledgeCollateral(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Supplier or Factor
+	// check specified invoice existence
+	// check if caller is invoice owner and holder of the bill of lading
+	// check the bill of lading is issued for the contract of the invoice
+	// pledge the bill of lading to the secured party in supply-chain
+	// save invoice with the collateral
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleSupplier, roleFactor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to pledge a collateral")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(args) < 3 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//checking invoice exist
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &invoice, invoiceIndex) {
+		compositeKey, _ := invoice.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey))
+	}
+
+	//loading current state from ledger
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//additional checking
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if invoice.Value.Owner != creator {
+		message := fmt.Sprintf("only invoice owner can pledge a collateral")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if invoice.Value.Collateral != "" {
+		message := fmt.Sprintf("invoice is already secured by bill of lading %s", invoice.Value.Collateral)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	allowedStates := map[int]bool{
+		stateInvoiceIssued:  true,
+		stateInvoiceSigned:  true,
+		stateInvoiceForSale: true,
+		stateInvoiceSold:    true,
+	}
+
+	if !allowedStates[invoice.Value.State] {
+		message := fmt.Sprintf("cannot pledge collateral for invoice with current state")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//checking bill of lading
+	billOfLading, err := loadBillOfLading(stub, args[1])
+	if err != nil {
+		message := fmt.Sprintf("cannot load bill of lading: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// invoices are registered under the ID of the supply-chain contract
+	if billOfLading.Value.ContractID != invoice.Key.ID {
+		message := fmt.Sprintf("bill of lading %s isn't issued for the contract of the invoice", billOfLading.Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if billOfLading.Value.State == stateBillOfLadingSurrendered {
+		message := fmt.Sprintf("bill of lading %s is surrendered", billOfLading.Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if billOfLading.Value.Holder != creator {
+		message := fmt.Sprintf("only the holder of bill of lading %s can pledge it", billOfLading.Key.ID)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the supply-chain chaincode keeps the pledge on the bill of lading
+	pledgeRequest := PledgeBillOfLadingRequest{BillOfLadingID: billOfLading.Key.ID, InvoiceID: invoice.Key.ID, SecuredParty: args[2]}
+
+	if err := InvokeBridge(stub, bridgePledgeBillOfLading, pledgeRequest, nil); err != nil {
+		message := fmt.Sprintf("Unable to invoke \"%s\": %s", bridgePledgeBillOfLading, err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//setting new values
+	invoice.Value.Collateral = billOfLading.Key.ID
+	invoice.Value.UpdatedDate = timestamp.Seconds
+
+	if bytes, err := json.Marshal(invoice); err == nil {
+		Logger.Debug("Invoice: " + string(bytes))
+	}
+
+	//updating state in ledger
+	if err := UpdateOrInsertIn(stub, &invoice, invoiceIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	eventValue := EventValue{}
+	eventValue.EntityType = invoiceIndex
+	eventValue.EntityID = invoice.Key.ID
+	eventValue.Other = invoice.Value
+	eventValue.Action = eventPledgeCollateral
+
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1	2	3
+//0		0	0	0
+func (cc *TradeFinanceChaincode) listBids(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	bids := []Bid{}
+	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByBidsAndInvoices(stub, bids)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by bid and invoice: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//InvoiceID
+func (cc *TradeFinanceChaincode) listBidsForInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	// checking invoice exist
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts([]string{args[0]}); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &invoice, "") {
+		compositeKey, _ := invoice.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey))
+	}
+
+	filterByInvoice := func(data LedgerData) bool {
+		bid, ok := data.(*Bid)
+		if ok && bid.Value.InvoiceID == invoice.Key.ID {
+			return true
+		}
+
+		return false
+	}
+
+	bids := []Bid{}
+	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, filterByInvoice)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := joinByBidsAndInvoices(stub, bids)
+	if err != nil {
+		message := fmt.Sprintf("cannot join by bid and invoice: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1	2	3	4	5	6
+//0    0	0	0	0	0	0
+func (cc *TradeFinanceChaincode) listInvoices(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	invoices := []Invoice{}
+	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(invoices)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1	2	3	4	5	6
+//0    0	0	0	0	0	0
+func (cc *TradeFinanceChaincode) listInvoicesByGuarantor(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	filterByGuarantor := func(data LedgerData) bool {
+		invoice, ok := data.(*Invoice)
+		if ok && invoice.Value.Guarantor == creator {
+			return true
+		}
+
+		return false
+	}
+
+	invoices := []Invoice{}
+	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, filterByGuarantor)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(invoices)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1
+//From	To
+func (cc *TradeFinanceChaincode) getBuyerPayables(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor, Bank, Factor
+	// sum up the invoices of every buyer in the time window
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBank, roleFactor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get buyer payables")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	window, err := ParseAnalyticsWindow(args)
+	if err != nil {
+		message := fmt.Sprintf("invalid time window: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	invoices := []Invoice{}
+	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(BuyerPayablesOf(window, timestamp.Seconds, invoices))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0		1
+//From	To
+func (cc *TradeFinanceChaincode) getFactorPortfolios(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// check role == Auditor, Bank
+	// sum up the invoices bought by every factor in the time window
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBank}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get factor portfolios")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	window, err := ParseAnalyticsWindow(args)
+	if err != nil {
+		message := fmt.Sprintf("invalid time window: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	bids := []Bid{}
+	invoices := []Invoice{}
+	for _, query := range []struct {
+		index   string
+		create  FactoryMethod
+		entries interface{}
+	}{
+		{bidIndex, CreateBid, &bids},
+		{invoiceIndex, CreateInvoice, &invoices},
+	} {
+		entriesBytes, err := Query(stub, query.index, []string{}, query.create, EmptyFilter)
+		if err != nil {
+			message := fmt.Sprintf("unable to perform method: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+		if err := json.Unmarshal(entriesBytes, query.entries); err != nil {
+			message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	resultBytes, err := json.Marshal(FactorPortfoliosOf(window, bids, invoices))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0			1				2				3
+//FactorID	MaxPurchased	MaxPerDebtor	MaxPerGuarantor
+//a zero limit leaves the amount uncapped
+func (cc *TradeFinanceChaincode) setFactorLimits(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to set factor limits")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	limit := FactorLimit{}
+	if err := limit.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill factor limits from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//keeping the time the limits were first set
+	existing := FactorLimit{Key: limit.Key}
+	limit.Value.Timestamp = timestamp.Seconds
+	if ExistsIn(stub, &existing, factorLimitIndex) {
+		if err := LoadFrom(stub, &existing, factorLimitIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+		limit.Value.Timestamp = existing.Value.Timestamp
+	}
+
+	limit.Value.SetBy = creator
+	limit.Value.UpdatedDate = timestamp.Seconds
+
+	if bytes, err := json.Marshal(limit); err == nil {
+		Logger.Debug("FactorLimit: " + string(bytes))
+	}
+
+	if err := UpdateOrInsertIn(stub, &limit, factorLimitIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = setFactorLimits
+	eventValue := EventValue{}
+	eventValue.EntityType = factorLimitIndex
+	eventValue.EntityID = limit.Key.FactorID
+	eventValue.Other = limit.Value
+	eventValue.Action = eventSetFactorLimits
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//FactorID
+//a factor gets its own portfolio
+func (cc *TradeFinanceChaincode) getFactorPortfolio(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBank, roleAdmin, roleFactor}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get a factor portfolio")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	factor := ""
+	if len(args) > 0 {
+		factor = args[0]
+	}
+
+	if err, result := checkAccessForRole([]string{roleAuditor, roleBank, roleAdmin}, stub); err != nil || !result {
+		creator, err := GetCreatorOrganizationalUnit(stub)
+		if err != nil {
+			message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if factor != "" && factor != creator {
+			message := fmt.Sprintf("each factor can get only its own portfolio")
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+		factor = creator
+	}
+
+	if factor == "" {
+		message := fmt.Sprintf("factor must be not empty")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	owned, err := findInvoicesOwnedBy(stub, factor)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	breakdown := PortfolioBreakdownOf(factor, owned, timestamp.Seconds)
+
+	limit := FactorLimit{Key: FactorLimitKey{FactorID: factor}}
+	if ExistsIn(stub, &limit, factorLimitIndex) {
+		if err := LoadFrom(stub, &limit, factorLimitIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+		breakdown.Limits = &limit.Value
+	}
+
+	resultBytes, err := json.Marshal(breakdown)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func (cc *TradeFinanceChaincode) listCreditNotes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	creditNotes, err := findCreditNotesVisibleTo(stub, creator, "")
+	if err != nil {
+		message := fmt.Sprintf("cannot find credit notes: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(creditNotes)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+//0
+//InvoiceID
+func (cc *TradeFinanceChaincode) listCreditNotesForInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	// checking invoice exist
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts(args[:invoiceKeyFieldsNumber]); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ExistsIn(stub, &invoice, invoiceIndex) {
+		compositeKey, _ := invoice.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey))
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	creditNotes, err := findCreditNotesVisibleTo(stub, creator, invoice.Key.ID)
+	if err != nil {
+		message := fmt.Sprintf("cannot find credit notes: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	resultBytes, err := json.Marshal(creditNotes)
+
+	Logger.Debug("Result: " + string(resultBytes))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(resultBytes)
+}
+
+func findBidsByFactorAndInvoice(stub shim.ChaincodeStubInterface, factorID string, invoiceID string) ([]Bid, error) {
+
+	filterByFactorID := func(data LedgerData) bool {
+		entity, ok := data.(*Bid)
+		if ok && entity.Value.FactorID == factorID && entity.Value.InvoiceID == invoiceID {
+			return true
+		}
+		return false
+	}
+
+	bids := []Bid{}
+	bidsBytes, err := Query(stub, bidIndex, []string{}, CreateBid, filterByFactorID)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return bids, errors.New(message)
+	}
+
+	if err := json.Unmarshal(bidsBytes, &bids); err != nil {
+		message := fmt.Sprintf("unable to unmarshal bids query result: %s", err.Error())
+		Logger.Error(message)
+		return bids, errors.New(message)
+	}
+
+	return bids, nil
+}
+
+// findCreditNotesVisibleTo returns credit notes seen by the issuer, the debtor and the current owner of the invoice.
+// An empty invoiceID means credit notes of all invoices.
+func findCreditNotesVisibleTo(stub shim.ChaincodeStubInterface, creator string, invoiceID string) ([]CreditNote, error) {
+	invoices := []Invoice{}
+	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, EmptyFilter)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return nil, errors.New(message)
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return nil, errors.New(message)
+	}
+
+	invoiceMap := make(map[InvoiceKey]InvoiceValue)
+	for _, invoice := range invoices {
+		invoiceMap[invoice.Key] = invoice.Value
+	}
+
+	filterByVisibility := func(data LedgerData) bool {
+		entity, ok := data.(*CreditNote)
+		if !ok || (invoiceID != "" && entity.Value.InvoiceID != invoiceID) {
+			return false
+		}
+
+		if entity.Value.Issuer == creator {
+			return true
+		}
+
+		if invoiceValue, ok := invoiceMap[InvoiceKey{ID: entity.Value.InvoiceID}]; ok {
+			return invoiceValue.Owner == creator || invoiceValue.Debtor == creator
+		}
+
+		return false
+	}
+
+	creditNotes := []CreditNote{}
+	creditNotesBytes, err := Query(stub, creditNoteIndex, []string{}, CreateCreditNote, filterByVisibility)
+	if err != nil {
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return creditNotes, errors.New(message)
+	}
+
+	if err := json.Unmarshal(creditNotesBytes, &creditNotes); err != nil {
+		message := fmt.Sprintf("unable to unmarshal credit notes query result: %s", err.Error())
+		Logger.Error(message)
+		return creditNotes, errors.New(message)
+	}
+
+	return creditNotes, nil
+}
 
 func joinByBidsAndInvoices(stub shim.ChaincodeStubInterface, bids []Bid) ([]byte, error) {
 	invoices := []Invoice{}
 	invoicesBytes, err := Query(stub, invoiceIndex, []string{}, CreateInvoice, EmptyFilter)
 	if err != nil {
-		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		message := fmt.Sprintf("unable to perform method: %s", err.Error())
+		Logger.Error(message)
+		return nil, errors.New(message)
+	}
+	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
+		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+		Logger.Error(message)
+		return nil, errors.New(message)
+	}
+
+	invoiceMap := make(map[InvoiceKey]InvoiceValue)
+	for _, invoice := range invoices {
+		invoiceMap[invoice.Key] = invoice.Value
+	}
+
+	result := []BidAdditional{}
+	for _, bid := range bids {
+		entry := BidAdditional{
+			Key: bid.Key,
+			Value: BidValueAdditional{
+				Rate:        bid.Value.Rate,
+				FactorID:    bid.Value.FactorID,
+				InvoiceID:   bid.Value.InvoiceID,
+				State:       bid.Value.State,
+				Timestamp:   bid.Value.Timestamp,
+				UpdatedDate: bid.Value.UpdatedDate,
+			},
+		}
+
+		if invoiceValue, ok := invoiceMap[InvoiceKey{ID: entry.Value.InvoiceID}]; ok {
+			entry.Value.Amount = invoiceValue.TotalDue
+			entry.Value.Debtor = invoiceValue.Debtor
+			entry.Value.Beneficiary = invoiceValue.Beneficiary
+			entry.Value.PaymentDate = invoiceValue.PaymentDate
+			entry.Value.Guarantor = invoiceValue.Guarantor
+		}
+
+		result = append(result, entry)
+	}
+
+	resultBytes, err := json.Marshal(result)
+	return resultBytes, nil
+}
+
+func (cc *TradeFinanceChaincode) getConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get the config")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	config := Config{}
+	if err := LoadFrom(stub, &config, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(config.Value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+func (cc *TradeFinanceChaincode) getConfigHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to get the config history")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	history, err := ConfigHistory(stub)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(history)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0			1
+//Config	Version
+func (cc *TradeFinanceChaincode) updateConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to update the config")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("insufficient number of arguments")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	current := Config{}
+	if err := LoadFrom(stub, &current, configIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	// the version the update is based on guards against concurrent changes
+	version, err := strconv.Atoi(args[1])
+	if err != nil {
+		message := fmt.Sprintf("version is invalid: %s (must be int)", args[1])
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if version != current.Value.Version {
+		message := fmt.Sprintf("config is at version %d, cannot update version %d", current.Value.Version, version)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	config := Config{}
+	if err := json.Unmarshal([]byte(args[0]), &config.Value); err != nil {
+		message := fmt.Sprintf("input json is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := config.Validate(); err != nil {
+		message := fmt.Sprintf("config is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := config.CheckCollectionsDefined(stub); err != nil {
+		message := fmt.Sprintf("config is invalid: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	if err := config.Save(stub, current.Value.Version+1, creator); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = updateConfig
+	eventValue := EventValue{}
+	eventValue.EntityType = configIndex
+	eventValue.EntityID = strconv.Itoa(config.Value.Version)
+	eventValue.Other = config.Value
+	eventValue.Action = eventUpdateConfig
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1		2
+//Role	Kind	Value
+func (cc *TradeFinanceChaincode) grantRole(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to grant a role")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	member := RoleMember{}
+	if err := member.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a role member from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if member.Exists(stub) {
+		message := fmt.Sprintf("role %s is already granted to %s %s", member.Key.Role, member.Key.Kind, member.Key.Value)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
+
+	member.Value.GrantedBy = creator
+
+	if err := member.Save(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = grantRole
+	eventValue := EventValue{}
+	eventValue.EntityType = roleMemberIndex
+	eventValue.EntityID = member.Key.Role
+	eventValue.Other = member
+	eventValue.Action = eventGrantRole
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0		1		2
+//Role	Kind	Value
+func (cc *TradeFinanceChaincode) revokeRole(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to revoke a role")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	member := RoleMember{}
+	if err := member.FillFromCompositeKeyParts(args); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !member.Exists(stub) {
+		message := fmt.Sprintf("role %s isn't granted to %s %s", member.Key.Role, member.Key.Kind, member.Key.Value)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the registry can't be left without an admin
+	if member.Key.Role == roleAdmin {
+		admins, err := FindRoleMembers(stub, roleAdmin)
+		if err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
+		}
+
+		if len(admins) < 2 {
+			message := fmt.Sprintf("cannot revoke the last member of role %s", roleAdmin)
+			Logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	if err := member.Delete(stub); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = revokeRole
+	eventValue := EventValue{}
+	eventValue.EntityType = roleMemberIndex
+	eventValue.EntityID = member.Key.Role
+	eventValue.Other = member
+	eventValue.Action = eventRevokeRole
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+//0
+//Role
+func (cc *TradeFinanceChaincode) listRoleMembers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to list role members")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	role := ""
+	if len(args) > 0 {
+		role = args[0]
+	}
+
+	members, err := FindRoleMembers(stub, role)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
 		Logger.Error(message)
-		return nil, errors.New(message)
+		return pb.Response{Status: 500, Message: message}
 	}
-	if err := json.Unmarshal(invoicesBytes, &invoices); err != nil {
-		message := fmt.Sprintf("unable to unmarshal query result: %s", err.Error())
+
+	result, err := json.Marshal(members)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+func (cc *TradeFinanceChaincode) registerParticipant(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBank, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to register a participant")
 		Logger.Error(message)
-		return nil, errors.New(message)
+		return shim.Error(message)
 	}
 
-	invoiceMap := make(map[InvoiceKey]InvoiceValue)
-	for _, invoice := range invoices {
-		invoiceMap[invoice.Key] = invoice.Value
+	participant := Participant{}
+	if err := participant.FillFromArguments(stub, args); err != nil {
+		message := fmt.Sprintf("cannot fill a participant from arguments: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
 	}
 
-	result := []BidAdditional{}
-	for _, bid := range bids {
-		entry := BidAdditional{
-			Key: bid.Key,
-			Value: BidValueAdditional{
-				Rate:        bid.Value.Rate,
-				FactorID:    bid.Value.FactorID,
-				InvoiceID:   bid.Value.InvoiceID,
-				State:       bid.Value.State,
-				Timestamp:   bid.Value.Timestamp,
-				UpdatedDate: bid.Value.UpdatedDate,
-			},
-		}
+	creator, err := GetCreatorOrganizationalUnit(stub)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+	Logger.Debug("OrganizationalUnit: " + creator)
 
-		if invoiceValue, ok := invoiceMap[InvoiceKey{ID: entry.Value.InvoiceID}]; ok {
-			entry.Value.Amount = invoiceValue.TotalDue
-			entry.Value.Debtor = invoiceValue.Debtor
-			entry.Value.Beneficiary = invoiceValue.Beneficiary
-			entry.Value.PaymentDate = invoiceValue.PaymentDate
-			entry.Value.Guarantor = invoiceValue.Guarantor
+	//getting transaction Timestamp
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		message := fmt.Sprintf("unable to get transaction timestamp: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	//keeping the time the participant was first registered
+	existing := Participant{Key: participant.Key}
+	participant.Value.Timestamp = timestamp.Seconds
+	if ExistsIn(stub, &existing, participantIndex) {
+		if err := LoadFrom(stub, &existing, participantIndex); err != nil {
+			message := fmt.Sprintf("persistence error: %s", err.Error())
+			Logger.Error(message)
+			return pb.Response{Status: 500, Message: message}
 		}
+		participant.Value.Timestamp = existing.Value.Timestamp
+	}
 
-		result = append(result, entry)
+	participant.Value.RegisteredBy = creator
+	participant.Value.UpdatedDate = timestamp.Seconds
+
+	if bytes, err := json.Marshal(participant); err == nil {
+		Logger.Debug("Participant: " + string(bytes))
 	}
 
-	resultBytes, err := json.Marshal(result)
-	return resultBytes, nil
+	if err := UpdateOrInsertIn(stub, &participant, participantIndex, []string{""}, ""); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	//emitting Event
+	events := Events{}
+
+	//event = registerParticipant
+	eventValue := EventValue{}
+	eventValue.EntityType = participantIndex
+	eventValue.EntityID = participant.Key.OrganizationalUnit + "/" + participant.Key.MSPID
+	eventValue.Other = participant.Value
+	eventValue.Action = eventRegisterParticipant
+	events.Values = append(events.Values, eventValue)
+
+	if err := events.EmitEvent(stub); err != nil {
+		message := fmt.Sprintf("Cannot emite event: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(nil)
+}
+
+func (cc *TradeFinanceChaincode) listParticipants(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	//checking role
+	if err, result := checkAccessForRole([]string{roleBank, roleAuditor, roleAdmin}, stub); err != nil || !result {
+		message := fmt.Sprintf("this organizational unit is not allowed to list participants")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	organizationalUnit := ""
+	if len(args) > 0 {
+		organizationalUnit = args[0]
+	}
+
+	participants, err := FindParticipants(stub, organizationalUnit)
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(participants)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
 }
 
 func (cc *TradeFinanceChaincode) getEventPayload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -1427,24 +2825,178 @@ func (cc *TradeFinanceChaincode) getEventPayload(stub shim.ChaincodeStubInterfac
 	return shim.Success(result)
 }
 
-func checkAccessForUnit(allowedUnits [][]string, stub shim.ChaincodeStubInterface) (error, bool) {
+//0				1			2		3		4		5	6			7
+//EntityType	EntityID	Action	Creator	From	To	PageSize	Bookmark
+func (cc *TradeFinanceChaincode) listEvents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
 
-	orgUnit, err := GetCreatorOrganizationalUnit(stub)
+	filter, pageSize, bookmark, err := ParseEventFilter(args)
 	if err != nil {
-		message := fmt.Sprintf("cannot obtain creator's OrganizationalUnit from the certificate: %s", err.Error())
+		message := fmt.Sprintf("invalid event filter: %s", err.Error())
 		Logger.Error(message)
-		return errors.New(message), false
+		return shim.Error(message)
+	}
+
+	page, err := ListEvents(stub, filter, pageSize, bookmark)
+	if err != nil {
+		message := fmt.Sprintf("unable to list events: %s", err.Error())
+		Logger.Error(message)
+		return shim.Error(message)
 	}
-	Logger.Debug("OrganizationalUnit: " + orgUnit)
 
-	result := false
+	result, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	for _, value := range allowedUnits {
-		for _, role := range value {
-			if role == orgUnit {
-				result = true
-			}
-		}
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//0
+//ID
+func (cc *TradeFinanceChaincode) getInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < invoiceKeyFieldsNumber {
+		message := fmt.Sprintf("arguments array must contain at least %d items", invoiceKeyFieldsNumber)
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	invoice := Invoice{}
+	if err := invoice.FillFromCompositeKeyParts(args[:invoiceKeyFieldsNumber]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, &invoice, invoiceIndex) {
+		compositeKey, _ := invoice.ToCompositeKey(stub)
+		message := fmt.Sprintf("invoice with the key %s doesn't exist", compositeKey)
+		Logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//argument order
+//0				1
+//EntityType	ID
+func (cc *TradeFinanceChaincode) getEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("arguments array must contain at least 2 items")
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	policy, ok := endorsementPolicies[args[0]]
+	if !ok {
+		message := fmt.Sprintf("entity type %s has no endorsement policy", args[0])
+		Logger.Error(message)
+		return shim.Error(message)
+	}
+
+	entity := policy.Create()
+	if err := entity.FillFromCompositeKeyParts(args[1:2]); err != nil {
+		message := err.Error()
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if !ExistsIn(stub, entity, args[0]) {
+		compositeKey, _ := entity.ToCompositeKey(stub)
+		return shim.Error(fmt.Sprintf("entity with the key %s doesn't exist", compositeKey))
+	}
+
+	organizations, err := GetEndorsementOrganizations(stub, entity, args[0])
+	if err != nil {
+		message := fmt.Sprintf("persistence error: %s", err.Error())
+		Logger.Error(message)
+		return pb.Response{Status: 500, Message: message}
+	}
+
+	result, err := json.Marshal(struct {
+		EntityType    string              `json:"entityType"`
+		EntityID      string              `json:"entityID"`
+		RoleType      statebased.RoleType `json:"roleType"`
+		Organizations []string            `json:"organizations"`
+	}{
+		EntityType:    args[0],
+		EntityID:      args[1],
+		RoleType:      policy.RoleType,
+		Organizations: organizations,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	Logger.Debug("Result: " + string(result))
+
+	Notifier(stub, NoticeSuccessType)
+	return shim.Success(result)
+}
+
+//argument order
+//0
+//BridgeRequest
+func (cc *TradeFinanceChaincode) bridge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	Notifier(stub, NoticeRuningType)
+
+	request, bridgeError := ParseBridgeRequest(args)
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+
+	functionArgs, bridgeError := request.Arguments()
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+
+	// the policy of the function applies to the calls of the other chaincode as well
+	if err, result := checkAccessForPolicy(stub, request.Function, functionArgs); err != nil || !result {
+		return BridgeFailure(403, &BridgeError{Code: bridgeErrorDenied, Message: fmt.Sprintf("access to %s is denied by its policy", request.Function)})
+	}
+
+	var response pb.Response
+	switch request.Function {
+	case bridgeRegisterInvoice:
+		response = cc.registerInvoice(stub, functionArgs)
+	case bridgeAcceptInvoice:
+		response = cc.acceptInvoice(stub, functionArgs)
+	case bridgeGetInvoice:
+		response = cc.getInvoice(stub, functionArgs)
+	default:
+		return BridgeFailure(404, &BridgeError{Code: bridgeErrorFunction, Message: fmt.Sprintf("function %s isn't served by %s", request.Function, chaincodeName)})
+	}
+
+	Notifier(stub, NoticeSuccessType)
+	return BridgeReply(response)
+}
+
+func checkAccessForRole(allowedRoles []string, stub shim.ChaincodeStubInterface) (error, bool) {
+	result, err := HasRole(stub, allowedRoles...)
+	if err != nil {
+		message := fmt.Sprintf("cannot obtain creator's roles: %s", err.Error())
+		Logger.Error(message)
+		return errors.New(message), false
 	}
 
 	return nil, result
@@ -1,11 +1,112 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"math/big"
+	"strconv"
 	"testing"
+	"time"
 )
 
+const testLEI = "5493001KJTIIGC8Y1R12"
+
+// creatorStub adds the creator certificate missing in shim.MockStub
+type creatorStub struct {
+	*shim.MockStub
+	creator []byte
+}
+
+func (stub *creatorStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func newCreatorStub(t *testing.T, stub *shim.MockStub, mspID string, organizationalUnit string) *creatorStub {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := pkix.Name{CommonName: organizationalUnit, Organization: []string{mspID}, OrganizationalUnit: []string{organizationalUnit}}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      name,
+		Issuer:       name,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &creatorStub{stub, creator}
+}
+
+var testTx = 0
+
+// invoke runs the function as the creator in a transaction of its own
+func invoke(stub *creatorStub, function func(shim.ChaincodeStubInterface, []string) pb.Response, args ...string) pb.Response {
+	testTx++
+	stub.MockTransactionStart(fmt.Sprintf("tx%d", testTx))
+	defer stub.MockTransactionEnd(fmt.Sprintf("tx%d", testTx))
+
+	return function(stub, args)
+}
+
+// newTradeStub initializes the chaincode with no collections and registers the admin
+// as a verified participant of every MSP the parties are given
+func newTradeStub(t *testing.T, parties map[string]string) (*TradeFinanceChaincode, *shim.MockStub) {
+	cc := new(TradeFinanceChaincode)
+	stub := shim.NewMockStub("TradeFinanceChaincode", cc)
+	if response := stub.MockInit("1", [][]byte{[]byte("init"), []byte("[]"), []byte("trade-finance-chaincode")}); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	admin := newCreatorStub(t, stub, "ORG4MSP", "Admin")
+	kycExpiry := strconv.FormatInt(time.Now().AddDate(1, 0, 0).Unix(), 10)
+	for organizationalUnit, mspID := range parties {
+		if response := invoke(admin, cc.registerParticipant, organizationalUnit, mspID, organizationalUnit+" Ltd", testLEI, "GB",
+			participantActive, kycVerified, kycExpiry, ""); response.Status != shim.OK {
+			t.Fatal(response.Message)
+		}
+	}
+
+	return cc, stub
+}
+
+// loadInvoice reads the invoice the way the chaincode does for the creator
+func loadInvoice(t *testing.T, stub *creatorStub, id string) Invoice {
+	invoice := Invoice{Key: InvoiceKey{ID: id}}
+
+	stub.MockTransactionStart("load")
+	defer stub.MockTransactionEnd("load")
+	if err := LoadFrom(stub, &invoice, invoiceIndex); err != nil {
+		t.Fatal(err)
+	}
+
+	return invoice
+}
+
 func getInitializedStub() *shim.MockStub {
 	cc := new(TradeFinanceChaincode)
 	stub := shim.NewMockStub("TradeFinanceChaincode", cc)
@@ -58,3 +159,266 @@ func TestRegisterInvoice(t *testing.T) {
 
 	fmt.Printf("###### Test: %s is ending. #####", fcnName)
 }
+
+func TestPortfolioBreakdown(t *testing.T) {
+	const now = int64(1700000000)
+
+	invoice := func(id string, debtor string, guarantor string, outstanding float32, days int64) Invoice {
+		entry := Invoice{Key: InvoiceKey{ID: id}}
+		entry.Value.Debtor = debtor
+		entry.Value.Guarantor = guarantor
+		entry.Value.Outstanding = outstanding
+		entry.Value.PaymentDate = now + days*secondsPerDay
+		return entry
+	}
+
+	owned := []Invoice{
+		invoice("a", "Buyer-1", "Bank", 600, -1),
+		invoice("b", "Buyer-2", "Bank", 300, 45),
+		invoice("c", "Buyer-1", "", 100, 120),
+	}
+
+	breakdown := PortfolioBreakdownOf("Factor-1", owned, now)
+
+	if breakdown.Invoices != 3 || breakdown.Outstanding != 1000 {
+		t.Errorf("expected 3 invoices outstanding 1000, got %d outstanding %.2f", breakdown.Invoices, breakdown.Outstanding)
+	}
+
+	if actual := fmt.Sprint(breakdown.ByDebtor); actual != "[{Buyer-1 2 700 0.7} {Buyer-2 1 300 0.3}]" {
+		t.Errorf("unexpected breakdown by debtor %s", actual)
+	}
+
+	if actual := fmt.Sprint(breakdown.ByGuarantor); actual != "[{Bank 2 900 0.9} { 1 100 0.1}]" {
+		t.Errorf("unexpected breakdown by guarantor %s", actual)
+	}
+
+	if actual := fmt.Sprint(breakdown.ByMaturity); actual != "[{overdue 1 600 0.6} {0-30 0 0 0} {31-60 1 300 0.3} {61-90 0 0 0} {over 90 1 100 0.1}]" {
+		t.Errorf("unexpected breakdown by maturity %s", actual)
+	}
+}
+
+func TestCreditNotes(t *testing.T) {
+	cc, stub := newTradeStub(t, map[string]string{"Supplier": "ORG2MSP", "Supplier-2": "ORG5MSP", "Buyer": "ORG1MSP", "Factor-1": "ORG3MSP"})
+	admin := newCreatorStub(t, stub, "ORG4MSP", "Admin")
+	supplier := newCreatorStub(t, stub, "ORG2MSP", "Supplier")
+	otherSupplier := newCreatorStub(t, stub, "ORG5MSP", "Supplier-2")
+	buyer := newCreatorStub(t, stub, "ORG1MSP", "Buyer")
+	factor := newCreatorStub(t, stub, "ORG3MSP", "Factor-1")
+
+	const (
+		invoiceID = "6a1f3c2e-8b4d-4e7a-9c1f-2d3e4f5a6b70"
+		bidID     = "7b2a4d3f-9c5e-4f8b-8d2a-3e4f5a6b7c81"
+	)
+	paymentDate := strconv.FormatInt(time.Now().AddDate(0, 2, 0).Unix(), 10)
+
+	if response := invoke(admin, cc.grantRole, roleSupplier, memberKindOrganizationalUnit, "Supplier-2"); response.Status != shim.OK {
+		t.Fatalf("grantRole failed: %s", response.Message)
+	}
+
+	if response := invoke(supplier, cc.registerInvoice, invoiceID, "Buyer", "Supplier", "1000", paymentDate, ""); response.Status != shim.OK {
+		t.Fatalf("registerInvoice failed: %s", response.Message)
+	}
+
+	if response := invoke(otherSupplier, cc.issueCreditNote, "8c3b5e4a-0d6f-4a9c-9e3b-4f5a6b7c8d92", invoiceID, "100", "damaged", "1"); response.Status == shim.OK {
+		t.Fatal("issueCreditNote succeeded for another supplier")
+	}
+
+	// a credit note for an unsold invoice is applied at once
+	if response := invoke(supplier, cc.issueCreditNote, "8c3b5e4a-0d6f-4a9c-9e3b-4f5a6b7c8d92", invoiceID, "100", "damaged", "1"); response.Status != shim.OK {
+		t.Fatalf("issueCreditNote failed: %s", response.Message)
+	}
+
+	if response := invoke(supplier, cc.issueCreditNote, "9d4c6f5b-1e7a-4b0d-8f4c-5a6b7c8d9ea3", invoiceID, "950", "returned", "3"); response.Status == shim.OK {
+		t.Fatal("issueCreditNote exceeded the outstanding amount")
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Outstanding != 900 || invoice.Value.Seller != "Supplier" {
+		t.Errorf("expected outstanding 900 sold by Supplier, got %.2f sold by %s", invoice.Value.Outstanding, invoice.Value.Seller)
+	}
+
+	// after the sale the factor is the beneficiary, the seller still issues the credit notes
+	for _, step := range []struct {
+		stub     *creatorStub
+		function func(shim.ChaincodeStubInterface, []string) pb.Response
+		args     []string
+	}{
+		{buyer, cc.acceptInvoice, []string{invoiceID}},
+		{supplier, cc.placeInvoice, []string{invoiceID}},
+		{factor, cc.placeBid, []string{bidID, "0.05", "Factor-1", invoiceID}},
+		{supplier, cc.acceptBid, []string{bidID}},
+	} {
+		if response := invoke(step.stub, step.function, step.args...); response.Status != shim.OK {
+			t.Fatalf("selling the invoice failed: %s", response.Message)
+		}
+	}
+
+	if response := invoke(otherSupplier, cc.issueCreditNote, "0e5d7a6c-2f8b-4c1e-9a5d-6b7c8d9eafb4", invoiceID, "200", "returned", "3"); response.Status == shim.OK {
+		t.Fatal("issueCreditNote succeeded for another supplier of a sold invoice")
+	}
+
+	if response := invoke(supplier, cc.issueCreditNote, "0e5d7a6c-2f8b-4c1e-9a5d-6b7c8d9eafb4", invoiceID, "200", "returned", "3"); response.Status != shim.OK {
+		t.Fatalf("issueCreditNote failed for the sold invoice: %s", response.Message)
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Outstanding != 900 {
+		t.Errorf("credit note was applied before the owner acknowledged it, outstanding %.2f", invoice.Value.Outstanding)
+	}
+
+	if response := invoke(factor, cc.acknowledgeCreditNote); response.Status == shim.OK {
+		t.Fatal("acknowledgeCreditNote succeeded with no arguments")
+	}
+
+	if response := invoke(factor, cc.acknowledgeCreditNote, "0e5d7a6c-2f8b-4c1e-9a5d-6b7c8d9eafb4"); response.Status != shim.OK {
+		t.Fatalf("acknowledgeCreditNote failed: %s", response.Message)
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Outstanding != 700 {
+		t.Errorf("expected outstanding 700 after the acknowledgement, got %.2f", invoice.Value.Outstanding)
+	}
+}
+
+func TestCreditNoteForInvoiceWithoutOutstanding(t *testing.T) {
+	cc, stub := newTradeStub(t, map[string]string{"Supplier": "ORG2MSP"})
+	supplier := newCreatorStub(t, stub, "ORG2MSP", "Supplier")
+
+	// an invoice registered before credit notes and sellers were recorded
+	const invoiceID = "1f6e8b7d-3a9c-4d2f-8b6e-7c8d9eafb0c5"
+	stub.MockTransactionStart("legacy")
+	key, _ := stub.CreateCompositeKey(invoiceIndex, []string{invoiceID})
+	if err := stub.PutState(key, []byte(`{"debtor":"Buyer","beneficiary":"Supplier","totalDue":1000,"state":1,"owner":"Supplier","ownerMSP":"ORG2MSP"}`)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("legacy")
+
+	if response := invoke(supplier, cc.issueCreditNote, "2a7f9c8e-4b0d-4e3a-9c7f-8d9eafb0c1d6", invoiceID, "300", "adjustment", "1"); response.Status != shim.OK {
+		t.Fatalf("issueCreditNote failed: %s", response.Message)
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Outstanding != 700 {
+		t.Errorf("expected outstanding 700 of the total due, got %.2f", invoice.Value.Outstanding)
+	}
+}
+
+func TestFactorLimitsCountInvoicesWithoutOutstanding(t *testing.T) {
+	cc, stub := newTradeStub(t, nil)
+	admin := newCreatorStub(t, stub, "ORG4MSP", "Admin")
+	factor := newCreatorStub(t, stub, "ORG3MSP", "Factor-1")
+
+	if response := invoke(admin, cc.setFactorLimits, "Factor-1", "1500", "0", "0"); response.Status != shim.OK {
+		t.Fatalf("setFactorLimits failed: %s", response.Message)
+	}
+
+	// a sold invoice registered before credit notes
+	stub.MockTransactionStart("legacy")
+	key, _ := stub.CreateCompositeKey(invoiceIndex, []string{"3b8a0d9f-5c1e-4f4b-8d8a-9eafb0c1d2e7"})
+	if err := stub.PutState(key, []byte(`{"debtor":"Buyer","beneficiary":"Factor-1","totalDue":1000,"state":4,"owner":"Factor-1","ownerMSP":"ORG3MSP"}`)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("legacy")
+
+	invoice := Invoice{Key: InvoiceKey{ID: "4c9b1e0a-6d2f-4a5c-9e9b-afb0c1d2e3f8"}}
+	invoice.Value.Debtor = "Buyer"
+	invoice.Value.Outstanding = 600
+
+	stub.MockTransactionStart("check")
+	defer stub.MockTransactionEnd("check")
+	if err := CheckFactorLimits(factor, "Factor-1", invoice); err == nil {
+		t.Error("invoice without outstanding amount isn't counted against the limit")
+	}
+
+	owned, err := findInvoicesOwnedBy(factor, "Factor-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if breakdown := PortfolioBreakdownOf("Factor-1", owned, 0); breakdown.Outstanding != 1000 {
+		t.Errorf("expected the total due 1000 in the portfolio, got %.2f", breakdown.Outstanding)
+	}
+}
+
+// billOfLadingChaincode stands in for the supply-chain chaincode invoked through the bridge,
+// it serves the bills of lading, records the requests and answers them with reject if set
+type billOfLadingChaincode struct {
+	requests      []BridgeRequest
+	reject        *BridgeError
+	billsOfLading map[string]BillOfLading
+}
+
+func (cc *billOfLadingChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *billOfLadingChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+
+	request, bridgeError := ParseBridgeRequest(args)
+	if bridgeError != nil {
+		return BridgeFailure(400, bridgeError)
+	}
+
+	if request.Function == bridgeGetBillOfLading {
+		args, _ := request.Arguments()
+		billOfLadingBytes, _ := json.Marshal(cc.billsOfLading[args[0]])
+		return BridgeReply(shim.Success(billOfLadingBytes))
+	}
+
+	cc.requests = append(cc.requests, request)
+	if cc.reject != nil {
+		return BridgeFailure(400, cc.reject)
+	}
+
+	return BridgeReply(shim.Success(nil))
+}
+
+func TestPledgeCollateral(t *testing.T) {
+	cc, stub := newTradeStub(t, map[string]string{"Supplier": "ORG2MSP", "Buyer": "ORG1MSP", "Bank": "ORG5MSP"})
+	supplier := newCreatorStub(t, stub, "ORG2MSP", "Supplier")
+
+	const (
+		invoiceID      = "3e5a7c9b-1d2f-4a6e-8b0c-4d6e8f0a2c15"
+		billOfLadingID = "4f6b8d0c-2e3a-4b7f-9c1d-5e7f9a1b3d26"
+	)
+	paymentDate := strconv.FormatInt(time.Now().AddDate(0, 2, 0).Unix(), 10)
+
+	billsOfLading := &billOfLadingChaincode{billsOfLading: map[string]BillOfLading{
+		billOfLadingID: {Key: BillOfLadingKey{ID: billOfLadingID}, Value: BillOfLadingValue{ContractID: invoiceID, Holder: "Supplier", State: stateBillOfLadingIssued}},
+	}}
+	stub.MockPeerChaincode("supply-chain-chaincode/common", shim.NewMockStub("supply-chain-chaincode", billsOfLading))
+
+	if response := invoke(supplier, cc.registerInvoice, invoiceID, "Buyer", "Supplier", "1000", paymentDate, ""); response.Status != shim.OK {
+		t.Fatalf("registerInvoice failed: %s", response.Message)
+	}
+
+	if response := invoke(supplier, cc.pledgeCollateral, invoiceID, billOfLadingID); response.Status == shim.OK {
+		t.Fatal("pledgeCollateral succeeded without the secured party")
+	}
+
+	// the invoice isn't secured unless supply-chain keeps the pledge
+	billsOfLading.reject = &BridgeError{Code: bridgeErrorRejected, Message: "bill of lading cannot be pledged to Buyer"}
+	if response := invoke(supplier, cc.pledgeCollateral, invoiceID, billOfLadingID, "Buyer"); response.Status == shim.OK {
+		t.Fatal("pledgeCollateral succeeded though supply-chain refused the pledge")
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Collateral != "" {
+		t.Fatalf("invoice is secured by %s after a refused pledge", invoice.Value.Collateral)
+	}
+
+	billsOfLading.reject = nil
+	if response := invoke(supplier, cc.pledgeCollateral, invoiceID, billOfLadingID, "Bank"); response.Status != shim.OK {
+		t.Fatalf("pledgeCollateral failed: %s", response.Message)
+	}
+
+	if invoice := loadInvoice(t, supplier, invoiceID); invoice.Value.Collateral != billOfLadingID {
+		t.Errorf("expected invoice secured by %s, got %q", billOfLadingID, invoice.Value.Collateral)
+	}
+
+	last := billsOfLading.requests[len(billsOfLading.requests)-1]
+	pledge := PledgeBillOfLadingRequest{}
+	if err := json.Unmarshal(last.Payload, &pledge); err != nil {
+		t.Fatal(err)
+	}
+
+	if last.Function != bridgePledgeBillOfLading || pledge != (PledgeBillOfLadingRequest{BillOfLadingID: billOfLadingID, InvoiceID: invoiceID, SecuredParty: "Bank"}) {
+		t.Errorf("unexpected pledge request %s %+v", last.Function, pledge)
+	}
+}
@@ -1,7 +1,6 @@
 const express = require('express');
 const path = require('path');
 const WebSocket = require('ws');
-const axios = require('axios');
 const socketIO = require('socket.io');
 const mime = require('mime-types');
 const ipfsClient = require('ipfs-http-client');
@@ -43,16 +42,8 @@ console.info('ORG', ORG);
 
 const port = process.env.PORT || 3000;
 
-const retry = async (url, n) => {
-  try {
-    return await axios.get(url);
-  } catch (err) {
-    if (n === 0) {
-      throw err;
-    }
-    return retry(url, n - 1);
-  }
-};
+// version of the chaincode event payload the listener reads
+const EVENT_PAYLOAD_VERSION = 1;
 
 const emitEvent = (client, data, type) => {
   client.emit('notification', JSON.stringify({ data, type }));
@@ -96,13 +87,17 @@ const listenSocket = () => {
     const event = JSON.parse(message);
     if (event && event.payload) {
       try {
-        const events = JSON.parse(event.payload.EventName);
-
-        events.forEach(async (item) => {
-          const payload = item.id.split('.');
-          const chaincode = payload[1];
-          const eventName = payload[2];
-          const eventId = payload[3];
+        // the event is named <chaincode>.<action> and carries the events of the transaction
+        const ccEvent = JSON.parse(Buffer.from(event.payload.Payload, 'base64').toString());
+        if (ccEvent.version !== EVENT_PAYLOAD_VERSION) {
+          console.info(`unsupported event payload version ${ccEvent.version}`);
+          return;
+        }
+
+        ccEvent.events.forEach((item) => {
+          const chaincode = ccEvent.chaincode;
+          const eventName = item.value.action;
+          const eventId = item.key.id;
 
           console.info('eventId:', eventId);
           console.info('chaincode:', chaincode);
@@ -112,12 +107,7 @@ const listenSocket = () => {
             const { actors } = METHODS_MAP.find(i => i.ccMethod === eventName);
 
             if (actors && actors.includes(ROLE)) {
-              const res = await retry(
-                `http://${API_ENDPOINT}/api/channels/common/chaincodes/${chaincode}?peer=${ORG}/peer0&fcn=getEventPayload&args=${eventId}`,
-                3
-              );
-
-              console.log(`getEventPayload ${eventName}`, res.data.result);
+              console.log(`event ${eventName}`, item);
 
               setTimeout(
                 () => {
@@ -125,11 +115,11 @@ const listenSocket = () => {
                     c,
                     {
                       key: {
-                        id: res.data.result.value.entityID
+                        id: item.value.entityID
                       },
-                      value: Object.assign({}, res.data.result.value.other, {
-                        eventId: res.data.result.key.id,
-                        creator: res.data.result.value.creator
+                      value: Object.assign({}, item.value.other, {
+                        eventId,
+                        creator: item.value.creator
                       })
                     },
                     eventName
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+	"github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Index of the events both chaincodes keep in state, see event.go of the chaincodes
+const eventIndex = "Event"
+
+// Separator of the parts of the composite keys created by shim.CreateCompositeKey
+const compositeKeySeparator = "\x00"
+
+// Transaction is a decoded transaction of a block
+type Transaction struct {
+	Block      uint64   `json:"block"`
+	Index      int      `json:"index"`
+	TxID       string   `json:"txID"`
+	Channel    string   `json:"channel"`
+	Type       string   `json:"type"`
+	Validation string   `json:"validation"`
+	Timestamp  int64    `json:"timestamp"`
+	Creator    Creator  `json:"creator"`
+	Actions    []Action `json:"actions,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Creator is the identity which signed the transaction
+type Creator struct {
+	MSPID              string `json:"mspID"`
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+	CommonName         string `json:"commonName,omitempty"`
+}
+
+// Action is the invocation of a chaincode in a transaction and its results
+type Action struct {
+	Chaincode  string          `json:"chaincode"`
+	Function   string          `json:"function"`
+	Args       []string        `json:"args"`
+	Status     int32           `json:"status"`
+	Message    string          `json:"message,omitempty"`
+	Namespaces []Namespace     `json:"namespaces,omitempty"`
+	Event      *ChaincodeEvent `json:"event,omitempty"`
+}
+
+// Namespace is the read/write set of a chaincode, public and private
+type Namespace struct {
+	Namespace   string       `json:"namespace"`
+	Reads       []Read       `json:"reads,omitempty"`
+	Writes      []Write      `json:"writes,omitempty"`
+	Collections []Collection `json:"collections,omitempty"`
+}
+
+type Read struct {
+	Key     Key    `json:"key"`
+	Version string `json:"version,omitempty"`
+}
+
+type Write struct {
+	Key      Key             `json:"key"`
+	IsDelete bool            `json:"isDelete,omitempty"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Event    *Event          `json:"event,omitempty"`
+}
+
+// Key is a state key, split into its index and parts if it is a composite one
+type Key struct {
+	Raw   string   `json:"raw"`
+	Index string   `json:"index,omitempty"`
+	Parts []string `json:"parts,omitempty"`
+}
+
+// Collection holds the hashes of the reads and writes of a private data collection,
+// the block has nothing but the hashes
+type Collection struct {
+	Name         string        `json:"name"`
+	Reads        []HashedRead  `json:"reads,omitempty"`
+	Writes       []HashedWrite `json:"writes,omitempty"`
+	PvtRwsetHash string        `json:"pvtRwsetHash"`
+}
+
+type HashedRead struct {
+	KeyHash string `json:"keyHash"`
+	Version string `json:"version,omitempty"`
+}
+
+type HashedWrite struct {
+	KeyHash   string `json:"keyHash"`
+	IsDelete  bool   `json:"isDelete,omitempty"`
+	ValueHash string `json:"valueHash,omitempty"`
+}
+
+// Event is the value of an event kept in state by the chaincodes
+type Event struct {
+	ID         string      `json:"id"`
+	Timestamp  int64       `json:"timestamp"`
+	Creator    string      `json:"creator"`
+	EntityType string      `json:"entityType"`
+	EntityID   string      `json:"entityID"`
+	Action     string      `json:"action"`
+	Entity     interface{} `json:"entity"`
+}
+
+// ChaincodeEvent is the event a transaction set, its payload is decoded if it is
+// a payload the chaincodes emit
+type ChaincodeEvent struct {
+	Name    string        `json:"name"`
+	Payload *EventPayload `json:"payload,omitempty"`
+	Raw     string        `json:"raw,omitempty"`
+}
+
+// EventPayload is the payload of the chaincode events, see EventPayload of the chaincodes
+type EventPayload struct {
+	Version   int    `json:"version"`
+	Chaincode string `json:"chaincode"`
+	TxID      string `json:"txID"`
+	Timestamp int64  `json:"timestamp"`
+	Actor     struct {
+		MSPID              string `json:"mspID"`
+		OrganizationalUnit string `json:"organizationalUnit"`
+	} `json:"actor"`
+	Events []Event `json:"events"`
+}
+
+// eventEntry is the shape of an event in state and in event payloads
+type eventEntry struct {
+	Key struct {
+		ID string `json:"id"`
+	} `json:"key"`
+	Value eventValue `json:"value"`
+}
+
+type eventValue struct {
+	Timestamp  int64           `json:"timestamp"`
+	Creator    string          `json:"creator"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityID"`
+	Action     string          `json:"action"`
+	Other      json.RawMessage `json:"other"`
+}
+
+func (value eventValue) event(id string) Event {
+	return Event{
+		ID:         id,
+		Timestamp:  value.Timestamp,
+		Creator:    value.Creator,
+		EntityType: value.EntityType,
+		EntityID:   value.EntityID,
+		Action:     value.Action,
+		Entity:     decodeEntity(value.EntityType, value.Other),
+	}
+}
+
+// ReadBlocks reads the blocks of a block file of the ledger of a peer or a block fetched
+// by `peer channel fetch`
+func ReadBlocks(reader io.Reader) ([]*common.Block, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := readBlockFile(data)
+	if err == nil {
+		return blocks, nil
+	}
+
+	block := &common.Block{}
+	if proto.Unmarshal(data, block) == nil && block.Header != nil && block.Data != nil {
+		return []*common.Block{block}, nil
+	}
+
+	return blocks, err
+}
+
+// readBlockFile reads the blocks of a block file, where every block follows its varint encoded
+// length and is serialized the way the block storage of the peer does it rather than marshaled
+func readBlockFile(data []byte) ([]*common.Block, error) {
+	blocks := []*common.Block{}
+	for offset := 0; offset < len(data); {
+		length, size := proto.DecodeVarint(data[offset:])
+		if size == 0 || length == 0 {
+			return blocks, errors.New(fmt.Sprintf("unable to read the length of the block at %d", offset))
+		}
+
+		start := offset + size
+		end := start + int(length)
+		if end > len(data) {
+			return blocks, errors.New(fmt.Sprintf("block at %d is truncated", offset))
+		}
+
+		block, err := deserializeBlock(data[start:end])
+		if err != nil {
+			return blocks, errors.New(fmt.Sprintf("unable to read the block at %d: %s", offset, err.Error()))
+		}
+		blocks = append(blocks, block)
+
+		offset = end
+	}
+
+	return blocks, nil
+}
+
+// deserializeBlock reads the header number and hashes, the count of the envelopes and the envelopes,
+// then the count of the metadata and the metadata of a block, all as varints and length prefixed bytes
+func deserializeBlock(serializedBlock []byte) (*common.Block, error) {
+	reader := &blockReader{data: serializedBlock}
+	block := &common.Block{
+		Header:   &common.BlockHeader{},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{},
+	}
+
+	var err error
+	if block.Header.Number, err = reader.varint(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the number: %s", err.Error()))
+	}
+	if block.Header.DataHash, err = reader.bytes(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the data hash: %s", err.Error()))
+	}
+	if block.Header.PreviousHash, err = reader.bytes(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the previous hash: %s", err.Error()))
+	}
+
+	if block.Data.Data, err = reader.byteSlices(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the envelopes: %s", err.Error()))
+	}
+	if block.Metadata.Metadata, err = reader.byteSlices(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the metadata: %s", err.Error()))
+	}
+
+	if left := len(reader.data) - reader.offset; left != 0 {
+		return nil, errors.New(fmt.Sprintf("%d bytes are left after the metadata", left))
+	}
+
+	return block, nil
+}
+
+type blockReader struct {
+	data   []byte
+	offset int
+}
+
+func (reader *blockReader) varint() (uint64, error) {
+	value, size := proto.DecodeVarint(reader.data[reader.offset:])
+	if size == 0 {
+		return 0, errors.New(fmt.Sprintf("no varint at %d", reader.offset))
+	}
+	reader.offset += size
+
+	return value, nil
+}
+
+func (reader *blockReader) bytes() ([]byte, error) {
+	length, err := reader.varint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(reader.data)-reader.offset) {
+		return nil, errors.New(fmt.Sprintf("%d bytes at %d are truncated", length, reader.offset))
+	}
+
+	value := reader.data[reader.offset : reader.offset+int(length)]
+	reader.offset += int(length)
+
+	return value, nil
+}
+
+// byteSlices reads a varint count followed by as many length prefixed byte slices
+func (reader *blockReader) byteSlices() ([][]byte, error) {
+	count, err := reader.varint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(reader.data)-reader.offset) {
+		return nil, errors.New(fmt.Sprintf("count %d at %d is more than the bytes left", count, reader.offset))
+	}
+
+	slices := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		slice, err := reader.bytes()
+		if err != nil {
+			return nil, err
+		}
+		slices = append(slices, slice)
+	}
+
+	return slices, nil
+}
+
+// DecodeBlock decodes every transaction of the block, a transaction which cannot
+// be decoded keeps the error instead of failing the block
+func DecodeBlock(block *common.Block) ([]Transaction, error) {
+	transactions := []Transaction{}
+
+	if block == nil || block.Header == nil || block.Data == nil {
+		return transactions, errors.New("block has no header or no data")
+	}
+
+	var validations []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validations = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	for i, envelopeBytes := range block.Data.Data {
+		transaction := Transaction{Block: block.Header.Number, Index: i}
+		if i < len(validations) {
+			transaction.Validation = pb.TxValidationCode(validations[i]).String()
+		}
+
+		if err := decodeEnvelope(envelopeBytes, &transaction); err != nil {
+			transaction.Error = err.Error()
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+func decodeEnvelope(envelopeBytes []byte, transaction *Transaction) error {
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+		return errors.New(fmt.Sprintf("unable to unmarshal the envelope: %s", err.Error()))
+	}
+
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return errors.New(fmt.Sprintf("unable to unmarshal the payload: %s", err.Error()))
+	}
+	if payload.Header == nil {
+		return errors.New("payload has no header")
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return errors.New(fmt.Sprintf("unable to unmarshal the channel header: %s", err.Error()))
+	}
+	transaction.TxID = channelHeader.TxId
+	transaction.Channel = channelHeader.ChannelId
+	transaction.Type = common.HeaderType(channelHeader.Type).String()
+	if channelHeader.Timestamp != nil {
+		transaction.Timestamp = channelHeader.Timestamp.Seconds
+	}
+
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.Header.SignatureHeader, signatureHeader); err != nil {
+		return errors.New(fmt.Sprintf("unable to unmarshal the signature header: %s", err.Error()))
+	}
+	transaction.Creator = decodeCreator(signatureHeader.Creator)
+
+	if channelHeader.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return nil
+	}
+
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(payload.Data, tx); err != nil {
+		return errors.New(fmt.Sprintf("unable to unmarshal the transaction: %s", err.Error()))
+	}
+
+	for _, txAction := range tx.Actions {
+		action, err := decodeAction(txAction)
+		if err != nil {
+			return err
+		}
+		transaction.Actions = append(transaction.Actions, action)
+	}
+
+	return nil
+}
+
+func decodeCreator(creatorBytes []byte) Creator {
+	creator := Creator{}
+
+	identity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(creatorBytes, identity); err != nil {
+		return creator
+	}
+	creator.MSPID = identity.Mspid
+
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return creator
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return creator
+	}
+	creator.CommonName = certificate.Subject.CommonName
+	if len(certificate.Subject.OrganizationalUnit) > 0 {
+		creator.OrganizationalUnit = certificate.Subject.OrganizationalUnit[0]
+	}
+
+	return creator
+}
+
+func decodeAction(txAction *pb.TransactionAction) (Action, error) {
+	action := Action{}
+
+	actionPayload := &pb.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(txAction.Payload, actionPayload); err != nil {
+		return action, errors.New(fmt.Sprintf("unable to unmarshal the action payload: %s", err.Error()))
+	}
+
+	proposalPayload := &pb.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(actionPayload.ChaincodeProposalPayload, proposalPayload); err != nil {
+		return action, errors.New(fmt.Sprintf("unable to unmarshal the proposal payload: %s", err.Error()))
+	}
+
+	invocation := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(proposalPayload.Input, invocation); err != nil {
+		return action, errors.New(fmt.Sprintf("unable to unmarshal the invocation: %s", err.Error()))
+	}
+
+	if spec := invocation.ChaincodeSpec; spec != nil {
+		if spec.ChaincodeId != nil {
+			action.Chaincode = spec.ChaincodeId.Name
+		}
+		if spec.Input != nil && len(spec.Input.Args) > 0 {
+			action.Function = string(spec.Input.Args[0])
+			for _, arg := range spec.Input.Args[1:] {
+				action.Args = append(action.Args, string(arg))
+			}
+		}
+	}
+
+	if actionPayload.Action == nil {
+		return action, nil
+	}
+
+	responsePayload := &pb.ProposalResponsePayload{}
+	if err := proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload); err != nil {
+		return action, errors.New(fmt.Sprintf("unable to unmarshal the proposal response payload: %s", err.Error()))
+	}
+
+	chaincodeAction := &pb.ChaincodeAction{}
+	if err := proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+		return action, errors.New(fmt.Sprintf("unable to unmarshal the chaincode action: %s", err.Error()))
+	}
+
+	if chaincodeAction.Response != nil {
+		action.Status = chaincodeAction.Response.Status
+		action.Message = chaincodeAction.Response.Message
+	}
+
+	namespaces, err := decodeReadWriteSet(chaincodeAction.Results)
+	if err != nil {
+		return action, err
+	}
+	action.Namespaces = namespaces
+
+	if len(chaincodeAction.Events) != 0 {
+		chaincodeEvent := &pb.ChaincodeEvent{}
+		if err := proto.Unmarshal(chaincodeAction.Events, chaincodeEvent); err != nil {
+			return action, errors.New(fmt.Sprintf("unable to unmarshal the chaincode event: %s", err.Error()))
+		}
+		action.Event = decodeChaincodeEvent(chaincodeEvent)
+	}
+
+	return action, nil
+}
+
+func decodeReadWriteSet(results []byte) ([]Namespace, error) {
+	txRwSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRwSet); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to unmarshal the read/write set: %s", err.Error()))
+	}
+
+	namespaces := []Namespace{}
+	for _, nsRwSet := range txRwSet.NsRwset {
+		namespace := Namespace{Namespace: nsRwSet.Namespace}
+
+		kvRwSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsRwSet.Rwset, kvRwSet); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to unmarshal the read/write set of %s: %s", nsRwSet.Namespace, err.Error()))
+		}
+
+		for _, kvRead := range kvRwSet.Reads {
+			namespace.Reads = append(namespace.Reads, Read{Key: decodeKey(kvRead.Key), Version: decodeVersion(kvRead.Version)})
+		}
+
+		for _, kvWrite := range kvRwSet.Writes {
+			namespace.Writes = append(namespace.Writes, decodeWrite(kvWrite))
+		}
+
+		for _, collectionRwSet := range nsRwSet.CollectionHashedRwset {
+			collection := Collection{Name: collectionRwSet.CollectionName, PvtRwsetHash: hex.EncodeToString(collectionRwSet.PvtRwsetHash)}
+
+			hashedRwSet := &kvrwset.HashedRWSet{}
+			if err := proto.Unmarshal(collectionRwSet.HashedRwset, hashedRwSet); err != nil {
+				return nil, errors.New(fmt.Sprintf("unable to unmarshal the hashed read/write set of %s: %s", collectionRwSet.CollectionName, err.Error()))
+			}
+
+			for _, hashedRead := range hashedRwSet.HashedReads {
+				collection.Reads = append(collection.Reads, HashedRead{KeyHash: hex.EncodeToString(hashedRead.KeyHash), Version: decodeVersion(hashedRead.Version)})
+			}
+
+			for _, hashedWrite := range hashedRwSet.HashedWrites {
+				collection.Writes = append(collection.Writes, HashedWrite{
+					KeyHash:   hex.EncodeToString(hashedWrite.KeyHash),
+					IsDelete:  hashedWrite.IsDelete,
+					ValueHash: hex.EncodeToString(hashedWrite.ValueHash),
+				})
+			}
+
+			namespace.Collections = append(namespace.Collections, collection)
+		}
+
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces, nil
+}
+
+func decodeWrite(kvWrite *kvrwset.KVWrite) Write {
+	write := Write{Key: decodeKey(kvWrite.Key), IsDelete: kvWrite.IsDelete}
+	if kvWrite.IsDelete {
+		return write
+	}
+
+	if json.Valid(kvWrite.Value) {
+		write.Value = json.RawMessage(kvWrite.Value)
+	} else {
+		// values of the chaincodes are JSON, anything else is kept as a JSON string
+		value, _ := json.Marshal(string(kvWrite.Value))
+		write.Value = json.RawMessage(value)
+	}
+
+	if write.Key.Index == eventIndex && len(write.Key.Parts) > 0 {
+		value := eventValue{}
+		if err := json.Unmarshal(kvWrite.Value, &value); err == nil {
+			event := value.event(write.Key.Parts[0])
+			write.Event = &event
+		}
+	}
+
+	return write
+}
+
+// decodeKey splits a composite key into its index and parts
+func decodeKey(key string) Key {
+	decoded := Key{Raw: key}
+	if !strings.HasPrefix(key, compositeKeySeparator) {
+		return decoded
+	}
+
+	parts := strings.Split(strings.TrimSuffix(key[len(compositeKeySeparator):], compositeKeySeparator), compositeKeySeparator)
+	decoded.Raw = strings.Join(parts, ".")
+	decoded.Index = parts[0]
+	decoded.Parts = parts[1:]
+
+	return decoded
+}
+
+func decodeVersion(version *kvrwset.Version) string {
+	if version == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", version.BlockNum, version.TxNum)
+}
+
+func decodeChaincodeEvent(chaincodeEvent *pb.ChaincodeEvent) *ChaincodeEvent {
+	event := &ChaincodeEvent{Name: chaincodeEvent.EventName}
+
+	payload := struct {
+		EventPayload
+		Events []eventEntry `json:"events"`
+	}{}
+	if err := json.Unmarshal(chaincodeEvent.Payload, &payload); err != nil || payload.Version == 0 {
+		event.Raw = string(chaincodeEvent.Payload)
+		return event
+	}
+
+	event.Payload = &payload.EventPayload
+	event.Payload.Events = []Event{}
+	for _, entry := range payload.Events {
+		event.Payload.Events = append(event.Payload.Events, entry.Value.event(entry.Key.ID))
+	}
+
+	return event
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+	"github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testTxID    = "4b1c0f9e2d8a7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b"
+	testOrderID = "5a8c2e1f-9b7d-4c3a-8e6f-1d2b3c4a5e69"
+	testEventID = "6b9d3f2a-0c8e-4d4b-9f7a-2e3c4d5b6f70"
+)
+
+func marshal(t *testing.T, message proto.Message) []byte {
+	bytes, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes
+}
+
+// creator returns the serialized identity of a Buyer of ORG1MSP
+func creator(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "buyer@org1", OrganizationalUnit: []string{"Buyer"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+	return marshal(t, &msp.SerializedIdentity{Mspid: "ORG1MSP", IdBytes: idBytes})
+}
+
+// envelope builds an endorser transaction accepting an order, it keeps the order event in state,
+// writes the contract to a private collection and emits an event payload of version 1
+func envelope(t *testing.T) []byte {
+	order := `{"productName":"coffee","quantity":150,"price":12.5,"state":2}`
+	eventKey := "\x00Event\x00" + testEventID + "\x00"
+	eventValue := `{"timestamp":1700000000,"creator":"Supplier","entityType":"Order","entityID":"` + testOrderID + `","action":"acceptOrder","other":` + order + `}`
+
+	kvRwSet := &kvrwset.KVRWSet{
+		Reads:  []*kvrwset.KVRead{{Key: "\x00Order\x00" + testOrderID + "\x00", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}}},
+		Writes: []*kvrwset.KVWrite{{Key: eventKey, Value: []byte(eventValue)}},
+	}
+
+	contract := []byte(`{"price":11.75,"totalDue":1762.5}`)
+	keyHash := sha256.Sum256([]byte("\x00Contract\x00" + testOrderID + "\x00"))
+	valueHash := sha256.Sum256(contract)
+	hashedRwSet := &kvrwset.HashedRWSet{HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: keyHash[:], ValueHash: valueHash[:]}}}
+
+	txRwSet := &rwset.TxReadWriteSet{NsRwset: []*rwset.NsReadWriteSet{{
+		Namespace: "supply-chain-chaincode",
+		Rwset:     marshal(t, kvRwSet),
+		CollectionHashedRwset: []*rwset.CollectionHashedReadWriteSet{{
+			CollectionName: "ORG1-ORG2-Contract",
+			HashedRwset:    marshal(t, hashedRwSet),
+			PvtRwsetHash:   []byte{0xca, 0xfe},
+		}},
+	}}}
+
+	payload := `{"version":1,"chaincode":"supply-chain-chaincode","txID":"` + testTxID + `","timestamp":1700000000,` +
+		`"actor":{"mspID":"ORG2MSP","organizationalUnit":"Supplier"},"events":[` +
+		`{"key":{"id":"` + testEventID + `"},"value":` + eventValue + `},` +
+		`{"key":{"id":"7c0e4a3b-1d9f-4e5c-8a6b-3f4d5e6c7a81"},"value":{"entityType":"Contract","entityID":"` + testOrderID + `","action":"acceptOrder","other":{"hash":"` + hex.EncodeToString(valueHash[:]) + `"}}},` +
+		`{"key":{"id":"8d1f5b4c-2e0a-4f6d-9b7c-4a5e6f7d8b92"},"value":{"entityType":"ConfigSC","action":"updateConfig","other":{"version":2}}}]}`
+	chaincodeEvent := &pb.ChaincodeEvent{ChaincodeId: "supply-chain-chaincode", TxId: testTxID, EventName: "supply-chain-chaincode.acceptOrder", Payload: []byte(payload)}
+
+	chaincodeAction := &pb.ChaincodeAction{
+		Results:  marshal(t, txRwSet),
+		Events:   marshal(t, chaincodeEvent),
+		Response: &pb.Response{Status: 200},
+	}
+
+	invocation := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		ChaincodeId: &pb.ChaincodeID{Name: "supply-chain-chaincode"},
+		Input:       &pb.ChaincodeInput{Args: [][]byte{[]byte("acceptOrder"), []byte(testOrderID)}},
+	}}
+
+	actionPayload := &pb.ChaincodeActionPayload{
+		ChaincodeProposalPayload: marshal(t, &pb.ChaincodeProposalPayload{Input: marshal(t, invocation)}),
+		Action: &pb.ChaincodeEndorsedAction{
+			ProposalResponsePayload: marshal(t, &pb.ProposalResponsePayload{Extension: marshal(t, chaincodeAction)}),
+		},
+	}
+
+	channelHeader := &common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: "common",
+		TxId:      testTxID,
+		Timestamp: &timestamp.Timestamp{Seconds: 1700000000},
+	}
+
+	return marshal(t, &common.Envelope{Payload: marshal(t, &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   marshal(t, channelHeader),
+			SignatureHeader: marshal(t, &common.SignatureHeader{Creator: creator(t)}),
+		},
+		Data: marshal(t, &pb.Transaction{Actions: []*pb.TransactionAction{{Payload: marshal(t, actionPayload)}}}),
+	})})
+}
+
+func testBlock(t *testing.T, number uint64) *common.Block {
+	metadata := make([][]byte, common.BlockMetadataIndex_TRANSACTIONS_FILTER+1)
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{byte(pb.TxValidationCode_VALID), byte(pb.TxValidationCode_MVCC_READ_CONFLICT)}
+
+	return &common.Block{
+		Header:   &common.BlockHeader{Number: number},
+		Data:     &common.BlockData{Data: [][]byte{envelope(t), []byte("not an envelope")}},
+		Metadata: &common.BlockMetadata{Metadata: metadata},
+	}
+}
+
+func TestDecodeBlock(t *testing.T) {
+	transactions, err := DecodeBlock(testBlock(t, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(transactions))
+	}
+
+	if transaction := transactions[1]; transaction.Error == "" || transaction.Validation != "MVCC_READ_CONFLICT" {
+		t.Errorf("a transaction which isn't an envelope is decoded: %+v", transaction)
+	}
+
+	transaction := transactions[0]
+	if transaction.Error != "" {
+		t.Fatal(transaction.Error)
+	}
+
+	if transaction.Block != 7 || transaction.TxID != testTxID || transaction.Channel != "common" || transaction.Validation != "VALID" || transaction.Timestamp != 1700000000 {
+		t.Errorf("unexpected transaction %+v", transaction)
+	}
+
+	if transaction.Creator != (Creator{MSPID: "ORG1MSP", OrganizationalUnit: "Buyer", CommonName: "buyer@org1"}) {
+		t.Errorf("unexpected creator %+v", transaction.Creator)
+	}
+
+	if len(transaction.Actions) != 1 {
+		t.Fatalf("expected 1 action, got %d", len(transaction.Actions))
+	}
+
+	action := transaction.Actions[0]
+	if action.Chaincode != "supply-chain-chaincode" || action.Function != "acceptOrder" || len(action.Args) != 1 || action.Args[0] != testOrderID || action.Status != 200 {
+		t.Errorf("unexpected action %+v", action)
+	}
+
+	if len(action.Namespaces) != 1 {
+		t.Fatalf("expected 1 namespace, got %d", len(action.Namespaces))
+	}
+
+	namespace := action.Namespaces[0]
+	if len(namespace.Reads) != 1 || namespace.Reads[0].Key.Index != "Order" || namespace.Reads[0].Version != "3:1" {
+		t.Errorf("unexpected reads %+v", namespace.Reads)
+	}
+
+	// the block has the hashes of the private writes only
+	valueHash := sha256.Sum256([]byte(`{"price":11.75,"totalDue":1762.5}`))
+	if len(namespace.Collections) != 1 || namespace.Collections[0].Name != "ORG1-ORG2-Contract" || namespace.Collections[0].PvtRwsetHash != "cafe" ||
+		len(namespace.Collections[0].Writes) != 1 || namespace.Collections[0].Writes[0].ValueHash != hex.EncodeToString(valueHash[:]) {
+		t.Errorf("unexpected collections %+v", namespace.Collections)
+	}
+
+	// events kept in state are decoded into their entities
+	if len(namespace.Writes) != 1 || namespace.Writes[0].Event == nil {
+		t.Fatalf("event write isn't decoded: %+v", namespace.Writes)
+	}
+
+	stored := namespace.Writes[0].Event
+	if order, ok := stored.Entity.(*Order); !ok || stored.ID != testEventID || order.ProductName != "coffee" || order.Quantity != 150 {
+		t.Errorf("unexpected stored event %+v", stored)
+	}
+
+	if action.Event == nil || action.Event.Payload == nil {
+		t.Fatalf("event payload isn't decoded: %+v", action.Event)
+	}
+
+	payload := action.Event.Payload
+	if payload.Version != 1 || payload.TxID != testTxID || payload.Actor.MSPID != "ORG2MSP" || len(payload.Events) != 3 {
+		t.Fatalf("unexpected event payload %+v", payload)
+	}
+
+	if _, ok := payload.Events[0].Entity.(*Order); !ok {
+		t.Errorf("order event carries %T", payload.Events[0].Entity)
+	}
+
+	if digest, ok := payload.Events[1].Entity.(*EntityDigest); !ok || digest.Hash != hex.EncodeToString(valueHash[:]) {
+		t.Errorf("private contract event carries %#v", payload.Events[1].Entity)
+	}
+
+	if raw, ok := payload.Events[2].Entity.(json.RawMessage); !ok || string(raw) != `{"version":2}` {
+		t.Errorf("event of an unknown entity type carries %#v", payload.Events[2].Entity)
+	}
+}
+
+// serializeBlock writes a block the way the block storage of the peer writes it to a block file,
+// after its varint encoded length
+func serializeBlock(block *common.Block) []byte {
+	buffer := proto.NewBuffer(nil)
+	buffer.EncodeVarint(block.Header.Number)
+	buffer.EncodeRawBytes(block.Header.DataHash)
+	buffer.EncodeRawBytes(block.Header.PreviousHash)
+
+	buffer.EncodeVarint(uint64(len(block.Data.Data)))
+	for _, envelopeBytes := range block.Data.Data {
+		buffer.EncodeRawBytes(envelopeBytes)
+	}
+
+	buffer.EncodeVarint(uint64(len(block.Metadata.Metadata)))
+	for _, metadata := range block.Metadata.Metadata {
+		buffer.EncodeRawBytes(metadata)
+	}
+
+	return append(proto.EncodeVarint(uint64(len(buffer.Bytes()))), buffer.Bytes()...)
+}
+
+func TestReadBlocks(t *testing.T) {
+	first := testBlock(t, 1)
+	first.Header.DataHash = []byte("data hash")
+	first.Header.PreviousHash = []byte("previous hash")
+	second := testBlock(t, 2)
+
+	blocks, err := ReadBlocks(bytes.NewReader(marshal(t, first)))
+	if err != nil || len(blocks) != 1 || blocks[0].Header.Number != 1 {
+		t.Fatalf("fetched block isn't read: %v %v", blocks, err)
+	}
+
+	file := append(serializeBlock(first), serializeBlock(second)...)
+
+	blocks, err = ReadBlocks(bytes.NewReader(file))
+	if err != nil || len(blocks) != 2 {
+		t.Fatalf("block file isn't read: %v %v", blocks, err)
+	}
+	if !proto.Equal(blocks[0], first) || blocks[1].Header.Number != 2 {
+		t.Errorf("blocks of the file differ: %v", blocks)
+	}
+
+	transactions, err := DecodeBlock(blocks[0])
+	if err != nil || len(transactions) != 2 || transactions[1].Validation != "MVCC_READ_CONFLICT" {
+		t.Errorf("block of the file isn't decoded: %v %v", transactions, err)
+	}
+
+	// block 5 with the data hash 0102, no previous hash, the envelope "abc" and no metadata
+	blocks, err = ReadBlocks(bytes.NewReader([]byte{11, 5, 2, 1, 2, 0, 1, 3, 'a', 'b', 'c', 0}))
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("block file isn't read: %v %v", blocks, err)
+	}
+	if block := blocks[0]; block.Header.Number != 5 || !bytes.Equal(block.Header.DataHash, []byte{1, 2}) ||
+		len(block.Data.Data) != 1 || string(block.Data.Data[0]) != "abc" || len(block.Metadata.Metadata) != 0 {
+		t.Errorf("block of the file differs: %v", block)
+	}
+
+	truncated := serializeBlock(second)
+	file = append(serializeBlock(first), truncated[:len(truncated)-1]...)
+
+	if _, err := ReadBlocks(bytes.NewReader(file)); err == nil {
+		t.Error("a truncated block is read")
+	}
+
+	if _, err := DecodeBlock(&common.Block{Header: &common.BlockHeader{Number: 3}}); err == nil {
+		t.Error("a block without data is decoded")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// Entities the events of the chaincodes carry, decoded by the entity type of the event;
+// the fields follow the values of the entities in the chaincodes, the cryptographic
+// material of the proofs and the predicates of the contracts are kept as JSON
+
+type Order struct {
+	ProductName string  `json:"productName"`
+	Quantity    int     `json:"quantity"`
+	Price       float32 `json:"price"`
+	Amount      float32 `json:"amount"`
+	Destination string  `json:"destination"`
+	DueDate     int64   `json:"dueDate"`
+	PaymentDate int64   `json:"paymentDate"`
+	BuyerID     string  `json:"buyerID"`
+	BuyerMSP    string  `json:"buyerMSP"`
+	State       int     `json:"state"`
+	Guarantor   string  `json:"guarantor"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+type Contract struct {
+	Price         float32         `json:"price"`
+	ProductName   string          `json:"productName"`
+	ConsignorName string          `json:"consignorName"`
+	ConsigneeName string          `json:"consigneeName"`
+	ConsignorMSP  string          `json:"consignorMSP"`
+	ConsigneeMSP  string          `json:"consigneeMSP"`
+	TotalDue      float32         `json:"totalDue"`
+	Quantity      int             `json:"quantity"`
+	Guarantor     string          `json:"guarantor"`
+	Destination   string          `json:"destination"`
+	DueDate       int64           `json:"dueDate"`
+	PaymentDate   int64           `json:"paymentDate"`
+	Documents     []string        `json:"documents"`
+	Predicates    json.RawMessage `json:"predicates,omitempty"`
+	State         int             `json:"state"`
+	Timestamp     int64           `json:"timestamp"`
+	UpdatedDate   int64           `json:"updatedDate"`
+}
+
+type Shipment struct {
+	ContractID   string `json:"contractID"`
+	Consignor    string `json:"consignor"`
+	ShipFrom     string `json:"shipFrom"`
+	ShipTo       string `json:"shipTo"`
+	Transport    string `json:"transport"`
+	Description  string `json:"description"`
+	State        int    `json:"state"`
+	Timestamp    int64  `json:"timestamp"`
+	DeliveryDate int64  `json:"deliveryDate"`
+	UpdatedDate  int64  `json:"updatedDate"`
+}
+
+type Document struct {
+	EntityType   int    `json:"entityType"`
+	EntityID     string `json:"entityID"`
+	ContractID   string `json:"contractID"`
+	DocumentHash string `json:"documentHash"`
+	DocumentMeta string `json:"documentMeta"`
+	DocumentType int    `json:"documentType"`
+	Category     string `json:"category"`
+	Owner        string `json:"owner"`
+	Version      int    `json:"version"`
+	PreviousID   string `json:"previousID"`
+	Timestamp    int64  `json:"timestamp"`
+	UpdatedDate  int64  `json:"updatedDate"`
+}
+
+type Report struct {
+	Owner         string `json:"owner"`
+	Description   string `json:"description"`
+	ShipmentID    string `json:"shipmentID"`
+	ProofID       string `json:"proofID"`
+	ConsignorName string `json:"consignorName"`
+	State         int    `json:"state"`
+	Timestamp     int64  `json:"timestamp"`
+	UpdatedDate   int64  `json:"updatedDate"`
+}
+
+type Proof struct {
+	Type                int             `json:"type"`
+	SnapShot            json.RawMessage `json:"snapShot,omitempty"`
+	DataForVerification json.RawMessage `json:"dataForVerification,omitempty"`
+	PredicateProofs     json.RawMessage `json:"predicateProofs,omitempty"`
+	State               int             `json:"state"`
+	ConsignorName       string          `json:"consignorName"`
+	IssuerID            string          `json:"issuerID"`
+	RevocationHandle    string          `json:"revocationHandle"`
+	Owner               string          `json:"owner"`
+	Timestamp           int64           `json:"timestamp"`
+	ShipmentID          string          `json:"shipmentID"`
+	UpdatedDate         int64           `json:"updatedDate"`
+}
+
+type BillOfLading struct {
+	ShipmentID   string               `json:"shipmentID"`
+	ContractID   string               `json:"contractID"`
+	Issuer       string               `json:"issuer"`
+	Holder       string               `json:"holder"`
+	Holders      []BillOfLadingHolder `json:"holders"`
+	SecuredParty string               `json:"securedParty"`
+	PledgedFor   string               `json:"pledgedFor"`
+	State        int                  `json:"state"`
+	Timestamp    int64                `json:"timestamp"`
+	UpdatedDate  int64                `json:"updatedDate"`
+}
+
+type BillOfLadingHolder struct {
+	Holder     string `json:"holder"`
+	EndorsedBy string `json:"endorsedBy"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+type Signature struct {
+	Role         string `json:"role"`
+	MSPID        string `json:"mspID"`
+	Certificate  string `json:"certificate"`
+	DocumentHash string `json:"documentHash"`
+	Signature    string `json:"signature"`
+	Timestamp    int64  `json:"timestamp"`
+}
+
+type Guarantee struct {
+	Bank        string  `json:"bank"`
+	Buyer       string  `json:"buyer"`
+	Amount      float32 `json:"amount"`
+	State       int     `json:"state"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+type Invoice struct {
+	Debtor      string  `json:"debtor"`
+	Beneficiary string  `json:"beneficiary"`
+	Seller      string  `json:"seller"`
+	TotalDue    float32 `json:"totalDue"`
+	Outstanding float32 `json:"outstanding"`
+	PaymentDate int64   `json:"paymentDate"`
+	State       int     `json:"state"`
+	Guarantor   string  `json:"guarantor"`
+	Collateral  string  `json:"collateral"`
+	Owner       string  `json:"owner"`
+	OwnerMSP    string  `json:"ownerMSP"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+type Bid struct {
+	Rate        float32 `json:"rate"`
+	FactorID    string  `json:"factorID"`
+	FactorMSP   string  `json:"factorMSP"`
+	InvoiceID   string  `json:"invoiceID"`
+	State       int     `json:"state"`
+	Timestamp   int64   `json:"timestamp"`
+	UpdatedDate int64   `json:"updatedDate"`
+}
+
+type CreditNote struct {
+	InvoiceID      string  `json:"invoiceID"`
+	Amount         float32 `json:"amount"`
+	Reason         string  `json:"reason"`
+	Origin         int     `json:"origin"`
+	Issuer         string  `json:"issuer"`
+	AcknowledgedBy string  `json:"acknowledgedBy"`
+	State          int     `json:"state"`
+	Timestamp      int64   `json:"timestamp"`
+	UpdatedDate    int64   `json:"updatedDate"`
+}
+
+type Participant struct {
+	LegalName    string        `json:"legalName"`
+	LEI          string        `json:"lei"`
+	Country      string        `json:"country"`
+	Status       string        `json:"status"`
+	KYCStatus    string        `json:"kycStatus"`
+	KYCExpiry    int64         `json:"kycExpiry"`
+	BankAccounts []BankAccount `json:"bankAccounts"`
+	RegisteredBy string        `json:"registeredBy"`
+	Timestamp    int64         `json:"timestamp"`
+	UpdatedDate  int64         `json:"updatedDate"`
+}
+
+type BankAccount struct {
+	Bank      string `json:"bank"`
+	Reference string `json:"reference"`
+	Currency  string `json:"currency"`
+}
+
+// EntityDigest stands for an entity kept in a private collection, the events carry its hash only
+type EntityDigest struct {
+	Hash string `json:"hash"`
+}
+
+// entityTypes creates the entity of an entity type, i.e. of the index of the entity in the chaincodes
+var entityTypes = map[string]func() interface{}{
+	"Order":        func() interface{} { return new(Order) },
+	"Contract":     func() interface{} { return new(Contract) },
+	"Shipment":     func() interface{} { return new(Shipment) },
+	"Document":     func() interface{} { return new(Document) },
+	"Report":       func() interface{} { return new(Report) },
+	"Proof":        func() interface{} { return new(Proof) },
+	"BillOfLading": func() interface{} { return new(BillOfLading) },
+	"Signature":    func() interface{} { return new(Signature) },
+	"Guarantee":    func() interface{} { return new(Guarantee) },
+	"Invoice":      func() interface{} { return new(Invoice) },
+	"Bid":          func() interface{} { return new(Bid) },
+	"CreditNote":   func() interface{} { return new(CreditNote) },
+	"Participant":  func() interface{} { return new(Participant) },
+}
+
+// decodeEntity decodes the snapshot of the entity an event carries, the snapshot of an
+// entity of another type or which doesn't fit its type is kept as it is
+func decodeEntity(entityType string, snapshot json.RawMessage) interface{} {
+	if len(snapshot) == 0 || string(snapshot) == "null" {
+		return nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(snapshot, &fields); err == nil && len(fields) == 1 && fields["hash"] != nil {
+		digest := &EntityDigest{}
+		if err := json.Unmarshal(snapshot, digest); err == nil {
+			return digest
+		}
+	}
+
+	create, ok := entityTypes[entityType]
+	if !ok {
+		return snapshot
+	}
+
+	entity := create()
+	if err := json.Unmarshal(snapshot, entity); err != nil {
+		return snapshot
+	}
+
+	return entity
+}
@@ -0,0 +1,175 @@
+// Command blockdecoder decodes the transactions of Fabric blocks without a running peer,
+// from the output of `peer channel fetch` or from the block files of a ledger backup
+// (ledgersData/chains/chains/<channel>/blockfile_NNNNNN).
+//
+//	blockdecoder [-format json|table] [-block N] FILE...
+//
+// Every transaction is printed with the function and the args it invoked, its creator,
+// its read/write sets and the hashes of its private data; the events the chaincodes
+// keep in state and emit are decoded into their entities.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+func main() {
+	format := flag.String("format", formatJSON, "output format: json (a JSON object per line) or table")
+	blockNumber := flag.Int64("block", -1, "decode the block with this number only")
+	flag.Parse()
+
+	if *format != formatJSON && *format != formatTable {
+		fmt.Fprintf(os.Stderr, "unknown format %s: expected %s or %s\n", *format, formatJSON, formatTable)
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	transactions := []Transaction{}
+	for _, file := range files {
+		decoded, err := decodeFile(file, *blockNumber)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err.Error())
+			os.Exit(1)
+		}
+		transactions = append(transactions, decoded...)
+	}
+
+	var err error
+	if *format == formatTable {
+		err = writeTable(os.Stdout, transactions)
+	} else {
+		err = writeJSONLines(os.Stdout, transactions)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func decodeFile(file string, blockNumber int64) ([]Transaction, error) {
+	reader := os.Stdin
+	if file != "-" {
+		opened, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer opened.Close()
+		reader = opened
+	}
+
+	blocks, err := ReadBlocks(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []Transaction{}
+	for _, block := range blocks {
+		if blockNumber >= 0 && block.Header.Number != uint64(blockNumber) {
+			continue
+		}
+		decoded, err := DecodeBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, decoded...)
+	}
+
+	return transactions, nil
+}
+
+func writeJSONLines(writer io.Writer, transactions []Transaction) error {
+	encoder := json.NewEncoder(writer)
+	for _, transaction := range transactions {
+		if err := encoder.Encode(transaction); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTable prints a row per action, the events of the action are listed by their actions
+func writeTable(writer io.Writer, transactions []Transaction) error {
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "BLOCK\tTX\tTXID\tVALIDATION\tCREATOR\tCHAINCODE\tFUNCTION\tARGS\tREADS\tWRITES\tPRIVATE\tEVENTS")
+
+	for _, transaction := range transactions {
+		creator := transaction.Creator.MSPID
+		if transaction.Creator.OrganizationalUnit != "" {
+			creator += "/" + transaction.Creator.OrganizationalUnit
+		}
+
+		prefix := fmt.Sprintf("%d\t%d\t%s\t%s\t%s", transaction.Block, transaction.Index, transaction.TxID, transaction.Validation, creator)
+
+		if transaction.Error != "" {
+			fmt.Fprintf(table, "%s\t\t\t%s\t\t\t\t\n", prefix, cell("error: "+transaction.Error))
+			continue
+		}
+
+		if len(transaction.Actions) == 0 {
+			fmt.Fprintf(table, "%s\t\t%s\t\t\t\t\t\n", prefix, transaction.Type)
+			continue
+		}
+
+		for _, action := range transaction.Actions {
+			reads, writes, private := 0, 0, 0
+			stored := []string{}
+			for _, namespace := range action.Namespaces {
+				reads += len(namespace.Reads)
+				writes += len(namespace.Writes)
+				for _, collection := range namespace.Collections {
+					private += len(collection.Writes)
+				}
+				for _, write := range namespace.Writes {
+					if write.Event != nil {
+						stored = append(stored, write.Event.Action+":"+write.Event.EntityID)
+					}
+				}
+			}
+
+			// the payload of the chaincode event has the events even if they aren't kept in state
+			events := stored
+			if action.Event != nil && action.Event.Payload != nil {
+				events = []string{}
+				for _, event := range action.Event.Payload.Events {
+					events = append(events, event.Action+":"+event.EntityID)
+				}
+			} else if action.Event != nil && len(stored) == 0 {
+				events = []string{action.Event.Name}
+			}
+
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", prefix, action.Chaincode, action.Function,
+				cell(strings.Join(action.Args, " ")), reads, writes, private, strings.Join(events, ","))
+		}
+	}
+
+	return table.Flush()
+}
+
+// cell keeps the text on one row of the table and cuts it if it is long
+func cell(text string) string {
+	const width = 60
+
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > width {
+		return text[:width-3] + "..."
+	}
+
+	return text
+}
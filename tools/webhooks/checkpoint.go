@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// Checkpoint is the last event the dispatcher is done with and the subscriptions the event
+// in progress is already delivered to, so that a restart delivers nothing twice
+type Checkpoint struct {
+	Position  Position `json:"position"`
+	Started   bool     `json:"started"`
+	Delivered []string `json:"delivered"`
+}
+
+// Done tells whether the event at the position is delivered to the subscription
+func (checkpoint *Checkpoint) Done(position Position, subscription string) bool {
+	if !checkpoint.Started || position.After(checkpoint.Position) {
+		return false
+	}
+
+	if checkpoint.Position.After(position) {
+		return true
+	}
+
+	for _, delivered := range checkpoint.Delivered {
+		if delivered == subscription {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Mark records the delivery of the event at the position to the subscription
+func (checkpoint *Checkpoint) Mark(position Position, subscription string) {
+	if !checkpoint.Started || position.After(checkpoint.Position) {
+		checkpoint.Position = position
+		checkpoint.Started = true
+		checkpoint.Delivered = []string{}
+	}
+
+	checkpoint.Delivered = append(checkpoint.Delivered, subscription)
+}
+
+// CheckpointStore keeps the checkpoint between the runs of the dispatcher
+type CheckpointStore interface {
+	Load() (Checkpoint, error)
+	Save(checkpoint Checkpoint) error
+}
+
+// FileCheckpointStore keeps the checkpoint in a file, replaced at once on every save
+type FileCheckpointStore struct {
+	Path string
+}
+
+func (store FileCheckpointStore) Load() (Checkpoint, error) {
+	checkpoint := Checkpoint{}
+
+	data, err := ioutil.ReadFile(store.Path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, err
+	}
+
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
+
+func (store FileCheckpointStore) Save(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	temporary := store.Path + ".tmp"
+	if err := ioutil.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary, store.Path)
+}
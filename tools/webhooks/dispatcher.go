@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Headers of the requests of the dispatcher
+const (
+	headerSignature = "X-Signature"
+	headerDelivery  = "X-Delivery-ID"
+	headerAction    = "X-Event-Action"
+)
+
+// Subscription is an endpoint and the events it is notified about, empty lists match any event
+type Subscription struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Chaincodes  []string `json:"chaincodes"`
+	Actions     []string `json:"actions"`
+	EntityTypes []string `json:"entityTypes"`
+}
+
+// Matches tells whether the subscription is notified about the event
+func (subscription Subscription) Matches(event SourceEvent) bool {
+	return matches(subscription.Chaincodes, event.Chaincode) &&
+		matches(subscription.Actions, event.Event.Action) &&
+		matches(subscription.EntityTypes, event.Event.EntityType)
+}
+
+func matches(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, expected := range values {
+		if expected == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetryPolicy is how many times a delivery is tried and how long the dispatcher waits in between,
+// the wait doubles after every attempt up to MaxBackoff
+type RetryPolicy struct {
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"maxBackoff"`
+}
+
+// Duration is a time.Duration written as "1s", "500ms" etc. in the config
+type Duration time.Duration
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	*duration = Duration(parsed)
+	return nil
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+// Notification is the body of the request to the endpoint of a subscription,
+// the delivery ID is the same for every attempt
+type Notification struct {
+	DeliveryID   string `json:"deliveryID"`
+	Subscription string `json:"subscription"`
+	SourceEvent
+}
+
+// DeadLetter is a notification the endpoint didn't take
+type DeadLetter struct {
+	Notification Notification `json:"notification"`
+	URL          string       `json:"url"`
+	Attempts     int          `json:"attempts"`
+	Error        string       `json:"error"`
+	Timestamp    int64        `json:"timestamp"`
+}
+
+// deliveryError is a failed attempt, a permanent one isn't retried
+type deliveryError struct {
+	message   string
+	permanent bool
+}
+
+func (err *deliveryError) Error() string {
+	return err.message
+}
+
+// Dispatcher posts the events of a source to the endpoints of the matching subscriptions
+type Dispatcher struct {
+	Subscriptions []Subscription
+	Retry         RetryPolicy
+	Client        *http.Client
+	Checkpoints   CheckpointStore
+	DeadLetters   io.Writer
+	Sleep         func(time.Duration)
+	Now           func() time.Time
+}
+
+// Run delivers the events of the source until its end, the events the checkpoint
+// covers are skipped
+func (dispatcher *Dispatcher) Run(source EventSource) error {
+	checkpoint, err := dispatcher.Checkpoints.Load()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to load the checkpoint: %s", err.Error()))
+	}
+
+	for {
+		event, err := source.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.New(fmt.Sprintf("unable to read the source: %s", err.Error()))
+		}
+
+		for _, subscription := range dispatcher.Subscriptions {
+			if !subscription.Matches(event) || checkpoint.Done(event.Position, subscription.Name) {
+				continue
+			}
+
+			if err := dispatcher.deliver(subscription, event); err != nil {
+				return err
+			}
+
+			checkpoint.Mark(event.Position, subscription.Name)
+			if err := dispatcher.Checkpoints.Save(checkpoint); err != nil {
+				return errors.New(fmt.Sprintf("unable to save the checkpoint: %s", err.Error()))
+			}
+		}
+	}
+}
+
+// deliver posts the event to the subscription, the notification goes to the dead letters
+// if every attempt fails; only a failure to write the dead letter is returned
+func (dispatcher *Dispatcher) deliver(subscription Subscription, event SourceEvent) error {
+	notification := Notification{
+		DeliveryID:   event.Event.ID + "." + subscription.Name,
+		Subscription: subscription.Name,
+		SourceEvent:  event,
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	attempts := dispatcher.Retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := time.Duration(dispatcher.Retry.Backoff)
+
+	var deliveryErr *deliveryError
+	attempt := 1
+	for ; attempt <= attempts; attempt++ {
+		deliveryErr = dispatcher.post(subscription, notification, body)
+		if deliveryErr == nil {
+			log.Printf("delivered %s to %s", notification.DeliveryID, subscription.URL)
+			return nil
+		}
+
+		log.Printf("attempt %d of %s to %s failed: %s", attempt, notification.DeliveryID, subscription.URL, deliveryErr.Error())
+		if deliveryErr.permanent || attempt == attempts {
+			break
+		}
+
+		dispatcher.Sleep(backoff)
+		backoff *= 2
+		if maxBackoff := time.Duration(dispatcher.Retry.MaxBackoff); maxBackoff > 0 && backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	deadLetter := DeadLetter{
+		Notification: notification,
+		URL:          subscription.URL,
+		Attempts:     attempt,
+		Error:        deliveryErr.Error(),
+		Timestamp:    dispatcher.Now().Unix(),
+	}
+
+	if err := json.NewEncoder(dispatcher.DeadLetters).Encode(deadLetter); err != nil {
+		return errors.New(fmt.Sprintf("unable to write the dead letter of %s: %s", notification.DeliveryID, err.Error()))
+	}
+
+	return nil
+}
+
+func (dispatcher *Dispatcher) post(subscription Subscription, notification Notification, body []byte) *deliveryError {
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{message: err.Error(), permanent: true}
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(headerSignature, "sha256="+Sign(subscription.Secret, body))
+	request.Header.Set(headerDelivery, notification.DeliveryID)
+	request.Header.Set(headerAction, notification.Event.Action)
+
+	response, err := dispatcher.Client.Do(request)
+	if err != nil {
+		return &deliveryError{message: err.Error()}
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+
+	// the endpoint refuses the notification itself, another attempt gets the same answer
+	permanent := response.StatusCode >= 400 && response.StatusCode < 500 &&
+		response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests
+
+	return &deliveryError{message: fmt.Sprintf("endpoint answered %s", response.Status), permanent: permanent}
+}
+
+// Sign is the hex HMAC-SHA256 of the body with the secret of the subscription,
+// the endpoint checks the X-Signature header against it
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,120 @@
+// Command webhooks notifies downstream systems, e.g. an ERP, about the events of the chaincodes.
+// It reads the events from a source, posts them as JSON signed with HMAC-SHA256 to the endpoints
+// of the subscriptions they match, retries with backoff, writes the notifications no endpoint
+// took to a dead letter file and keeps a checkpoint so that no event is delivered twice.
+//
+//	blockdecoder blockfile_000000 | webhooks -config webhooks.json
+//	webhooks -config webhooks.json -source decoded.jsonl
+//
+// The config lists the subscriptions, the retry policy and the files of the checkpoint
+// and the dead letters:
+//
+//	{
+//	  "subscriptions": [{"name": "erp", "url": "https://erp.example.com/hooks", "secret": "...",
+//	    "actions": ["acceptOrder", "confirmShipment", "acceptBid"], "entityTypes": []}],
+//	  "retry": {"attempts": 5, "backoff": "1s", "maxBackoff": "1m"},
+//	  "timeout": "10s",
+//	  "checkpoint": "webhooks.checkpoint",
+//	  "deadLetters": "webhooks.deadletters"
+//	}
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Config is the config file of the dispatcher
+type Config struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	Retry         RetryPolicy    `json:"retry"`
+	Timeout       Duration       `json:"timeout"`
+	Checkpoint    string         `json:"checkpoint"`
+	DeadLetters   string         `json:"deadLetters"`
+}
+
+func (config *Config) Validate() error {
+	names := make(map[string]bool)
+	for _, subscription := range config.Subscriptions {
+		if subscription.Name == "" || subscription.URL == "" || subscription.Secret == "" {
+			return errors.New("subscription must have a name, an url and a secret")
+		}
+
+		if names[subscription.Name] {
+			return errors.New(fmt.Sprintf("subscription %s is listed more than once", subscription.Name))
+		}
+		names[subscription.Name] = true
+	}
+
+	if config.Checkpoint == "" || config.DeadLetters == "" {
+		return errors.New("checkpoint and deadLetters files must be set")
+	}
+
+	return nil
+}
+
+func main() {
+	configPath := flag.String("config", "webhooks.json", "config file")
+	sourcePath := flag.String("source", "-", "JSON lines printed by blockdecoder, - for the standard input")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("%s: %s", *configPath, err.Error())
+	}
+
+	input := os.Stdin
+	if *sourcePath != "-" {
+		if input, err = os.Open(*sourcePath); err != nil {
+			log.Fatal(err)
+		}
+		defer input.Close()
+	}
+
+	source, err := NewFileSource(input)
+	if err != nil {
+		log.Fatalf("%s: %s", *sourcePath, err.Error())
+	}
+
+	deadLetters, err := os.OpenFile(config.DeadLetters, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer deadLetters.Close()
+
+	dispatcher := &Dispatcher{
+		Subscriptions: config.Subscriptions,
+		Retry:         config.Retry,
+		Client:        &http.Client{Timeout: time.Duration(config.Timeout)},
+		Checkpoints:   FileCheckpointStore{Path: config.Checkpoint},
+		DeadLetters:   deadLetters,
+		Sleep:         time.Sleep,
+		Now:           time.Now,
+	}
+
+	if err := dispatcher.Run(source); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func loadConfig(path string) (Config, error) {
+	config := Config{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
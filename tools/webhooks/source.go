@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version of the chaincode event payloads the dispatcher reads, see EventPayload of the chaincodes
+const eventPayloadVersion = 1
+
+// Position is the place of an event in the chain: the block, the transaction in the block
+// and the event in the payload of the transaction
+type Position struct {
+	Block uint64 `json:"block"`
+	Tx    int    `json:"tx"`
+	Event int    `json:"event"`
+}
+
+// After tells whether the position follows the other one
+func (position Position) After(other Position) bool {
+	if position.Block != other.Block {
+		return position.Block > other.Block
+	}
+	if position.Tx != other.Tx {
+		return position.Tx > other.Tx
+	}
+	return position.Event > other.Event
+}
+
+// Event is an event of a chaincode event payload
+type Event struct {
+	ID         string          `json:"id"`
+	Timestamp  int64           `json:"timestamp"`
+	Creator    string          `json:"creator"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityID"`
+	Action     string          `json:"action"`
+	Entity     json.RawMessage `json:"entity"`
+}
+
+// Actor is the identity which submitted the transaction of the event
+type Actor struct {
+	MSPID              string `json:"mspID"`
+	OrganizationalUnit string `json:"organizationalUnit"`
+}
+
+// SourceEvent is an event read from a source with the transaction it was emitted in
+type SourceEvent struct {
+	Position  Position `json:"position"`
+	Chaincode string   `json:"chaincode"`
+	TxID      string   `json:"txID"`
+	Actor     Actor    `json:"actor"`
+	Event     Event    `json:"event"`
+}
+
+// EventSource gives the events of the chaincodes in the order of the chain,
+// Next returns io.EOF after the last one
+type EventSource interface {
+	Next() (SourceEvent, error)
+}
+
+// ReplaySource replays the events it is given
+type ReplaySource struct {
+	events []SourceEvent
+}
+
+func NewReplaySource(events []SourceEvent) *ReplaySource {
+	return &ReplaySource{events: events}
+}
+
+func (source *ReplaySource) Next() (SourceEvent, error) {
+	if len(source.events) == 0 {
+		return SourceEvent{}, io.EOF
+	}
+
+	event := source.events[0]
+	source.events = source.events[1:]
+
+	return event, nil
+}
+
+// decodedTransaction is the part of a transaction printed by blockdecoder the dispatcher reads
+type decodedTransaction struct {
+	Block      uint64 `json:"block"`
+	Index      int    `json:"index"`
+	TxID       string `json:"txID"`
+	Validation string `json:"validation"`
+	Actions    []struct {
+		Event *struct {
+			Payload *struct {
+				Version   int     `json:"version"`
+				Chaincode string  `json:"chaincode"`
+				Actor     Actor   `json:"actor"`
+				Events    []Event `json:"events"`
+			} `json:"payload"`
+		} `json:"event"`
+	} `json:"actions"`
+}
+
+// NewFileSource reads the JSON lines blockdecoder prints for the blocks of a ledger,
+// the events of the transactions which failed validation are left out
+func NewFileSource(reader io.Reader) (*ReplaySource, error) {
+	events := []SourceEvent{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		transaction := decodedTransaction{}
+		if err := json.Unmarshal(scanner.Bytes(), &transaction); err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", line, err.Error()))
+		}
+
+		if transaction.Validation != "" && transaction.Validation != "VALID" {
+			continue
+		}
+
+		index := 0
+		for _, action := range transaction.Actions {
+			if action.Event == nil || action.Event.Payload == nil {
+				continue
+			}
+
+			payload := action.Event.Payload
+			if payload.Version != eventPayloadVersion {
+				return nil, errors.New(fmt.Sprintf("line %d: unsupported event payload version %d", line, payload.Version))
+			}
+
+			for _, event := range payload.Events {
+				events = append(events, SourceEvent{
+					Position:  Position{Block: transaction.Block, Tx: transaction.Index, Event: index},
+					Chaincode: payload.Chaincode,
+					TxID:      transaction.TxID,
+					Actor:     payload.Actor,
+					Event:     event,
+				})
+				index++
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewReplaySource(events), nil
+}
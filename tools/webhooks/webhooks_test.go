@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryCheckpointStore keeps the checkpoint between the runs of a test
+type memoryCheckpointStore struct {
+	checkpoint Checkpoint
+}
+
+func (store *memoryCheckpointStore) Load() (Checkpoint, error) {
+	return store.checkpoint, nil
+}
+
+func (store *memoryCheckpointStore) Save(checkpoint Checkpoint) error {
+	store.checkpoint = checkpoint
+	return nil
+}
+
+func TestDispatcherDeliversOnce(t *testing.T) {
+	const secret = "erp-secret"
+
+	delivered := []string{}
+	flakyAttempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		if request.Header.Get(headerSignature) != "sha256="+Sign(secret, body) {
+			t.Errorf("wrong signature of %s", request.Header.Get(headerDelivery))
+		}
+
+		switch request.URL.Path {
+		case "/rejecting":
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		case "/flaky":
+			if flakyAttempts++; flakyAttempts < 3 {
+				writer.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		delivered = append(delivered, request.URL.Path+" "+request.Header.Get(headerDelivery))
+	}))
+	defer server.Close()
+
+	decoded := `{"block":5,"index":0,"txID":"tx-a","validation":"VALID","actions":[{"event":{"name":"supply-chain-chaincode.acceptOrder","payload":{"version":1,"chaincode":"supply-chain-chaincode","actor":{"mspID":"ORG2MSP","organizationalUnit":"Supplier"},"events":[{"id":"e1","entityType":"Order","entityID":"o1","action":"acceptOrder"}]}}}]}
+{"block":5,"index":1,"txID":"tx-b","validation":"MVCC_READ_CONFLICT","actions":[{"event":{"name":"supply-chain-chaincode.acceptOrder","payload":{"version":1,"chaincode":"supply-chain-chaincode","events":[{"id":"e2","entityType":"Order","entityID":"o2","action":"acceptOrder"}]}}}]}
+{"block":6,"index":0,"txID":"tx-c","validation":"VALID","actions":[{"event":{"name":"trade-finance-chaincode.acceptBid","payload":{"version":1,"chaincode":"trade-finance-chaincode","events":[{"id":"e3","entityType":"Bid","entityID":"b1","action":"acceptBid"},{"id":"e4","entityType":"Invoice","entityID":"i1","action":"acceptBid"}]}}}]}
+`
+
+	subscriptions := []Subscription{
+		{Name: "erp", URL: server.URL + "/erp", Secret: secret, Actions: []string{"acceptOrder", "acceptBid"}, EntityTypes: []string{"Order", "Invoice"}},
+		{Name: "flaky", URL: server.URL + "/flaky", Secret: secret, Chaincodes: []string{"trade-finance-chaincode"}, EntityTypes: []string{"Bid"}},
+		{Name: "rejecting", URL: server.URL + "/rejecting", Secret: secret, Actions: []string{"acceptOrder"}},
+	}
+
+	sleeps := []time.Duration{}
+	deadLetters := &bytes.Buffer{}
+	checkpoints := &memoryCheckpointStore{}
+	dispatcher := &Dispatcher{
+		Subscriptions: subscriptions,
+		Retry:         RetryPolicy{Attempts: 4, Backoff: Duration(time.Second), MaxBackoff: Duration(time.Second + time.Second/2)},
+		Client:        server.Client(),
+		Checkpoints:   checkpoints,
+		DeadLetters:   deadLetters,
+		Sleep:         func(duration time.Duration) { sleeps = append(sleeps, duration) },
+		Now:           time.Now,
+	}
+
+	for run := 0; run < 2; run++ {
+		source, err := NewFileSource(strings.NewReader(decoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := dispatcher.Run(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "[/erp e1.erp /flaky e3.flaky /erp e4.erp]"
+	if actual := strings.Join(delivered, " "); "["+actual+"]" != expected {
+		t.Errorf("expected deliveries %s, got [%s]", expected, actual)
+	}
+
+	if len(sleeps) != 2 || sleeps[0] != time.Second || sleeps[1] != time.Second+time.Second/2 {
+		t.Errorf("expected a backoff of 1s and 1.5s, got %v", sleeps)
+	}
+
+	deadLetter := DeadLetter{}
+	if err := json.Unmarshal(deadLetters.Bytes(), &deadLetter); err != nil {
+		t.Fatal(err)
+	}
+
+	if deadLetter.Notification.DeliveryID != "e1.rejecting" || deadLetter.Attempts != 1 || strings.Count(deadLetters.String(), "\n") != 1 {
+		t.Errorf("expected one dead letter of e1 after a single attempt, got %s", deadLetters.String())
+	}
+}
+
+func TestCheckpointOfEventInProgress(t *testing.T) {
+	checkpoint := Checkpoint{}
+	current := Position{Block: 3, Tx: 1, Event: 0}
+
+	if checkpoint.Done(Position{}, "erp") {
+		t.Error("empty checkpoint covers an event")
+	}
+
+	checkpoint.Mark(current, "erp")
+
+	if !checkpoint.Done(current, "erp") || checkpoint.Done(current, "audit") {
+		t.Error("only the subscriptions delivered to are done with the event in progress")
+	}
+
+	if !checkpoint.Done(Position{Block: 3, Tx: 0, Event: 4}, "audit") || checkpoint.Done(Position{Block: 3, Tx: 1, Event: 1}, "erp") {
+		t.Error("checkpoint doesn't split the events at the one in progress")
+	}
+}